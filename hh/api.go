@@ -0,0 +1,236 @@
+package hh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"hhcv/storage"
+)
+
+// API is where hh calls go, HH_API_URL points them at a stub
+var API = "https://api.hh.ru"
+
+// UserAgent is what hh wants in HH-User-Agent
+const UserAgent = "n0thingg@yandex.ru update-cv"
+
+var (
+	ErrTokenExpired = errors.New("access token expired")
+	// ErrGrantGone means hh no longer honours the tokens, a refresh will not help
+	ErrGrantGone = errors.New("hh grant is already revoked or invalid")
+)
+
+// OAuthError reads oauth_error of a 401 or 403, hh sends token-expired
+// when a refresh would help and something else when the grant is gone.
+// It is nil for any other answer
+func OAuthError(status int, body []byte) error {
+	if status != http.StatusUnauthorized && status != http.StatusForbidden {
+		return nil
+	}
+
+	var hherr struct {
+		OAuthError string `json:"oauth_error"`
+	}
+	if err := json.Unmarshal(body, &hherr); err != nil || hherr.OAuthError == "" {
+		return nil
+	}
+	if hherr.OAuthError == "token-expired" {
+		return ErrTokenExpired
+	}
+
+	return fmt.Errorf("%w: %s", ErrGrantGone, hherr.OAuthError)
+}
+
+// RefreshToken trades a refresh token for new tokens, hh retires the old ones
+func RefreshToken(ctx context.Context, client *http.Client, rt string) (*storage.Token, error) {
+	q := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {rt}}
+	req, err := http.NewRequestWithContext(ctx, "POST", API+"/token?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HH-User-Agent", UserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		var hherr struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		if json.Unmarshal(bodyBytes, &hherr) == nil && hherr.Error == "invalid_grant" {
+			return nil, fmt.Errorf("%w: %s", ErrGrantGone, hherr.ErrorDescription)
+		}
+		return nil, fmt.Errorf("bad status code refreshToken(): %d %s", resp.StatusCode, bodyBytes)
+	}
+
+	var token storage.Token
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	return &token, nil
+}
+
+// get reads path with the access token at, a non 200 answer is an error
+// named after the call
+func get(ctx context.Context, client *http.Client, at, path, call string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", API+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+at)
+	req.Header.Set("HH-User-Agent", UserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if err := OAuthError(resp.StatusCode, bodyBytes); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("bad status code %s(): %d %s", call, resp.StatusCode, bodyBytes)
+	}
+
+	return bodyBytes, nil
+}
+
+// GetResumes returns the resumes of whoever at belongs to
+func GetResumes(ctx context.Context, client *http.Client, at string) ([]Resume, error) {
+	body, err := get(ctx, client, at, "/resumes/mine", "getResumes")
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Items []Resume `json:"items"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode resumes response: %w", err)
+	}
+
+	return list.Items, nil
+}
+
+// GetResume returns a resume in full as hh sent it
+func GetResume(ctx context.Context, client *http.Client, at, resumeID string) ([]byte, error) {
+	return get(ctx, client, at, "/resumes/"+url.PathEscape(resumeID), "getResume")
+}
+
+// Employer is an employer in a resume blacklist, in a search for one
+// or opening a resume
+type Employer struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	AlternateURL string `json:"alternate_url"`
+}
+
+// Blacklisted is the employer as a blacklist entry of a resume
+func (e Employer) Blacklisted(userID, resumeID string) storage.BlacklistedEmployer {
+	return storage.BlacklistedEmployer{
+		UserID:     userID,
+		ResumeID:   resumeID,
+		EmployerID: e.ID,
+		Name:       e.Name,
+		URL:        e.AlternateURL,
+	}
+}
+
+// getEmployers reads a paged list of employers from path, at most pages pages
+func getEmployers(ctx context.Context, client *http.Client, at, path string, query url.Values, pages int) ([]Employer, error) {
+	var employers []Employer
+	for page := 0; page < pages; page++ {
+		query.Set("page", strconv.Itoa(page))
+		body, err := get(ctx, client, at, path+"?"+query.Encode(), "getEmployers")
+		if err != nil {
+			return nil, err
+		}
+
+		var list struct {
+			Items []Employer `json:"items"`
+			Pages int        `json:"pages"`
+		}
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, fmt.Errorf("failed to decode employers response: %w", err)
+		}
+		employers = append(employers, list.Items...)
+		if page+1 >= list.Pages {
+			break
+		}
+	}
+
+	return employers, nil
+}
+
+// GetBlacklist returns every employer a resume is hidden from
+func GetBlacklist(ctx context.Context, client *http.Client, at, resumeID string) ([]Employer, error) {
+	path := "/resumes/" + url.PathEscape(resumeID) + "/blacklist"
+	return getEmployers(ctx, client, at, path, url.Values{"per_page": {"100"}}, 20)
+}
+
+// SearchBlacklist finds employers by name that can be added to the blacklist of a resume
+func SearchBlacklist(ctx context.Context, client *http.Client, at, resumeID, text string) ([]Employer, error) {
+	path := "/resumes/" + url.PathEscape(resumeID) + "/blacklist/search"
+	return getEmployers(ctx, client, at, path, url.Values{"text": {text}, "per_page": {"20"}}, 1)
+}
+
+// ChangeBlacklist adds an employer to the blacklist of a resume or removes it
+func ChangeBlacklist(ctx context.Context, client *http.Client, at, resumeID, employerID string, add bool) error {
+	endpoint := API + "/resumes/" + url.PathEscape(resumeID) + "/blacklist/employer"
+	method := "DELETE"
+	var body io.Reader
+	if add {
+		payload, err := json.Marshal(map[string]any{"items": []map[string]string{{"id": employerID}}})
+		if err != nil {
+			return err
+		}
+		method, body = "POST", bytes.NewReader(payload)
+	} else {
+		endpoint += "?" + url.Values{"id": {employerID}}.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+at)
+	req.Header.Set("HH-User-Agent", UserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		if err := OAuthError(resp.StatusCode, bodyBytes); err != nil {
+			return err
+		}
+		return fmt.Errorf("bad status code changeBlacklist(): %d %s", resp.StatusCode, bodyBytes)
+	}
+
+	return nil
+}
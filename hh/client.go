@@ -0,0 +1,147 @@
+package hh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"hhcv/storage"
+)
+
+// Store is the part of the repository Client needs
+type Store interface {
+	SyncStore
+	GetToken(ctx context.Context, userID string) (*storage.Token, error)
+	SaveToken(ctx context.Context, userID, code string, t *storage.Token) error
+	ReplaceResumes(ctx context.Context, userID string, resumes []storage.Resume) (storage.ResumeDiff, error)
+	ReplaceBlacklist(ctx context.Context, userID, resumeID string, employers []storage.BlacklistedEmployer) error
+	SaveResumeSnapshot(ctx context.Context, s *storage.ResumeSnapshot) (bool, error)
+}
+
+// Client calls hh on behalf of users with the tokens in Store
+type Client struct {
+	HTTP  *http.Client
+	Store Store
+	// Audit records token refreshes, web adds who asked and from where
+	Audit func(ctx context.Context, e storage.AuditEvent)
+}
+
+// WithToken calls fn with the access token of a user and once more with
+// a refreshed one when hh says it expired, doing goes into the audit log.
+// A token that expires again right away is an error, not another refresh
+func (c *Client) WithToken(ctx context.Context, userID, doing string, fn func(at string) error) error {
+	token, err := c.Store.GetToken(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = fn(token.AccessToken)
+	if !errors.Is(err, ErrTokenExpired) {
+		return err
+	}
+
+	if token, err = RefreshToken(ctx, c.HTTP, token.RefreshToken); err != nil {
+		return err
+	}
+	if err = c.Store.SaveToken(ctx, userID, "", token); err != nil {
+		return err
+	}
+	c.Audit(ctx, storage.AuditEvent{Action: storage.AuditTokenRefresh, UserID: userID, Details: "expired while " + doing})
+
+	return fn(token.AccessToken)
+}
+
+// SyncUser makes stored resumes of a user match hh, then snapshots them
+// and refreshes their blacklists. Those are history and failing them
+// does not fail the sync
+func (c *Client) SyncUser(ctx context.Context, userID string) (storage.ResumeDiff, error) {
+	var resumes []Resume
+	err := c.WithToken(ctx, userID, "syncing", func(at string) (err error) {
+		resumes, err = GetResumes(ctx, c.HTTP, at)
+		return err
+	})
+	// a failed fetch must not reach ReplaceResumes, it would remove every resume
+	if err != nil {
+		return storage.ResumeDiff{}, err
+	}
+
+	stored := StorageResumes(resumes)
+	diff, err := c.Store.ReplaceResumes(ctx, userID, stored)
+	if err != nil {
+		return diff, err
+	}
+
+	if err := c.SnapshotResumes(ctx, userID, stored); err != nil {
+		log.Printf("snapshots %s: %v", userID, err)
+	}
+	// the last known blacklists are kept
+	if err := c.RefreshBlacklists(ctx, userID, stored); err != nil {
+		log.Printf("blacklists %s: %v", userID, err)
+	}
+
+	return diff, nil
+}
+
+// RefreshBlacklists makes the mirror of every resume blacklist match hh,
+// the last known blacklist of a resume hh did not answer for is kept
+func (c *Client) RefreshBlacklists(ctx context.Context, userID string, resumes []storage.Resume) error {
+	var errs []error
+	for _, r := range resumes {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var employers []Employer
+		err := c.WithToken(ctx, userID, "loading blacklists", func(at string) (err error) {
+			employers, err = GetBlacklist(ctx, c.HTTP, at, r.ID)
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resume %s: %w", r.ID, err))
+			continue
+		}
+
+		blacklist := make([]storage.BlacklistedEmployer, 0, len(employers))
+		for _, e := range employers {
+			blacklist = append(blacklist, e.Blacklisted(userID, r.ID))
+		}
+		if err := c.Store.ReplaceBlacklist(ctx, userID, r.ID, blacklist); err != nil {
+			errs = append(errs, fmt.Errorf("resume %s: %w", r.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// SnapshotResumes fetches every resume in full and keeps the ones that
+// changed since their last snapshot
+func (c *Client) SnapshotResumes(ctx context.Context, userID string, resumes []storage.Resume) error {
+	var errs []error
+	for _, r := range resumes {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var data []byte
+		err := c.WithToken(ctx, userID, "taking snapshots", func(at string) (err error) {
+			data, err = GetResume(ctx, c.HTTP, at, r.ID)
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resume %s: %w", r.ID, err))
+			continue
+		}
+
+		snap, err := storage.NewResumeSnapshot(userID, r.ID, data)
+		if err == nil {
+			_, err = c.Store.SaveResumeSnapshot(ctx, snap)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resume %s: %w", r.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,213 @@
+package hh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hhcv/storage"
+)
+
+func TestOAuthError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"expired", http.StatusForbidden, `{"oauth_error": "token-expired"}`, ErrTokenExpired},
+		{"revoked", http.StatusForbidden, `{"oauth_error": "token-revoked"}`, ErrGrantGone},
+		{"bad token", http.StatusUnauthorized, `{"oauth_error": "bad-authorization"}`, ErrGrantGone},
+		{"other 403", http.StatusForbidden, `{"errors": [{"type": "forbidden"}]}`, nil},
+		{"not json", http.StatusForbidden, `forbidden`, nil},
+		{"other status", http.StatusBadRequest, `{"oauth_error": "token-expired"}`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := OAuthError(tt.status, []byte(tt.body))
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// tokenStore keeps one token and the ones saved over it
+type tokenStore struct {
+	fakeStore
+	token storage.Token
+	saved []storage.Token
+	snaps []storage.ResumeSnapshot
+	// replaced is nil until ReplaceResumes was called
+	replaced []storage.Resume
+}
+
+func (s *tokenStore) GetToken(_ context.Context, _ string) (*storage.Token, error) {
+	t := s.token
+	return &t, nil
+}
+
+func (s *tokenStore) SaveToken(_ context.Context, _, _ string, t *storage.Token) error {
+	s.token = *t
+	s.saved = append(s.saved, *t)
+	return nil
+}
+
+func (s *tokenStore) ReplaceResumes(_ context.Context, _ string, resumes []storage.Resume) (storage.ResumeDiff, error) {
+	s.replaced = append([]storage.Resume{}, resumes...)
+	return storage.ResumeDiff{}, nil
+}
+
+func (s *tokenStore) ReplaceBlacklist(_ context.Context, _, _ string, _ []storage.BlacklistedEmployer) error {
+	return nil
+}
+
+func (s *tokenStore) SaveResumeSnapshot(_ context.Context, snap *storage.ResumeSnapshot) (bool, error) {
+	s.snaps = append(s.snaps, *snap)
+	return true, nil
+}
+
+func TestWithToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		refresh     string
+		expiredFor  int
+		want        error
+		wantCalls   int
+		wantRefresh bool
+	}{
+		{name: "valid token", wantCalls: 1},
+		{name: "expired token is refreshed", expiredFor: 1, wantCalls: 2, wantRefresh: true},
+		{name: "refreshed once only", expiredFor: 2, want: ErrTokenExpired, wantCalls: 2, wantRefresh: true},
+		{name: "grant gone", refresh: `{"error": "invalid_grant", "error_description": "token was revoked"}`, expiredFor: 1, want: ErrGrantGone, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/token" || r.URL.Query().Get("refresh_token") != "rt1" {
+					http.Error(w, "unexpected "+r.URL.String(), http.StatusTeapot)
+					return
+				}
+				if tt.refresh != "" {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(tt.refresh))
+					return
+				}
+				w.Write([]byte(`{"access_token": "at2", "refresh_token": "rt2", "expires_in": 1209600}`))
+			}))
+			defer srv.Close()
+			defer func(api string) { API = api }(API)
+			API = srv.URL
+
+			store := &tokenStore{token: storage.Token{AccessToken: "at1", RefreshToken: "rt1"}}
+			var audited []storage.AuditEvent
+			c := &Client{HTTP: srv.Client(), Store: store, Audit: func(_ context.Context, e storage.AuditEvent) {
+				audited = append(audited, e)
+			}}
+
+			var calls []string
+			err := c.WithToken(context.Background(), "u1", "testing", func(at string) error {
+				calls = append(calls, at)
+				if len(calls) <= tt.expiredFor {
+					return ErrTokenExpired
+				}
+				return nil
+			})
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+			if len(calls) != tt.wantCalls {
+				t.Errorf("fn called with %v, want %d calls", calls, tt.wantCalls)
+			}
+
+			if !tt.wantRefresh {
+				if len(store.saved) > 0 || len(audited) > 0 {
+					t.Errorf("saved %+v and audited %+v without a refresh", store.saved, audited)
+				}
+				return
+			}
+			if calls[1] != "at2" {
+				t.Errorf("retried with %q, want the refreshed token", calls[1])
+			}
+			if len(store.saved) != 1 || store.saved[0].RefreshToken != "rt2" {
+				t.Errorf("saved %+v, want the refreshed token once", store.saved)
+			}
+			if len(audited) != 1 || audited[0].Action != storage.AuditTokenRefresh || audited[0].UserID != "u1" || audited[0].Details != "expired while testing" {
+				t.Errorf("audited %+v", audited)
+			}
+		})
+	}
+}
+
+func TestSnapshotResumes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/resumes/r1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"id": "r1", "title": "Go developer"}`))
+	}))
+	defer srv.Close()
+	defer func(api string) { API = api }(API)
+	API = srv.URL
+
+	store := &tokenStore{token: storage.Token{AccessToken: "at1"}}
+	c := &Client{HTTP: srv.Client(), Store: store}
+
+	// a resume hh does not answer for does not stop the others
+	resumes := []storage.Resume{{ID: "r2"}, {ID: "r1"}}
+	err := c.SnapshotResumes(context.Background(), "u1", resumes)
+	if err == nil || !strings.Contains(err.Error(), "resume r2") {
+		t.Errorf("got %v, want the error of r2", err)
+	}
+	if len(store.snaps) != 1 || store.snaps[0].UserID != "u1" || store.snaps[0].ResumeID != "r1" {
+		t.Errorf("saved %+v, want a snapshot of r1", store.snaps)
+	}
+}
+
+func TestSyncUser(t *testing.T) {
+	failing := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case failing:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case r.URL.Path == "/resumes/mine":
+			w.Write([]byte(`{"items": [{"id": "r1", "title": "Go developer"}]}`))
+		case r.URL.Path == "/resumes/r1":
+			w.Write([]byte(`{"id": "r1", "title": "Go developer"}`))
+		default:
+			// blacklists fail, the sync does not
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer func(api string) { API = api }(API)
+	API = srv.URL
+
+	store := &tokenStore{token: storage.Token{AccessToken: "at1"}}
+	c := &Client{HTTP: srv.Client(), Store: store}
+
+	if _, err := c.SyncUser(context.Background(), "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.replaced) != 1 || store.replaced[0].ID != "r1" {
+		t.Errorf("replaced with %+v, want r1", store.replaced)
+	}
+	if len(store.snaps) != 1 {
+		t.Errorf("took %d snapshots, want 1", len(store.snaps))
+	}
+
+	// a failed fetch must not reach ReplaceResumes
+	failing, store.replaced = true, nil
+	if _, err := c.SyncUser(context.Background(), "u1"); err == nil {
+		t.Error("sync succeeded while hh was down")
+	}
+	if store.replaced != nil {
+		t.Errorf("replaced with %+v after a failed fetch", store.replaced)
+	}
+}
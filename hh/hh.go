@@ -0,0 +1,103 @@
+// Package hh has what web and scheduler both need of hh: the calls they
+// share, resumes as hh sends them and what a sync of them leaves behind.
+// Calls only one binary makes stay in that binary.
+package hh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"hhcv/storage"
+)
+
+// Time reads hh timestamps, hh sends offsets without a colon
+type Time time.Time
+
+func (t *Time) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	parsed, err := time.Parse("2006-01-02T15:04:05-0700", s)
+	if err != nil {
+		return err
+	}
+	*t = Time(parsed)
+	return nil
+}
+
+// Resume is a resume as /resumes/mine returns it
+type Resume struct {
+	ID                 string `json:"id"`
+	Title              string `json:"title"`
+	CreatedAt          Time   `json:"created_at"`
+	UpdatedAt          Time   `json:"updated_at"`
+	AlternateURL       string `json:"alternate_url"`
+	CanPublishOrUpdate bool   `json:"can_publish_or_update"`
+	NextPublishAt      *Time  `json:"next_publish_at"`
+	Status             struct {
+		ID string `json:"id"`
+	} `json:"status"`
+	Access struct {
+		Type struct {
+			ID string `json:"id"`
+		} `json:"type"`
+	} `json:"access"`
+	ModerationNote json.RawMessage `json:"moderation_note"`
+}
+
+// Storage is the resume the way the repository keeps it
+func (r Resume) Storage() storage.Resume {
+	return storage.Resume{
+		ID:             r.ID,
+		Title:          r.Title,
+		AlternateURL:   r.AlternateURL,
+		CreatedAt:      time.Time(r.CreatedAt),
+		UpdatedAt:      time.Time(r.UpdatedAt),
+		Status:         r.Status.ID,
+		Visibility:     r.Access.Type.ID,
+		ModerationNote: storage.ModerationNote(r.ModerationNote),
+	}
+}
+
+// StorageResumes maps resumes the way the repository keeps them
+func StorageResumes(resumes []Resume) []storage.Resume {
+	stored := make([]storage.Resume, 0, len(resumes))
+	for _, r := range resumes {
+		stored = append(stored, r.Storage())
+	}
+	return stored
+}
+
+// SyncStore is the part of the repository RecordSync needs
+type SyncStore interface {
+	AddResumeSync(ctx context.Context, rs *storage.ResumeSync) error
+	AddNotification(ctx context.Context, n *storage.Notification) error
+}
+
+// RecordSync stores a sync that changed something or failed and tells the
+// user which resumes hh moderation has just blocked, bumps skip them until
+// they are fixed on hh. A failed notification does not stop the others
+func RecordSync(ctx context.Context, store SyncStore, rs *storage.ResumeSync) error {
+	var errs []error
+	if rs.Error != "" || !rs.Changes.IsEmpty() {
+		if err := store.AddResumeSync(ctx, rs); err != nil {
+			errs = append(errs, fmt.Errorf("resume sync: %w", err))
+		}
+	}
+
+	for _, title := range rs.Changes.Blocked {
+		n := storage.Notification{
+			UserID: rs.UserID,
+			Kind:   storage.NotifyBlocked,
+			Text:   fmt.Sprintf("Blocked by hh moderation: %s", title),
+			URL:    "/",
+		}
+		if err := store.AddNotification(ctx, &n); err != nil {
+			errs = append(errs, fmt.Errorf("notify of blocked resume %s: %w", title, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,118 @@
+package hh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"hhcv/storage"
+)
+
+func TestResumeStorage(t *testing.T) {
+	raw := `{
+		"id": "r1",
+		"title": "Go developer",
+		"created_at": "2026-10-01T10:00:00+0300",
+		"updated_at": "2026-10-02T11:30:00+0300",
+		"alternate_url": "https://hh.ru/resume/r1",
+		"next_publish_at": "2026-10-02T15:30:00+0300",
+		"status": {"id": "blocked", "name": "Blocked"},
+		"access": {"type": {"id": "everyone", "name": "Everyone"}},
+		"moderation_note": [{"id": "x", "name": "Salary is unrealistic"}, {"id": "y", "name": "Photo missing"}]
+	}`
+	var r Resume
+	if err := json.Unmarshal([]byte(raw), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.Storage()
+	want := storage.Resume{
+		ID:             "r1",
+		Title:          "Go developer",
+		AlternateURL:   "https://hh.ru/resume/r1",
+		CreatedAt:      time.Date(2026, 10, 1, 7, 0, 0, 0, time.UTC),
+		UpdatedAt:      time.Date(2026, 10, 2, 8, 30, 0, 0, time.UTC),
+		Status:         storage.ResumeBlocked,
+		Visibility:     storage.VisibilityEveryone,
+		ModerationNote: "Salary is unrealistic; Photo missing",
+	}
+	if got.ID != want.ID || got.Title != want.Title || got.AlternateURL != want.AlternateURL ||
+		!got.CreatedAt.Equal(want.CreatedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) ||
+		got.Status != want.Status || got.Visibility != want.Visibility || got.ModerationNote != want.ModerationNote {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if r.NextPublishAt == nil || !time.Time(*r.NextPublishAt).Equal(time.Date(2026, 10, 2, 12, 30, 0, 0, time.UTC)) {
+		t.Errorf("next publish at: got %v", r.NextPublishAt)
+	}
+}
+
+type fakeStore struct {
+	syncs []storage.ResumeSync
+	notes []storage.Notification
+	err   error
+}
+
+func (f *fakeStore) AddResumeSync(ctx context.Context, rs *storage.ResumeSync) error {
+	f.syncs = append(f.syncs, *rs)
+	return f.err
+}
+
+func (f *fakeStore) AddNotification(ctx context.Context, n *storage.Notification) error {
+	f.notes = append(f.notes, *n)
+	return f.err
+}
+
+func TestRecordSync(t *testing.T) {
+	tests := []struct {
+		name      string
+		rs        storage.ResumeSync
+		wantSyncs int
+		wantNotes []string
+	}{
+		{"nothing changed", storage.ResumeSync{UserID: "u1"}, 0, nil},
+		{"failed", storage.ResumeSync{UserID: "u1", Error: "bad status code"}, 1, nil},
+		{"added", storage.ResumeSync{UserID: "u1", Changes: storage.ResumeDiff{Added: []string{"Go developer"}}}, 1, nil},
+		{
+			"blocked",
+			storage.ResumeSync{UserID: "u1", Changes: storage.ResumeDiff{Updated: []string{"Go lead", "Go dev"}, Blocked: []string{"Go lead", "Go dev"}}},
+			1,
+			[]string{"Blocked by hh moderation: Go lead", "Blocked by hh moderation: Go dev"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{}
+			if err := RecordSync(context.Background(), store, &tt.rs); err != nil {
+				t.Fatal(err)
+			}
+			if len(store.syncs) != tt.wantSyncs {
+				t.Errorf("syncs: got %d, want %d", len(store.syncs), tt.wantSyncs)
+			}
+			if len(store.notes) != len(tt.wantNotes) {
+				t.Fatalf("notifications: got %+v, want %v", store.notes, tt.wantNotes)
+			}
+			for i, n := range store.notes {
+				if n.Text != tt.wantNotes[i] || n.UserID != "u1" || n.Kind != storage.NotifyBlocked {
+					t.Errorf("notification %d: got %+v, want %q", i, n, tt.wantNotes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRecordSyncErrors(t *testing.T) {
+	store := &fakeStore{err: errors.New("database is locked")}
+	rs := storage.ResumeSync{UserID: "u1", Changes: storage.ResumeDiff{Updated: []string{"Go lead"}, Blocked: []string{"Go lead"}}}
+
+	err := RecordSync(context.Background(), store, &rs)
+	if !errors.Is(err, store.err) {
+		t.Errorf("got %v, want it to wrap %v", err, store.err)
+	}
+	// the notification is tried even though the sync was not stored
+	if len(store.notes) != 1 {
+		t.Errorf("notifications: got %d, want 1", len(store.notes))
+	}
+}
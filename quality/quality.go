@@ -0,0 +1,155 @@
+// Package quality scores a resume as hh returns it in full and tells what
+// to fix for it to get views. Every rule is a plain function of a parsed
+// resume, fixtures only need Parse and a fixed now.
+package quality
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Resume is the part of a full hh resume the rules look at
+type Resume struct {
+	Salary *struct {
+		Amount int `json:"amount"`
+	} `json:"salary"`
+	SkillSet   []string     `json:"skill_set"`
+	About      string       `json:"skills"`
+	Experience []Experience `json:"experience"`
+	Photo      *struct {
+		ID string `json:"id"`
+	} `json:"photo"`
+}
+
+// Experience is a job, End is null for the current one
+type Experience struct {
+	Company  string  `json:"company"`
+	Position string  `json:"position"`
+	Start    string  `json:"start"`
+	End      *string `json:"end"`
+}
+
+func Parse(data []byte) (*Resume, error) {
+	var r Resume
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Rule is one check, Check returns a hint on what to fix or
+// an empty string when the resume passes
+type Rule struct {
+	ID     string
+	Weight int
+	Check  func(r *Resume, now time.Time) string
+}
+
+const (
+	minSkills    = 5
+	minAboutLen  = 300
+	staleJobTime = 365 * 24 * time.Hour
+)
+
+// Rules are the checks Evaluate runs by default
+var Rules = []Rule{
+	{ID: "salary", Weight: 20, Check: checkSalary},
+	{ID: "skills", Weight: 25, Check: checkSkills},
+	{ID: "about", Weight: 20, Check: checkAbout},
+	{ID: "experience", Weight: 25, Check: checkExperience},
+	{ID: "photo", Weight: 10, Check: checkPhoto},
+}
+
+func checkSalary(r *Resume, _ time.Time) string {
+	if r.Salary == nil || r.Salary.Amount == 0 {
+		return "Add the salary you expect, searches filtered by salary skip resumes without one."
+	}
+	return ""
+}
+
+func checkSkills(r *Resume, _ time.Time) string {
+	switch n := len(r.SkillSet); {
+	case n == 0:
+		return "List your key skills, employers search by them."
+	case n < minSkills:
+		return fmt.Sprintf("List at least %d key skills, there are %d.", minSkills, n)
+	default:
+		return ""
+	}
+}
+
+func checkAbout(r *Resume, _ time.Time) string {
+	switch n := utf8.RuneCountInString(strings.TrimSpace(r.About)); {
+	case n == 0:
+		return "Write a few sentences about yourself."
+	case n < minAboutLen:
+		return fmt.Sprintf("Tell more about yourself, %d characters is short, aim for %d.", n, minAboutLen)
+	default:
+		return ""
+	}
+}
+
+// checkExperience passes with a current job or one that ended within a year
+func checkExperience(r *Resume, now time.Time) string {
+	if len(r.Experience) == 0 {
+		return "Add work experience."
+	}
+
+	var last time.Time
+	for _, e := range r.Experience {
+		if e.End == nil {
+			return ""
+		}
+		if end, err := time.Parse(time.DateOnly, *e.End); err == nil && end.After(last) {
+			last = end
+		}
+	}
+	if last.IsZero() || now.Sub(last) < staleJobTime {
+		return ""
+	}
+
+	return fmt.Sprintf("Your last job ended in %s, add what you have done since.", last.Format("January 2006"))
+}
+
+func checkPhoto(r *Resume, _ time.Time) string {
+	if r.Photo == nil {
+		return "Add a photo, resumes with one get more views."
+	}
+	return ""
+}
+
+// Hint is a failed rule with what to do about it
+type Hint struct {
+	Rule string `json:"rule"`
+	Text string `json:"text"`
+}
+
+// Report is the share of rule weight a resume passed, 0 to 100
+type Report struct {
+	Score int    `json:"score"`
+	Hints []Hint `json:"hints"`
+}
+
+// Evaluate runs rules against r, the score is out of 100 whatever the weights add up to
+func Evaluate(r *Resume, rules []Rule, now time.Time) Report {
+	var report Report
+	var total, passed int
+	for _, rule := range rules {
+		total += rule.Weight
+		if hint := rule.Check(r, now); hint != "" {
+			report.Hints = append(report.Hints, Hint{Rule: rule.ID, Text: hint})
+			continue
+		}
+		passed += rule.Weight
+	}
+	if total > 0 {
+		report.Score = passed * 100 / total
+	}
+	// only rules with negative weights get it out of range
+	report.Score = min(max(report.Score, 0), 100)
+
+	return report
+}
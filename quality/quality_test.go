@@ -0,0 +1,184 @@
+package quality
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+// complete passes every rule, fixtures break it one field at a time
+const complete = `{
+	"salary": {"amount": 250000, "currency": "RUR"},
+	"skill_set": ["Go", "PostgreSQL", "Kubernetes", "gRPC", "Kafka"],
+	"skills": "` + "%ABOUT%" + `",
+	"experience": [
+		{"company": "Acme", "position": "Go developer", "start": "2022-03-01", "end": null},
+		{"company": "Globex", "position": "Backend developer", "start": "2019-01-01", "end": "2022-02-01"}
+	],
+	"photo": {"id": "p1"}
+}`
+
+func fixture(t *testing.T, replace ...string) *Resume {
+	t.Helper()
+
+	raw := strings.Replace(complete, "%ABOUT%", strings.Repeat("a", minAboutLen), 1)
+	raw = strings.NewReplacer(replace...).Replace(raw)
+	r, err := Parse([]byte(raw))
+	if err != nil {
+		t.Fatalf("parse fixture: %v\n%s", err, raw)
+	}
+	return r
+}
+
+func ruleByID(t *testing.T, id string) Rule {
+	t.Helper()
+
+	for _, rule := range Rules {
+		if rule.ID == id {
+			return rule
+		}
+	}
+	t.Fatalf("no rule %s", id)
+	return Rule{}
+}
+
+func TestRules(t *testing.T) {
+	about := strings.Repeat("a", minAboutLen)
+
+	tests := []struct {
+		name    string
+		rule    string
+		replace []string
+		hint    string
+	}{
+		{"salary set", "salary", nil, ""},
+		{"no salary", "salary", []string{`{"amount": 250000, "currency": "RUR"}`, `null`}, "Add the salary you expect, searches filtered by salary skip resumes without one."},
+		{"zero salary", "salary", []string{`"amount": 250000`, `"amount": 0`}, "Add the salary you expect, searches filtered by salary skip resumes without one."},
+
+		{"five skills", "skills", nil, ""},
+		{"no skills", "skills", []string{`["Go", "PostgreSQL", "Kubernetes", "gRPC", "Kafka"]`, `[]`}, "List your key skills, employers search by them."},
+		{"two skills", "skills", []string{`["Go", "PostgreSQL", "Kubernetes", "gRPC", "Kafka"]`, `["Go", "SQL"]`}, "List at least 5 key skills, there are 2."},
+
+		{"long about", "about", nil, ""},
+		{"no about", "about", []string{about, ""}, "Write a few sentences about yourself."},
+		{"blank about", "about", []string{about, "   "}, "Write a few sentences about yourself."},
+		{"short about", "about", []string{about, "I write Go"}, "Tell more about yourself, 10 characters is short, aim for 300."},
+		// characters, not bytes, Cyrillic takes two bytes each
+		{"cyrillic about", "about", []string{about, strings.Repeat("я", minAboutLen)}, ""},
+
+		{"current job", "experience", nil, ""},
+		{"no experience", "experience", []string{`"experience": [`, `"experience": [], "x": [`}, "Add work experience."},
+		{"recent job ended", "experience", []string{`"end": null`, `"end": "2026-01-31"`}, ""},
+		{"stale job", "experience", []string{`"end": null`, `"end": "2025-03-31"`}, "Your last job ended in March 2025, add what you have done since."},
+		{"unreadable end date", "experience", []string{`"end": null`, `"end": "soon"`, `"2022-02-01"`, `"later"`}, ""},
+
+		{"photo", "photo", nil, ""},
+		{"no photo", "photo", []string{`{"id": "p1"}`, `null`}, "Add a photo, resumes with one get more views."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := ruleByID(t, tt.rule)
+			if got := rule.Check(fixture(t, tt.replace...), now); got != tt.hint {
+				t.Errorf("got %q, want %q", got, tt.hint)
+			}
+		})
+	}
+}
+
+func TestWeights(t *testing.T) {
+	want := map[string]int{"salary": 20, "skills": 25, "about": 20, "experience": 25, "photo": 10}
+
+	got := make(map[string]int, len(Rules))
+	var total int
+	for _, rule := range Rules {
+		got[rule.ID] = rule.Weight
+		total += rule.Weight
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if total != 100 {
+		t.Errorf("weights add up to %d, want 100", total)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name    string
+		replace []string
+		score   int
+		rules   []string
+	}{
+		{"complete", nil, 100, nil},
+		{"no photo", []string{`{"id": "p1"}`, `null`}, 90, []string{"photo"}},
+		{
+			"no salary and two skills",
+			[]string{`{"amount": 250000, "currency": "RUR"}`, `null`, `["Go", "PostgreSQL", "Kubernetes", "gRPC", "Kafka"]`, `["Go", "SQL"]`},
+			55,
+			[]string{"salary", "skills"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Evaluate(fixture(t, tt.replace...), Rules, now)
+			if report.Score != tt.score {
+				t.Errorf("score: got %d, want %d", report.Score, tt.score)
+			}
+
+			var rules []string
+			for _, h := range report.Hints {
+				rules = append(rules, h.Rule)
+			}
+			if !reflect.DeepEqual(rules, tt.rules) {
+				t.Errorf("hints: got %v, want %v", rules, tt.rules)
+			}
+		})
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		r, err := Parse([]byte(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		report := Evaluate(r, Rules, now)
+		if report.Score != 0 || len(report.Hints) != len(Rules) {
+			t.Errorf("got %+v", report)
+		}
+		// hints keep the order of the rules
+		for i, h := range report.Hints {
+			if h.Rule != Rules[i].ID {
+				t.Errorf("hint %d: got %s, want %s", i, h.Rule, Rules[i].ID)
+			}
+		}
+	})
+}
+
+func TestEvaluateRange(t *testing.T) {
+	pass := func(*Resume, time.Time) string { return "" }
+	fail := func(*Resume, time.Time) string { return "fix it" }
+
+	tests := []struct {
+		name  string
+		rules []Rule
+		score int
+	}{
+		{"no rules", nil, 0},
+		{"weights over 100", []Rule{{"a", 150, pass}, {"b", 50, fail}}, 75},
+		{"zero weights", []Rule{{"a", 0, pass}, {"b", 0, fail}}, 0},
+		{"negative weight failing", []Rule{{"a", 50, pass}, {"b", -30, fail}}, 100},
+		{"negative weight passing", []Rule{{"a", 50, fail}, {"b", -30, pass}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Evaluate(&Resume{}, tt.rules, now).Score; got != tt.score {
+				t.Errorf("got %d, want %d", got, tt.score)
+			}
+		})
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"hhcv/hh"
+	"hhcv/storage"
+)
+
+const adminUsage = `usage: hhcv-scheduler [command] [arguments]
+
+without a command a scheduler run is performed and recorded as cron.
+every run first syncs resumes and collects applications, matching vacancies
+and saved search results of active users from hh.
+
+commands:
+  run [-dry-run]                scheduler run recorded as manual
+  plan [-user id] [-json]       what a run would do, nothing is published or recorded
+                                same as --dry-run
+  daemon                        run at SCHEDULE_TIMES in SCHEDULE_TZ until stopped,
+                                and at the slots planned for users in auto mode
+  users [-json]                 list users
+  resumes [-user id] [-json]    list resumes, of every user by default
+  quality -user id [-json]      score resumes by their latest snapshots, with hints
+  token -user id                show token expiry, never the token itself
+  refresh-token -user id        force a token refresh
+  delete-user -user id          delete user with tokens, resumes and history, hh access is not revoked
+  sync (-user id | -all)        re-sync resumes from hh
+  negotiations (-user id | -all)
+                                collect applications from hh and print the ones that moved
+  matches (-user id | -all)     collect vacancies similar to every resume, print how many are new
+  searches (-user id | -all)    run saved vacancy searches, print how many results are new
+  slots -user id [-mode fixed|auto] [-json]
+                                collect resume views and show the bump slots planned
+                                from them, -mode switches how the user is scheduled
+  blacklist -user id [-resume id] [-add employer | -remove employer] [-json]
+                                employers resumes are hidden from, refreshed from hh,
+                                -add and -remove change the blacklist of -resume on hh
+  history [-n 50] [-json]       recent scheduler history
+  runs [-n 50] [-json]          recent scheduler runs
+  syncs [-n 50] [-json]         recent resume syncs that changed something or failed
+  audit [-user id] [-n 50] [-json]
+                                audit log, of every user by default
+  backup -dir path [-keep 7]    online copy of the sqlite database, older copies are rotated
+  export [-file -] [-tokens]    json dump of users, resumes and history,
+                                -tokens adds tokens sealed with EXPORT_KEY
+  import [-file -]              load a dump into an empty database, tokens are opened
+                                with EXPORT_KEY and sealed with ENCRYPTION_KEY
+`
+
+var errUsage = errors.New("see usage above")
+
+func runAdmin(ctx context.Context, client *http.Client, cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, adminUsage) }
+
+	userID := fs.String("user", "", "hh user id")
+	all := fs.Bool("all", false, "apply to every user")
+	limit := fs.Int("n", 50, "number of rows")
+	asJSON := fs.Bool("json", false, "print json instead of a table")
+	dir := fs.String("dir", "", "backup directory")
+	keep := fs.Int("keep", 7, "backups to keep, 0 keeps all")
+	file := fs.String("file", "-", "dump file, - is stdout or stdin")
+	withTokens := fs.Bool("tokens", false, "include tokens sealed with EXPORT_KEY")
+	resumeID := fs.String("resume", "", "hh resume id")
+	addEmployer := fs.String("add", "", "hh employer id to hide the resume from")
+	removeEmployer := fs.String("remove", "", "hh employer id to show the resume to again")
+	mode := fs.String("mode", "", "schedule mode, fixed or auto")
+
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+
+	switch cmd {
+	case "users":
+		return adminUsers(ctx, *asJSON)
+	case "resumes":
+		return adminResumes(ctx, *userID, *asJSON)
+	case "quality":
+		if *userID == "" {
+			return errUsage
+		}
+		return adminQuality(ctx, *userID, *asJSON)
+	case "token":
+		if *userID == "" {
+			return errUsage
+		}
+		return adminToken(ctx, *userID)
+	case "refresh-token":
+		if *userID == "" {
+			return errUsage
+		}
+		return adminRefreshToken(ctx, client, *userID)
+	case "delete-user":
+		if *userID == "" {
+			return errUsage
+		}
+		// the web app revokes hh access on delete, this is the way out when it can not
+		t := &storage.Tombstone{UserID: *userID, Actor: storage.ActorCLI, Details: "deleted from cli, hh access not revoked"}
+		if err := repo.PurgeUser(ctx, t); err != nil {
+			return err
+		}
+		audit(ctx, storage.AuditEvent{Actor: storage.ActorCLI, Action: storage.AuditUserPurge, UserID: *userID, Details: t.Details})
+		fmt.Println("purged user", *userID, "and their history, hh access was not revoked")
+		return nil
+	case "sync":
+		if *userID == "" && !*all {
+			return errUsage
+		}
+		return adminSync(ctx, client, *userID)
+	case "negotiations":
+		if *userID == "" && !*all {
+			return errUsage
+		}
+		return adminNegotiations(ctx, client, *userID)
+	case "matches":
+		if *userID == "" && !*all {
+			return errUsage
+		}
+		return adminMatches(ctx, client, *userID)
+	case "searches":
+		if *userID == "" && !*all {
+			return errUsage
+		}
+		return adminSearches(ctx, client, *userID)
+	case "slots":
+		if *userID == "" || (*mode != "" && *mode != storage.ScheduleFixed && *mode != storage.ScheduleAuto) {
+			return errUsage
+		}
+		return adminSlots(ctx, client, *userID, *mode, *asJSON)
+	case "blacklist":
+		changing := *addEmployer != "" || *removeEmployer != ""
+		if *userID == "" || (changing && *resumeID == "") || (*addEmployer != "" && *removeEmployer != "") {
+			return errUsage
+		}
+		return adminBlacklist(ctx, client, *userID, *resumeID, *addEmployer, *removeEmployer, *asJSON)
+	case "history":
+		return adminHistory(ctx, *limit, *asJSON)
+	case "plan":
+		return printPlan(ctx, client, *userID, *asJSON)
+	case "runs":
+		return adminRuns(ctx, *limit, *asJSON)
+	case "syncs":
+		return adminSyncs(ctx, *limit, *asJSON)
+	case "audit":
+		return adminAudit(ctx, *userID, *limit, *asJSON)
+	case "backup":
+		if *dir == "" {
+			return errUsage
+		}
+		return adminBackup(ctx, *dir, *keep)
+	case "export":
+		return adminExport(ctx, *file, *withTokens)
+	case "import":
+		return adminImport(ctx, *file)
+	default:
+		fs.Usage()
+		return errUsage
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func adminUsers(ctx context.Context, asJSON bool) error {
+	users, err := repo.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return printJSON(users)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tRESUMES\tSCHEDULED\tDISABLED\tMODE\tZONE")
+	for _, u := range users {
+		zone := u.TimeZone
+		if zone == "" {
+			zone = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s %s\t%d\t%d\t%t\t%s\t%s\n", u.ID, u.LastName, u.FirstName, u.ResumeCount, u.ScheduledCount, u.IsDisabled, u.ScheduleMode, zone)
+	}
+
+	return w.Flush()
+}
+
+func adminResumes(ctx context.Context, userID string, asJSON bool) error {
+	resumes, err := repo.ListResumes(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return printJSON(resumes)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSER\tTITLE\tUPDATED\tSCHEDULED\tSTATUS")
+	for _, r := range resumes {
+		status := r.StatusLabel()
+		if reason := r.SkipReason(); reason != "" {
+			status = "skipped: " + reason
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\n", r.ID, r.UserID, r.Title, formatTime(r.UpdatedAt), r.IsScheduled, status)
+	}
+
+	return w.Flush()
+}
+
+func adminToken(ctx context.Context, userID string) error {
+	token, err := repo.GetToken(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("user:       ", userID)
+	fmt.Println("decrypts:    yes")
+	fmt.Println("expires in: ", time.Duration(token.ExpiresIn)*time.Second)
+
+	expiresAt, ok := token.ExpiresAt()
+	if !ok {
+		fmt.Println("expires at:  unknown, token was obtained before expiry tracking")
+		return nil
+	}
+
+	fmt.Println("obtained at:", formatTime(token.ObtainedAt))
+	fmt.Println("expires at: ", expiresAt.Format(time.RFC3339))
+	if left := time.Until(expiresAt); left > 0 {
+		fmt.Println("status:      valid for", left.Round(time.Minute))
+	} else {
+		fmt.Println("status:      expired")
+	}
+
+	return nil
+}
+
+func adminRefreshToken(ctx context.Context, client *http.Client, userID string) error {
+	stored, err := repo.GetToken(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	token, err := hh.RefreshToken(ctx, client, stored.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.SaveToken(ctx, userID, "", token); err != nil {
+		return err
+	}
+	audit(ctx, storage.AuditEvent{Actor: storage.ActorCLI, Action: storage.AuditTokenRefresh, UserID: userID})
+
+	fmt.Printf("refreshed token of user %s, expires in %s\n", userID, time.Duration(token.ExpiresIn)*time.Second)
+	return nil
+}
+
+// empty userID syncs every user that is not disabled
+func adminSync(ctx context.Context, client *http.Client, userID string) error {
+	userIDs := []string{userID}
+	if userID == "" {
+		var err error
+		if userIDs, err = activeUserIDs(ctx); err != nil {
+			return err
+		}
+	}
+
+	var failed int
+	for _, rs := range syncResumes(ctx, client, userIDs, storage.SyncManual) {
+		if rs.Error != "" {
+			fmt.Printf("%s: %s\n", rs.UserID, rs.Error)
+			failed++
+			continue
+		}
+
+		fmt.Printf("%s: %s\n", rs.UserID, rs.Changes)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d users failed to sync", failed, len(userIDs))
+	}
+
+	return nil
+}
+
+func adminAudit(ctx context.Context, userID string, limit int, asJSON bool) error {
+	events, err := repo.ListAudit(ctx, userID, limit)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return printJSON(events)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIMESTAMP\tACTOR\tACTION\tUSER\tTARGET\tIP\tDETAILS")
+	for _, e := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", formatTime(e.Timestamp), e.Actor, e.Action, e.UserID, e.Target, e.IP, e.Details)
+	}
+
+	return w.Flush()
+}
+
+func adminSyncs(ctx context.Context, limit int, asJSON bool) error {
+	syncs, err := repo.ListResumeSyncs(ctx, limit)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return printJSON(syncs)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIMESTAMP\tUSER\tSOURCE\tCHANGES\tERROR")
+	for _, rs := range syncs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", formatTime(rs.Timestamp), rs.UserID, rs.Source, rs.Changes, rs.Error)
+	}
+
+	return w.Flush()
+}
+
+func adminHistory(ctx context.Context, limit int, asJSON bool) error {
+	history, err := repo.ListAttempts(ctx, limit)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return printJSON(history)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tTIMESTAMP\tUSER\tRESUME\tTITLE\tSTATUS\tERROR")
+	for _, h := range history {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", h.RunID, formatTime(h.Timestamp), h.UserID, h.ResumeID, h.ResumeTitle, h.Status, h.Error)
+	}
+
+	return w.Flush()
+}
+
+func adminRuns(ctx context.Context, limit int, asJSON bool) error {
+	runs, err := repo.ListRuns(ctx, limit)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return printJSON(runs)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTARTED\tFINISHED\tTRIGGER\tATTEMPTED\tSUCCEEDED\tSKIPPED\tFAILED\tVERSION")
+	for _, r := range runs {
+		fmt.Fprintf(
+			w, "%d\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n",
+			r.ID, formatTime(r.StartedAt), formatTime(r.FinishedAt), r.Trigger, r.Attempted, r.Succeeded, r.Skipped, r.Failed, r.Version,
+		)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"hhcv/hh"
+	"hhcv/storage"
+)
+
+// HHTime reads hh timestamps, see hh.Time
+type HHTime = hh.Time
+
+var errResumeNotFound = errors.New("resume not found on hh")
+
+// bump publishes a resume, a token that expired is refreshed once
+// and a second failure is returned
+func bump(ctx context.Context, client *http.Client, uid, rid string) error {
+	return hhClient(client).WithToken(ctx, uid, "publishing", func(at string) error {
+		return publish(ctx, client, at, rid)
+	})
+}
+
+func publish(ctx context.Context, client *http.Client, at, rid string) error {
+	url := fmt.Sprintf("%s/resumes/%s/publish", hh.API, rid)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("HH-User-Agent", os.Getenv("HH_USER_AGENT"))
+	req.Header.Add("Authorization", "Bearer "+at)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errResumeNotFound
+	}
+
+	if resp.StatusCode != http.StatusNoContent {
+		if err := hh.OAuthError(resp.StatusCode, body); err != nil {
+			return err
+		}
+		return fmt.Errorf("non 204 returned: %d %s", resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// View is an employer opening a resume, as /resumes/{id}/views returns it
+type View struct {
+	CreatedAt HHTime      `json:"created_at"`
+	Employer  hh.Employer `json:"employer"`
+}
+
+func (v View) toStorage(userID, resumeID string) storage.ResumeView {
+	return storage.ResumeView{
+		UserID:       userID,
+		ResumeID:     resumeID,
+		ViewedAt:     time.Time(v.CreatedAt),
+		EmployerID:   v.Employer.ID,
+		EmployerName: v.Employer.Name,
+	}
+}
+
+// hh keeps views for a while only, maxViewPages bounds one collection
+const maxViewPages = 20
+
+// HHGetResumeViews returns the views of a resume hh still has, newest first
+func HHGetResumeViews(ctx context.Context, client *http.Client, at, resumeID string) ([]View, error) {
+	var views []View
+	for page := 0; page < maxViewPages; page++ {
+		q := url.Values{"per_page": {"100"}, "page": {strconv.Itoa(page)}}
+		req, err := http.NewRequestWithContext(ctx, "GET", hh.API+"/resumes/"+url.PathEscape(resumeID)+"/views?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+at)
+		req.Header.Set("HH-User-Agent", hh.UserAgent)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			if err := hh.OAuthError(resp.StatusCode, bodyBytes); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("bad status code HHGetResumeViews(): %d %s", resp.StatusCode, bodyBytes)
+		}
+
+		var list struct {
+			Items []View `json:"items"`
+			Pages int    `json:"pages"`
+		}
+		if err := json.Unmarshal(bodyBytes, &list); err != nil {
+			return nil, err
+		}
+		views = append(views, list.Items...)
+		if page+1 >= list.Pages {
+			break
+		}
+	}
+
+	return views, nil
+}
+
+// Negotiation is an application as /negotiations returns it,
+// resume and vacancy are null once deleted on hh
+type Negotiation struct {
+	ID    string `json:"id"`
+	State struct {
+		ID string `json:"id"`
+	} `json:"state"`
+	CreatedAt HHTime `json:"created_at"`
+	UpdatedAt HHTime `json:"updated_at"`
+	Viewed    bool   `json:"viewed_by_opponent"`
+	Resume    *struct {
+		ID string `json:"id"`
+	} `json:"resume"`
+	Vacancy *struct {
+		ID           string `json:"id"`
+		Name         string `json:"name"`
+		AlternateURL string `json:"alternate_url"`
+		Employer     *struct {
+			Name string `json:"name"`
+		} `json:"employer"`
+	} `json:"vacancy"`
+}
+
+func (n Negotiation) toStorage() storage.Negotiation {
+	sn := storage.Negotiation{
+		ID:        n.ID,
+		State:     n.State.ID,
+		Viewed:    n.Viewed,
+		CreatedAt: time.Time(n.CreatedAt),
+		UpdatedAt: time.Time(n.UpdatedAt),
+	}
+	if n.Resume != nil {
+		sn.ResumeID = n.Resume.ID
+	}
+	if n.Vacancy != nil {
+		sn.VacancyID = n.Vacancy.ID
+		sn.VacancyName = n.Vacancy.Name
+		sn.URL = n.Vacancy.AlternateURL
+		if n.Vacancy.Employer != nil {
+			sn.Employer = n.Vacancy.Employer.Name
+		}
+	}
+	sn.Stage = storage.NegotiationStage(sn.State, sn.Viewed)
+
+	return sn
+}
+
+// Vacancy is a vacancy as searches return it
+type Vacancy struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	AlternateURL string `json:"alternate_url"`
+	PublishedAt  HHTime `json:"published_at"`
+	Employer     *struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"employer"`
+	Salary *struct {
+		From     *int   `json:"from"`
+		To       *int   `json:"to"`
+		Currency string `json:"currency"`
+	} `json:"salary"`
+	Area *struct {
+		Name string `json:"name"`
+	} `json:"area"`
+}
+
+func (v Vacancy) salary() string {
+	if v.Salary == nil {
+		return ""
+	}
+
+	var parts []string
+	if v.Salary.From != nil {
+		parts = append(parts, fmt.Sprintf("from %d", *v.Salary.From))
+	}
+	if v.Salary.To != nil {
+		parts = append(parts, fmt.Sprintf("to %d", *v.Salary.To))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+
+	return strings.Join(append(parts, v.Salary.Currency), " ")
+}
+
+func (v Vacancy) toMatch() storage.Match {
+	m := storage.Match{
+		VacancyID:   v.ID,
+		Name:        v.Name,
+		URL:         v.AlternateURL,
+		Salary:      v.salary(),
+		PublishedAt: time.Time(v.PublishedAt),
+	}
+	if v.Employer != nil {
+		m.EmployerID = v.Employer.ID
+		m.Employer = v.Employer.Name
+	}
+	if v.Area != nil {
+		m.Area = v.Area.Name
+	}
+
+	return m
+}
+
+func (v Vacancy) toSearchResult() storage.SearchResult {
+	m := v.toMatch()
+	return storage.SearchResult{
+		VacancyID:   m.VacancyID,
+		Name:        m.Name,
+		EmployerID:  m.EmployerID,
+		Employer:    m.Employer,
+		URL:         m.URL,
+		Salary:      m.Salary,
+		Area:        m.Area,
+		PublishedAt: m.PublishedAt,
+	}
+}
+
+const similarVacanciesPerPage = 50
+
+// HHGetSimilarVacancies returns the first page of vacancies hh finds similar to a resume
+func HHGetSimilarVacancies(ctx context.Context, client *http.Client, at, resumeID string) ([]Vacancy, error) {
+	url := fmt.Sprintf("%s/resumes/%s/similar_vacancies?per_page=%d", hh.API, resumeID, similarVacanciesPerPage)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+at)
+	req.Header.Set("HH-User-Agent", hh.UserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		if err := hh.OAuthError(resp.StatusCode, bodyBytes); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("bad status code HHGetSimilarVacancies(): %d %s", resp.StatusCode, bodyBytes)
+	}
+
+	var hhv struct {
+		Items []Vacancy `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&hhv); err != nil {
+		return nil, fmt.Errorf("failed to decode similar vacancies response: %w", err)
+	}
+
+	return hhv.Items, nil
+}
+
+// hh answers at most 2000 vacancies per search, maxSearchPages bounds one run
+// well below that, searches run often enough for the newest to be all that is new
+const maxSearchPages = 5
+
+// HHSearchVacancies returns the newest vacancies for search params, newest
+// first, search is open to anyone so no token is sent
+func HHSearchVacancies(ctx context.Context, client *http.Client, params url.Values) ([]Vacancy, error) {
+	params.Set("per_page", strconv.Itoa(similarVacanciesPerPage))
+	params.Set("order_by", "publication_time")
+
+	var vacancies []Vacancy
+	for page := 0; page < maxSearchPages; page++ {
+		params.Set("page", strconv.Itoa(page))
+		req, err := http.NewRequestWithContext(ctx, "GET", hh.API+"/vacancies?"+params.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("HH-User-Agent", hh.UserAgent)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("bad status code HHSearchVacancies(): %d %s", resp.StatusCode, bodyBytes)
+		}
+
+		var list struct {
+			Items []Vacancy `json:"items"`
+			Pages int       `json:"pages"`
+		}
+		if err := json.Unmarshal(bodyBytes, &list); err != nil {
+			return nil, fmt.Errorf("failed to decode vacancies response: %w", err)
+		}
+		vacancies = append(vacancies, list.Items...)
+		if page+1 >= list.Pages {
+			break
+		}
+	}
+
+	return vacancies, nil
+}
+
+// hh pages negotiations, maxNegotiationPages bounds one sync
+const (
+	negotiationsPerPage = 100
+	maxNegotiationPages = 20
+)
+
+func HHGetNegotiations(ctx context.Context, client *http.Client, at string) ([]Negotiation, error) {
+	var negotiations []Negotiation
+	for page := 0; page < maxNegotiationPages; page++ {
+		url := fmt.Sprintf("%s/negotiations?page=%d&per_page=%d", hh.API, page, negotiationsPerPage)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Authorization", "Bearer "+at)
+		req.Header.Set("HH-User-Agent", hh.UserAgent)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err := hh.OAuthError(resp.StatusCode, bodyBytes); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("bad status code HHGetNegotiations(): %d %s", resp.StatusCode, bodyBytes)
+		}
+
+		var hhn struct {
+			Items []Negotiation `json:"items"`
+			Pages int           `json:"pages"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&hhn)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode negotiations response: %w", err)
+		}
+
+		negotiations = append(negotiations, hhn.Items...)
+		if page+1 >= hhn.Pages {
+			break
+		}
+	}
+
+	return negotiations, nil
+}
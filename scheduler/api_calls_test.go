@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"hhcv/hh"
+	"hhcv/storage"
+)
+
+// publishStub answers publish with token-expired until expired runs out
+// and counts publishes and refreshes
+type publishStub struct {
+	mu        sync.Mutex
+	expired   int
+	publishes int
+	refreshes int
+}
+
+func (s *publishStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/token":
+		s.refreshes++
+		w.Write([]byte(`{"access_token":"at2","refresh_token":"rt2","expires_in":1209600}`))
+	case "/resumes/r1/publish":
+		s.publishes++
+		if s.expired > 0 {
+			s.expired--
+			http.Error(w, `{"oauth_error":"token-expired"}`, http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestBumpRefreshesOnce(t *testing.T) {
+	tests := []struct {
+		name          string
+		expired       int
+		want          error
+		wantPublishes int
+		wantRefreshes int
+	}{
+		{"valid token", 0, nil, 1, 0},
+		{"expired token", 1, nil, 2, 1},
+		{"expired again after the refresh", 5, hh.ErrTokenExpired, 2, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &publishStub{expired: tt.expired}
+			client := withStub(t, stub)
+			ctx := context.Background()
+
+			if err := repo.UpsertUser(ctx, &storage.User{ID: "u1", FirstName: "Ivan"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.SaveToken(ctx, "u1", "", &storage.Token{AccessToken: "at1", RefreshToken: "rt1"}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := bump(ctx, client, "u1", "r1")
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+			if stub.publishes != tt.wantPublishes || stub.refreshes != tt.wantRefreshes {
+				t.Errorf("published %d times with %d refreshes, want %d and %d", stub.publishes, stub.refreshes, tt.wantPublishes, tt.wantRefreshes)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"hhcv/storage"
+)
+
+const defaultAuditRetentionDays = 365
+
+// audit records what the scheduler or an operator did,
+// the actor is the scheduler unless e already has one
+func audit(ctx context.Context, e storage.AuditEvent) {
+	if e.Actor == "" {
+		e.Actor = storage.ActorScheduler
+	}
+
+	if err := repo.AddAudit(context.WithoutCancel(ctx), &e); err != nil {
+		log.Printf("audit %s of %s: %v", e.Action, e.UserID, err)
+	}
+}
+
+// auditRetention reads AUDIT_RETENTION_DAYS, 0 keeps the audit log forever
+func auditRetention() (time.Duration, error) {
+	days := defaultAuditRetentionDays
+	if raw := os.Getenv("AUDIT_RETENTION_DAYS"); raw != "" {
+		var err error
+		if days, err = strconv.Atoi(raw); err != nil || days < 0 {
+			return 0, fmt.Errorf("bad AUDIT_RETENTION_DAYS %q", raw)
+		}
+	}
+
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+func pruneAudit(ctx context.Context) error {
+	retention, err := auditRetention()
+	if err != nil || retention == 0 {
+		return err
+	}
+
+	n, err := repo.PruneAudit(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("pruned %d audit events older than %s", n, retention)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"hhcv/storage"
+)
+
+const (
+	backupPrefix = "hhcv-"
+	backupLayout = "20060102-150405"
+)
+
+// adminBackup writes an online copy of the database into dir
+// and keeps the newest keep copies there
+func adminBackup(ctx context.Context, dir string, keep int) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, backupPrefix+time.Now().UTC().Format(backupLayout)+".db")
+	if err := repo.Backup(ctx, path); err != nil {
+		return err
+	}
+	fmt.Println("backup written to", path)
+
+	removed, err := rotateBackups(dir, keep)
+	for _, p := range removed {
+		fmt.Println("removed old backup", p)
+	}
+
+	return err
+}
+
+// names sort by time, everything but the last keep is removed
+func rotateBackups(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*.db"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) <= keep {
+		return nil, nil
+	}
+	sort.Strings(paths)
+
+	var removed []string
+	for _, p := range paths[:len(paths)-keep] {
+		if err := os.Remove(p); err != nil {
+			return removed, err
+		}
+		removed = append(removed, p)
+	}
+
+	return removed, nil
+}
+
+// adminExport writes a json dump to path, - is stdout. Tokens
+// go in sealed with EXPORT_KEY when withTokens is set
+func adminExport(ctx context.Context, path string, withTokens bool) error {
+	var dumpKey string
+	if withTokens {
+		if dumpKey = os.Getenv("EXPORT_KEY"); dumpKey == "" {
+			return fmt.Errorf("-tokens needs EXPORT_KEY")
+		}
+	}
+
+	dump, err := repo.Export(ctx, dumpKey)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		// dumps hold names and maybe tokens
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(dump); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(
+		os.Stderr, "exported %d users, %d tokens, %d resumes, %d runs, %d attempts, %d syncs, %d audit events, %d account links, %d negotiations, %d saved searches\n",
+		len(dump.Users), len(dump.Tokens), len(dump.Resumes), len(dump.Runs), len(dump.Attempts), len(dump.Syncs), len(dump.Audit), len(dump.Links), len(dump.Negotiations), len(dump.Searches),
+	)
+	return nil
+}
+
+// adminImport loads a dump written by export into an empty database,
+// tokens in it are opened with EXPORT_KEY
+func adminImport(ctx context.Context, path string) error {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var dump storage.Dump
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return fmt.Errorf("reading dump: %w", err)
+	}
+
+	if err := repo.Import(ctx, &dump, os.Getenv("EXPORT_KEY")); err != nil {
+		return err
+	}
+	audit(ctx, storage.AuditEvent{Actor: storage.ActorCLI, Action: storage.AuditDatabaseImport, Details: fmt.Sprintf("%d users from %s", len(dump.Users), path)})
+
+	fmt.Printf(
+		"imported %d users, %d tokens, %d resumes, %d runs, %d attempts, %d syncs, %d audit events, %d account links, %d negotiations, %d saved searches\n",
+		len(dump.Users), len(dump.Tokens), len(dump.Resumes), len(dump.Runs), len(dump.Attempts), len(dump.Syncs), len(dump.Audit), len(dump.Links), len(dump.Negotiations), len(dump.Searches),
+	)
+	return nil
+}
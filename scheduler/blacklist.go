@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"hhcv/hh"
+	"hhcv/storage"
+)
+
+// adminBlacklist adds or removes an employer when asked and prints
+// the blacklists of a user as hh has them now
+func adminBlacklist(ctx context.Context, client *http.Client, userID, resumeID, add, remove string, asJSON bool) error {
+	if add != "" || remove != "" {
+		employerID, action := add, storage.AuditBlacklistAdd
+		if remove != "" {
+			employerID, action = remove, storage.AuditBlacklistRemove
+		}
+		if _, err := repo.GetResume(ctx, userID, resumeID); err != nil {
+			return fmt.Errorf("resume %s: %w", resumeID, err)
+		}
+
+		err := hhClient(client).WithToken(ctx, userID, "changing a blacklist", func(at string) error {
+			return hh.ChangeBlacklist(ctx, client, at, resumeID, employerID, add != "")
+		})
+		if err != nil {
+			return err
+		}
+		audit(ctx, storage.AuditEvent{Actor: storage.ActorCLI, Action: action, UserID: userID, Target: resumeID, Details: "employer " + employerID})
+	}
+
+	resumes, err := repo.ListResumes(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if resumeID != "" {
+		var only []storage.Resume
+		for _, r := range resumes {
+			if r.ID == resumeID {
+				only = append(only, r)
+			}
+		}
+		resumes = only
+	}
+	if err := hhClient(client).RefreshBlacklists(ctx, userID, resumes); err != nil {
+		fmt.Fprintln(os.Stderr, "showing the last known blacklists:", err)
+	}
+
+	var all []storage.BlacklistedEmployer
+	var warnings []string
+	for _, r := range resumes {
+		employers, err := repo.ListBlacklist(ctx, userID, r.ID)
+		if err != nil {
+			return err
+		}
+		all = append(all, employers...)
+		if w := r.BlacklistWarning(len(employers)); w != "" {
+			warnings = append(warnings, fmt.Sprintf("%s %s: %s", r.ID, r.Title, w))
+		}
+	}
+
+	if asJSON {
+		return printJSON(all)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RESUME\tEMPLOYER\tNAME\tADDED")
+	for _, e := range all {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.ResumeID, e.EmployerID, e.Name, formatTime(e.AddedAt))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		fmt.Println("warning:", warning)
+	}
+
+	return nil
+}
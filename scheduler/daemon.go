@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"hhcv/storage"
+	"hhcv/timing"
+)
+
+// scheduleTimes are the fixed times and the zone they are in
+func scheduleTimes() ([]time.Duration, *time.Location, error) {
+	loc, err := timing.Location()
+	if err != nil {
+		return nil, nil, err
+	}
+	times, err := timing.FixedTimes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return times, loc, nil
+}
+
+func nextSlot(now time.Time, times []time.Duration, loc *time.Location) time.Time {
+	now = now.In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	for _, offset := range times {
+		if slot := day.Add(offset); slot.After(now) {
+			return slot
+		}
+	}
+
+	return day.AddDate(0, 0, 1).Add(times[0])
+}
+
+// runDaemon replaces the crontab entry for hosts that run the scheduler as a service
+func runDaemon(ctx context.Context, client *http.Client) error {
+	times, loc, err := scheduleTimes()
+	if err != nil {
+		return err
+	}
+
+	for {
+		now := time.Now()
+		next, trigger := nextSlot(now, times, loc), storage.TriggerDaemon
+		// a planned slot wakes the daemon for users in auto mode only
+		auto, err := repo.NextBumpSlot(ctx, now)
+		if err != nil {
+			log.Println("daemon: reading auto slots failed: ", err)
+		} else if !auto.IsZero() && auto.Before(next) {
+			next, trigger = auto, storage.TriggerAuto
+		}
+		log.Printf("daemon: next %s run at %s", trigger, next.In(loc).Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Println("daemon: shutting down")
+			return nil
+		case <-timer.C:
+		}
+
+		if _, err := runScheduler(ctx, client, trigger); err != nil {
+			log.Println("daemon: run failed: ", err)
+		}
+	}
+}
@@ -1,249 +1,161 @@
 package main
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"database/sql"
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"hhcv/hh"
+	"hhcv/storage"
 )
 
-var db *sql.DB
+var repo storage.Repository
 var err error
 
 func main() {
-	db, err = sql.Open("sqlite3", "./"+os.Getenv("DB_NAME"))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	repo, err = storage.Open(ctx, storage.ConfigFromEnv())
 	if err != nil {
 		log.Fatal("db err ", err)
 	}
+	defer repo.Close()
 
-	query := `
-	select users.id, tokens.access_token, tokens.refresh_token, resumes.id, resumes.title
-	from users
-	join tokens on users.id = tokens.user_id
-	join resumes on users.id = resumes.user_id;
-	`
-
-	type S struct {
-		UserID       string
-		AccessToken  string
-		RefreshToken string
-		ResumeID     string
-		ResumeTitle  string
-		Error        string
-		Timestamp    string
-	}
-
-	rows, err := db.Query(query)
-	if err != nil {
-		log.Fatal("db query err ", err)
+	client := &http.Client{Timeout: 15 * time.Second}
+	if u := os.Getenv("HH_API_URL"); u != "" {
+		hh.API = strings.TrimSuffix(u, "/")
 	}
 
-	var data []S
-	for rows.Next() {
-		var s S
-		var at, rt string
-		if err := rows.Scan(&s.UserID, &at, &rt, &s.ResumeID, &s.ResumeTitle); err != nil {
-			s.Error += err.Error()
+	// no arguments keeps the crontab entry working,
+	// anything else is a subcommand
+	if len(os.Args) == 1 {
+		if _, err := runScheduler(ctx, client, storage.TriggerCron); err != nil {
+			log.Fatal("scheduler: ", err)
 		}
-
-		s.AccessToken, err = Decrypt(at)
-		if err != nil {
-			s.Error += err.Error()
-		}
-		s.RefreshToken, err = Decrypt(at)
-		if err != nil {
-			s.Error += err.Error()
-		}
-
-		data = append(data, s)
+		return
 	}
 
-	client := &http.Client{Timeout: 15 * time.Second}
-	for _, u := range data {
-		timestamp, err := bump(client, u.AccessToken, u.RefreshToken, u.ResumeID, u.UserID)
-		if err != nil {
-			u.Error = err.Error()
-		}
-		u.Timestamp = timestamp
+	switch os.Args[1] {
+	case "-dry-run", "--dry-run":
+		err = printPlan(ctx, client, "", false)
+	case "run":
+		fs := flag.NewFlagSet("run", flag.ExitOnError)
+		dryRun := fs.Bool("dry-run", false, "print the plan instead of publishing")
+		fs.Parse(os.Args[2:])
 
-		_, err = db.Exec(
-			`insert into scheduler (user_id, resume_id, resume_title, timestamp, error) values (?, ?, ?, ?, ?)`,
-			u.UserID, u.ResumeID, u.ResumeTitle, u.Timestamp, u.Error,
-		)
-		if err != nil {
-			log.Println("err saving result" + err.Error())
+		if *dryRun {
+			err = printPlan(ctx, client, "", false)
+		} else {
+			_, err = runScheduler(ctx, client, storage.TriggerManual)
 		}
+	case "daemon":
+		err = runDaemon(ctx, client)
+	default:
+		err = runAdmin(ctx, client, os.Args[1], os.Args[2:])
 	}
-}
-
-func bump(client *http.Client, at, rt, rid, uid string) (string, error) {
-	url := fmt.Sprintf("https://api.hh.ru/resumes/%s/publish", rid)
-	req, err := http.NewRequest(http.MethodPost, url, nil)
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Add("HH-User-Agent", os.Getenv("HH_USER_AGENT"))
-	req.Header.Add("Authorization", "Bearer "+at)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
-	}
-
-	if resp.StatusCode != http.StatusNoContent {
-		raw := make(map[string]any)
-		if err := json.Unmarshal(body, &raw); err != nil {
-			return "", err
-		}
-		if message, ok := raw["oauth_error"]; ok {
-			if message == "token-expired" {
-				accessToken, refreshToken, err := refreshToken(client, rt)
-				if err != nil {
-					return "", err
-				}
-				if err = updateToken(db, accessToken, refreshToken, uid); err != nil {
-					return "", err
-				}
-				if _, err := bump(client, accessToken, refreshToken, rid, uid); err != nil {
-					return "", err
-				}
-			}
-		}
-		return "", fmt.Errorf("non 204 returned" + string(body))
+		log.Fatal(os.Args[1], ": ", err)
 	}
-
-	return time.Now().Format(time.RFC3339), nil
 }
 
-func updateToken(db *sql.DB, at, rt, uid string) error {
-	eat, err := Encrypt(at)
-	if err != nil {
-		return err
+func runScheduler(ctx context.Context, client *http.Client, trigger string) (*storage.Run, error) {
+	if err := pruneAudit(ctx); err != nil {
+		log.Println("pruning audit log failed: ", err)
 	}
 
-	ert, err := Encrypt(rt)
-	if err != nil {
-		return err
+	if err := syncBeforeRun(ctx, client); err != nil {
+		log.Println("sync before run failed: ", err)
 	}
 
-	query := `
-	update tokens 
-	set access_token = ?, refresh_token = ?
-	where user_id = ?
-	`
-
-	if _, err := db.Exec(query, eat, ert, uid); err != nil {
-		return err
+	if err := collectBeforeRun(ctx, client); err != nil {
+		log.Println("collecting from hh failed: ", err)
 	}
 
-	return nil
-}
-
-func refreshToken(client *http.Client, rt string) (string, string, error) {
-	type Token struct {
-		AccessToken  string `json:"access_token"`
-		TokenType    string `json:"token_type"`
-		RefreshToken string `json:"refresh_token"`
-		ExpiresIn    uint   `json:"expires_in"`
-	}
-
-	req, err := http.NewRequest("POST", "https://api.hh.ru/token", nil)
+	data, err := repo.ListDueResumes(ctx)
 	if err != nil {
-		return "", "", err
-	}
-
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("HH-User-Agent", "n0thingg@yandex.ru update-cv")
-
-	q := req.URL.Query()
-	q.Add("grant_type", "refresh_token")
-	q.Add("refresh_token", rt)
-	req.URL.RawQuery = q.Encode()
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", "", fmt.Errorf("bad status code getToken(): %d %s", resp.StatusCode, bodyBytes)
-	}
-
-	var token Token
-	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
-		return "", "", fmt.Errorf("failed to decode token response: %w", err)
+		return nil, err
 	}
 
-	return token.AccessToken, token.RefreshToken, nil
-
-}
-
-func Decrypt(encryptedString string) (string, error) {
-	data, err := base64.StdEncoding.DecodeString(encryptedString)
-	if err != nil {
-		return "", fmt.Errorf("could not decode base64: %w", err)
+	run := &storage.Run{Trigger: trigger, Version: binaryVersion()}
+	if err := repo.StartRun(ctx, run); err != nil {
+		return nil, err
 	}
 
-	block, err := aes.NewCipher([]byte(os.Getenv("ENCRYPTION_KEY")))
-	if err != nil {
-		return "", fmt.Errorf("could not create cipher block: %w", err)
-	}
+	// results of an interrupted run are still worth saving
+	saveCtx := context.WithoutCancel(ctx)
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("could not create GCM: %w", err)
-	}
+	for _, u := range data {
+		if ctx.Err() != nil {
+			log.Println("interrupted, skipping remaining resumes")
+			break
+		}
+		// users in auto mode wait for their slot, the rest for the fixed times,
+		// neither is an attempt worth recording
+		if (u.Auto && !u.SlotDue) || (!u.Auto && trigger == storage.TriggerAuto) {
+			continue
+		}
 
-	nonceSize := gcm.NonceSize()
-	if len(data) < nonceSize {
-		return "", fmt.Errorf("ciphertext too short (missing nonce)")
-	}
+		a := storage.Attempt{
+			RunID:       run.ID,
+			UserID:      u.UserID,
+			ResumeID:    u.ResumeID,
+			ResumeTitle: u.ResumeTitle,
+			Timestamp:   time.Now(),
+			Error:       u.Error,
+		}
 
-	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+		switch {
+		case u.Error != "":
+			a.Status = storage.AttemptSkipped
+			run.Skipped++
+		case u.SkipReason != "":
+			a.Status = storage.AttemptSkipped
+			a.Error = u.SkipReason
+			run.Skipped++
+		default:
+			if u.Warning != "" {
+				log.Printf("bumping %s of %s anyway: %s", u.ResumeID, u.UserID, u.Warning)
+			}
+			run.Attempted++
+			if err := bump(ctx, client, u.UserID, u.ResumeID); err != nil {
+				a.Status = storage.AttemptFailed
+				a.Error = err.Error()
+				run.Failed++
+				if errors.Is(err, errResumeNotFound) {
+					forgetResume(saveCtx, u.UserID, u.ResumeID, u.ResumeTitle)
+				}
+			} else {
+				a.Status = storage.AttemptOK
+				run.Succeeded++
+			}
+		}
 
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return "", fmt.Errorf("could not decrypt: %w", err)
+		if err := repo.AddAttempt(saveCtx, &a); err != nil {
+			log.Println("err saving result" + err.Error())
+		}
 	}
 
-	return string(plaintext), nil
-}
-
-func Encrypt(plaintext string) (string, error) {
-	block, err := aes.NewCipher([]byte(os.Getenv("ENCRYPTION_KEY")))
-	if err != nil {
-		return "", fmt.Errorf("could not create cipher block: %w", err)
+	if err := repo.FinishRun(saveCtx, run); err != nil {
+		return run, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("could not create GCM: %w", err)
+	if err := replanAuto(saveCtx); err != nil {
+		log.Println("planning auto slots failed: ", err)
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", fmt.Errorf("could not generate nonce: %w", err)
-	}
+	log.Printf(
+		"run %d (%s): %d attempted, %d succeeded, %d skipped, %d failed",
+		run.ID, run.Trigger, run.Attempted, run.Succeeded, run.Skipped, run.Failed,
+	)
 
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return run, nil
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"hhcv/storage"
+)
+
+// syncMatches fetches vacancies similar to every resume of a user,
+// it returns how many came up for the first time per resume
+func syncMatches(ctx context.Context, client *http.Client, userID string) (map[string]int, error) {
+	resumes, err := repo.ListResumes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	added := make(map[string]int, len(resumes))
+	for _, r := range resumes {
+		if ctx.Err() != nil {
+			return added, ctx.Err()
+		}
+
+		var vacancies []Vacancy
+		err := hhClient(client).WithToken(ctx, userID, "collecting matches", func(at string) (err error) {
+			vacancies, err = HHGetSimilarVacancies(ctx, client, at, r.ID)
+			return err
+		})
+		if err != nil {
+			return added, fmt.Errorf("resume %s: %w", r.ID, err)
+		}
+
+		matches := make([]storage.Match, 0, len(vacancies))
+		for _, v := range vacancies {
+			matches = append(matches, v.toMatch())
+		}
+
+		if added[r.ID], err = repo.SaveMatches(ctx, userID, r.ID, matches); err != nil {
+			return added, fmt.Errorf("resume %s: %w", r.ID, err)
+		}
+	}
+
+	return added, nil
+}
+
+func collectMatches(ctx context.Context, client *http.Client, userIDs []string) int {
+	var failed int
+	for _, uid := range userIDs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if _, err := syncMatches(ctx, client, uid); err != nil {
+			log.Printf("matches %s: %v", uid, err)
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// adminMatches collects matches of one user, or of everyone when
+// userID is empty, and prints how many are new per resume
+func adminMatches(ctx context.Context, client *http.Client, userID string) error {
+	userIDs := []string{userID}
+	if userID == "" {
+		var err error
+		if userIDs, err = activeUserIDs(ctx); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tRESUME\tNEW")
+
+	var failed int
+	for _, uid := range userIDs {
+		added, err := syncMatches(ctx, client, uid)
+		for resumeID, n := range added {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", uid, resumeID, n)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "%s\t-\t%s\n", uid, err)
+			failed++
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d users failed to collect", failed, len(userIDs))
+	}
+
+	return nil
+}
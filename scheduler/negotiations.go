@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"hhcv/storage"
+)
+
+// syncNegotiations stores what hh reports about applications of a user and
+// returns the ones that moved, first tells whether any were stored before
+func syncNegotiations(ctx context.Context, client *http.Client, userID string) (changes []storage.NegotiationChange, first bool, err error) {
+	var negotiations []Negotiation
+	err = hhClient(client).WithToken(ctx, userID, "collecting negotiations", func(at string) (err error) {
+		negotiations, err = HHGetNegotiations(ctx, client, at)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	stored, err := repo.ListNegotiations(ctx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	converted := make([]storage.Negotiation, 0, len(negotiations))
+	for _, n := range negotiations {
+		converted = append(converted, n.toStorage())
+	}
+
+	changes, err = repo.SaveNegotiations(ctx, userID, converted)
+	return changes, len(stored) == 0, err
+}
+
+// notifyInvitations tells users about invitations, not on the first
+// collection though, old invitations there are not news
+func notifyInvitations(ctx context.Context, userID string, changes []storage.NegotiationChange) {
+	for _, c := range changes {
+		if c.To != storage.StageInvited {
+			continue
+		}
+
+		n := storage.Notification{
+			UserID: userID,
+			Kind:   storage.NotifyInvitation,
+			Text:   fmt.Sprintf("Invitation: %s", c.VacancyName),
+			URL:    "/applications",
+		}
+		if err := repo.AddNotification(ctx, &n); err != nil {
+			log.Printf("notify %s of invitation %s: %v", userID, c.NegotiationID, err)
+		}
+	}
+}
+
+// collectNegotiations syncs negotiations of every active user, failures
+// are logged per user and do not stop the others
+func collectNegotiations(ctx context.Context, client *http.Client, userIDs []string) int {
+	saveCtx := context.WithoutCancel(ctx)
+
+	var failed int
+	for _, uid := range userIDs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		changes, first, err := syncNegotiations(ctx, client, uid)
+		if err != nil {
+			log.Printf("negotiations %s: %v", uid, err)
+			failed++
+			continue
+		}
+		if len(changes) > 0 {
+			log.Printf("negotiations %s: %d changed", uid, len(changes))
+		}
+		if !first {
+			notifyInvitations(saveCtx, uid, changes)
+		}
+	}
+
+	return failed
+}
+
+// adminNegotiations collects negotiations of one user, or of
+// everyone when userID is empty, and prints what changed
+func adminNegotiations(ctx context.Context, client *http.Client, userID string) error {
+	userIDs := []string{userID}
+	if userID == "" {
+		var err error
+		if userIDs, err = activeUserIDs(ctx); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tNEGOTIATION\tVACANCY\tFROM\tTO")
+
+	var failed int
+	for _, uid := range userIDs {
+		changes, first, err := syncNegotiations(ctx, client, uid)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t-\t%s\t\t\n", uid, err)
+			failed++
+			continue
+		}
+		if !first {
+			notifyInvitations(ctx, uid, changes)
+		}
+
+		for _, c := range changes {
+			from := c.From
+			if from == "" {
+				from = "new"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", uid, c.NegotiationID, c.VacancyName, from, c.To)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d users failed to collect", failed, len(userIDs))
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"hhcv/hh"
+	"hhcv/storage"
+)
+
+const (
+	actionPublish        = "publish"
+	actionRefreshPublish = "refresh token, publish"
+	actionSkip           = "skip"
+)
+
+type PlanEntry struct {
+	UserID      string `json:"user_id"`
+	ResumeID    string `json:"resume_id"`
+	ResumeTitle string `json:"resume_title"`
+	Token       string `json:"token"`
+	Eligible    string `json:"eligible"`
+	Action      string `json:"action"`
+}
+
+// buildPlan works out what runScheduler would do right now. It only reads:
+// resumes are fetched from hh to see if they can be published, tokens are never refreshed
+// and nothing is written to the database
+func buildPlan(ctx context.Context, client *http.Client, userID string) ([]PlanEntry, error) {
+	due, err := repo.ListDueResumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type userState struct {
+		token   string
+		resumes map[string]hh.Resume
+		err     error
+	}
+	users := make(map[string]*userState)
+
+	var plan []PlanEntry
+	for _, d := range due {
+		if userID != "" && d.UserID != userID {
+			continue
+		}
+
+		entry := PlanEntry{
+			UserID:      d.UserID,
+			ResumeID:    d.ResumeID,
+			ResumeTitle: d.ResumeTitle,
+		}
+
+		if d.Error != "" {
+			entry.Token = "unreadable: " + d.Error
+			entry.Eligible = "unknown"
+			entry.Action = actionSkip
+			plan = append(plan, entry)
+			continue
+		}
+		if d.SkipReason != "" {
+			entry.Token = describeExpiry(d.Token)
+			entry.Eligible = "no, " + d.SkipReason
+			entry.Action = actionSkip
+			plan = append(plan, entry)
+			continue
+		}
+		if d.Auto && !d.SlotDue {
+			entry.Token = describeExpiry(d.Token)
+			entry.Eligible = describeWait(ctx, d.UserID)
+			entry.Action = actionSkip
+			plan = append(plan, entry)
+			continue
+		}
+
+		state, ok := users[d.UserID]
+		if !ok {
+			state = &userState{token: describeExpiry(d.Token)}
+			var hhr []hh.Resume
+			if hhr, state.err = hh.GetResumes(ctx, client, d.Token.AccessToken); state.err == nil {
+				state.resumes = make(map[string]hh.Resume, len(hhr))
+				for _, r := range hhr {
+					state.resumes[r.ID] = r
+				}
+			}
+			users[d.UserID] = state
+		}
+
+		entry.Token = state.token
+		entry.Action = actionPublish
+
+		switch {
+		case errors.Is(state.err, hh.ErrTokenExpired):
+			entry.Token = "expired"
+			entry.Eligible = "unknown until refreshed"
+			entry.Action = actionRefreshPublish
+		case state.err != nil:
+			entry.Token = "rejected by hh"
+			entry.Eligible = "unknown: " + state.err.Error()
+		default:
+			entry.Eligible = describeEligibility(state.resumes, d.ResumeID)
+		}
+		if d.Warning != "" {
+			entry.Eligible += ", warning: " + d.Warning
+		}
+
+		plan = append(plan, entry)
+	}
+
+	return plan, nil
+}
+
+func describeExpiry(t storage.Token) string {
+	expiresAt, ok := t.ExpiresAt()
+	if !ok {
+		return "valid, expiry unknown"
+	}
+	if time.Now().After(expiresAt) {
+		return "expired at " + expiresAt.Format(time.RFC3339)
+	}
+
+	return "valid until " + expiresAt.Format(time.RFC3339)
+}
+
+// describeWait tells when a user in auto mode is bumped next
+func describeWait(ctx context.Context, userID string) string {
+	slots, err := repo.ListBumpSlots(ctx, userID)
+	if err != nil || len(slots) == 0 {
+		return "waiting for an auto slot"
+	}
+
+	return "waiting for the auto slot at " + slots[0].At.Format(time.RFC3339)
+}
+
+func describeEligibility(resumes map[string]hh.Resume, resumeID string) string {
+	r, ok := resumes[resumeID]
+	switch {
+	case !ok:
+		return "no, not found on hh"
+	case r.CanPublishOrUpdate:
+		return "yes"
+	case r.NextPublishAt != nil:
+		return "no, next publish at " + formatTime(time.Time(*r.NextPublishAt))
+	default:
+		return "no"
+	}
+}
+
+func printPlan(ctx context.Context, client *http.Client, userID string, asJSON bool) error {
+	plan, err := buildPlan(ctx, client, userID)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return printJSON(plan)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tRESUME\tTITLE\tTOKEN\tELIGIBLE\tACTION")
+	for _, p := range plan {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", p.UserID, p.ResumeID, p.ResumeTitle, p.Token, p.Eligible, p.Action)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d resumes due, dry run: nothing was published or recorded\n", len(plan))
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"hhcv/quality"
+)
+
+type QualityEntry struct {
+	ResumeID    string         `json:"resume_id"`
+	ResumeTitle string         `json:"resume_title"`
+	Report      quality.Report `json:"report"`
+}
+
+// adminQuality scores resumes of a user by their latest snapshots
+func adminQuality(ctx context.Context, userID string, asJSON bool) error {
+	resumes, err := repo.ListResumes(ctx, userID)
+	if err != nil {
+		return err
+	}
+	snaps, err := repo.LatestResumeSnapshots(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	var entries []QualityEntry
+	for _, r := range resumes {
+		snap, ok := snaps[r.ID]
+		if !ok {
+			continue
+		}
+		parsed, err := quality.Parse([]byte(snap.Data))
+		if err != nil {
+			return fmt.Errorf("snapshot %d of resume %s: %w", snap.ID, r.ID, err)
+		}
+		entries = append(entries, QualityEntry{ResumeID: r.ID, ResumeTitle: r.Title, Report: quality.Evaluate(parsed, quality.Rules, time.Now())})
+	}
+
+	if asJSON {
+		return printJSON(entries)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RESUME\tTITLE\tSCORE\tHINT")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%d\t\n", e.ResumeID, e.ResumeTitle, e.Report.Score)
+		for _, h := range e.Report.Hints {
+			fmt.Fprintf(w, "\t\t\t%s\n", h.Text)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(entries) < len(resumes) {
+		fmt.Printf("\n%d resumes have no snapshot yet, sync them first\n", len(resumes)-len(entries))
+	}
+
+	return nil
+}
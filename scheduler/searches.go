@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"hhcv/storage"
+)
+
+// searchParams turns a saved search into hh search query params
+func searchParams(s storage.SavedSearch) url.Values {
+	params := url.Values{}
+	if s.Text != "" {
+		params.Set("text", s.Text)
+	}
+	if s.Area != "" {
+		params.Set("area", s.Area)
+	}
+	if s.Salary > 0 {
+		params.Set("salary", strconv.Itoa(s.Salary))
+		params.Set("only_with_salary", "true")
+	}
+	if s.Experience != "" {
+		params.Set("experience", s.Experience)
+	}
+	if s.Schedule != "" {
+		params.Set("schedule", s.Schedule)
+	}
+
+	return params
+}
+
+// runSearch stores what a search finds and notifies about new results,
+// the first run of a search only fills it up
+func runSearch(ctx context.Context, client *http.Client, s storage.SavedSearch) (int, error) {
+	vacancies, err := HHSearchVacancies(ctx, client, searchParams(s))
+	if err != nil {
+		if err := repo.SetSearchError(context.WithoutCancel(ctx), s.ID, err.Error()); err != nil {
+			log.Printf("search %d: could not record error: %v", s.ID, err)
+		}
+		return 0, err
+	}
+
+	results := make([]storage.SearchResult, 0, len(vacancies))
+	for _, v := range vacancies {
+		results = append(results, v.toSearchResult())
+	}
+
+	added, err := repo.SaveSearchResults(ctx, s.ID, results)
+	if err != nil {
+		return 0, err
+	}
+
+	if added > 0 && !s.LastRunAt.IsZero() {
+		n := storage.Notification{
+			UserID: s.UserID,
+			Kind:   storage.NotifySearch,
+			Text:   fmt.Sprintf("%d new vacancies for %s", added, s.Name),
+			URL:    fmt.Sprintf("/searches/%d", s.ID),
+		}
+		if err := repo.AddNotification(ctx, &n); err != nil {
+			log.Printf("notify %s of search %d: %v", s.UserID, s.ID, err)
+		}
+	}
+
+	return added, nil
+}
+
+// syncSearches runs every saved search of a user and returns how many
+// results each one added, a failed search does not stop the others
+func syncSearches(ctx context.Context, client *http.Client, userID string) (map[int64]int, []storage.SavedSearch, error) {
+	searches, err := repo.ListSearches(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	added := make(map[int64]int, len(searches))
+	var failed int
+	for _, s := range searches {
+		if ctx.Err() != nil {
+			return added, searches, ctx.Err()
+		}
+
+		n, err := runSearch(ctx, client, s)
+		if err != nil {
+			log.Printf("search %d of %s: %v", s.ID, userID, err)
+			failed++
+			continue
+		}
+		added[s.ID] = n
+	}
+
+	if failed > 0 {
+		return added, searches, fmt.Errorf("%d of %d searches failed", failed, len(searches))
+	}
+
+	return added, searches, nil
+}
+
+func collectSearches(ctx context.Context, client *http.Client, userIDs []string) int {
+	var failed int
+	for _, uid := range userIDs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if _, _, err := syncSearches(ctx, client, uid); err != nil {
+			log.Printf("searches %s: %v", uid, err)
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// adminSearches runs saved searches of one user, or of everyone when
+// userID is empty, and prints how many results are new per search
+func adminSearches(ctx context.Context, client *http.Client, userID string) error {
+	userIDs := []string{userID}
+	if userID == "" {
+		var err error
+		if userIDs, err = activeUserIDs(ctx); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tSEARCH\tNAME\tNEW")
+
+	var failed int
+	for _, uid := range userIDs {
+		added, searches, err := syncSearches(ctx, client, uid)
+		for _, s := range searches {
+			if n, ok := added[s.ID]; ok {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%d\n", uid, s.ID, s.Name, n)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(w, "%s\t-\t-\t%s\n", uid, err)
+			failed++
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d users failed to run searches", failed, len(userIDs))
+	}
+
+	return nil
+}
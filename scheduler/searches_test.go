@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"hhcv/hh"
+	"hhcv/storage"
+)
+
+// vacancyStub serves ids as /vacancies does, pageSize a page,
+// and records the query of every request
+type vacancyStub struct {
+	mu       sync.Mutex
+	ids      []string
+	pageSize int
+	fail     bool
+	queries  []string
+}
+
+func (s *vacancyStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path != "/vacancies" {
+		http.NotFound(w, r)
+		return
+	}
+	s.queries = append(s.queries, r.URL.RawQuery)
+	if s.fail {
+		http.Error(w, `{"errors":[{"type":"server"}]}`, http.StatusBadGateway)
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pages := (len(s.ids) + s.pageSize - 1) / s.pageSize
+	var items []string
+	for i := page * s.pageSize; i < (page+1)*s.pageSize && i < len(s.ids); i++ {
+		id := s.ids[i]
+		items = append(items, fmt.Sprintf(
+			`{"id":%q,"name":"Go developer %s","alternate_url":"https://hh.ru/vacancy/%s","published_at":"2026-10-18T10:00:00+0300","employer":{"id":"e%s","name":"Employer %s"},"area":{"name":"Moscow"}}`,
+			id, id, id, id, id,
+		))
+	}
+	fmt.Fprintf(w, `{"items":[%s],"found":%d,"pages":%d,"page":%d}`, strings.Join(items, ","), len(s.ids), pages, page)
+}
+
+// set replaces the vacancies and forgets earlier queries
+func (s *vacancyStub) set(fail bool, ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail, s.ids, s.queries = fail, ids, nil
+}
+
+func (s *vacancyStub) asked() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+// withStub points hh.API at stub and repo at an empty sqlite database
+func withStub(t *testing.T, stub http.Handler) *http.Client {
+	t.Helper()
+	t.Setenv("ENCRYPTION_KEY", "0123456789abcdef0123456789abcdef")
+
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+
+	oldAPI, oldRepo := hh.API, repo
+	t.Cleanup(func() { hh.API, repo = oldAPI, oldRepo })
+	hh.API = srv.URL
+
+	cfg := storage.Config{Driver: storage.DriverSQLite, DSN: filepath.Join(t.TempDir(), "db.sqlite")}
+	r, err := storage.Open(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	repo = r
+
+	return srv.Client()
+}
+
+func newSearch(t *testing.T) storage.SavedSearch {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := repo.UpsertUser(ctx, &storage.User{ID: "u1", FirstName: "Ivan"}); err != nil {
+		t.Fatal(err)
+	}
+	s := storage.SavedSearch{UserID: "u1", Name: "Go in Moscow", Text: "golang", Area: "1", Salary: 200000}
+	if err := repo.CreateSearch(ctx, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// reload reads the search back, runSearch tells the first run by LastRunAt
+func reload(t *testing.T, s storage.SavedSearch) storage.SavedSearch {
+	t.Helper()
+
+	got, err := repo.GetSearch(context.Background(), s.UserID, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *got
+}
+
+func TestSearchParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		search storage.SavedSearch
+		want   string
+	}{
+		{"text only", storage.SavedSearch{Text: "golang"}, "text=golang"},
+		{"salary asks for a salary", storage.SavedSearch{Salary: 150000}, "only_with_salary=true&salary=150000"},
+		{
+			"everything",
+			storage.SavedSearch{Text: "go", Area: "2", Salary: 1, Experience: "between3And6", Schedule: "remote"},
+			"area=2&experience=between3And6&only_with_salary=true&salary=1&schedule=remote&text=go",
+		},
+		{"nothing", storage.SavedSearch{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchParams(tt.search).Encode(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSearchPages(t *testing.T) {
+	stub := &vacancyStub{pageSize: 2}
+	client := withStub(t, stub)
+	ctx := context.Background()
+	s := newSearch(t)
+
+	stub.set(false, "v1", "v2", "v3", "v4", "v5")
+	added, err := runSearch(ctx, client, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 5 {
+		t.Errorf("first run added %d, want 5", added)
+	}
+
+	queries := stub.asked()
+	if len(queries) != 3 {
+		t.Fatalf("first run asked %d pages, want 3: %v", len(queries), queries)
+	}
+	for i, raw := range queries {
+		for _, want := range []string{"text=golang", "area=1", "salary=200000", "order_by=publication_time", fmt.Sprintf("page=%d", i)} {
+			if !strings.Contains(raw, want) {
+				t.Errorf("query %d %q has no %s", i, raw, want)
+			}
+		}
+	}
+
+	results, err := repo.ListSearchResults(ctx, s.UserID, s.ID, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 5 {
+		t.Errorf("stored %d results, want 5", len(results))
+	}
+}
+
+func TestRunSearchPageLimit(t *testing.T) {
+	stub := &vacancyStub{pageSize: 1}
+	client := withStub(t, stub)
+	s := newSearch(t)
+
+	var ids []string
+	for i := 0; i < maxSearchPages+3; i++ {
+		ids = append(ids, fmt.Sprintf("v%d", i))
+	}
+	stub.set(false, ids...)
+
+	added, err := runSearch(context.Background(), client, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asked := len(stub.asked()); added != maxSearchPages || asked != maxSearchPages {
+		t.Errorf("added %d in %d requests, want %d in %d", added, asked, maxSearchPages, maxSearchPages)
+	}
+}
+
+func TestRunSearchNewResults(t *testing.T) {
+	stub := &vacancyStub{pageSize: 2}
+	client := withStub(t, stub)
+	ctx := context.Background()
+	s := newSearch(t)
+
+	// the first run only fills the search up
+	stub.set(false, "v1", "v2", "v3")
+	if _, err := runSearch(ctx, client, s); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := repo.CountUnreadNotifications(ctx, s.UserID); err != nil || n != 0 {
+		t.Fatalf("notifications after the first run: %d, %v", n, err)
+	}
+
+	tests := []struct {
+		name      string
+		ids       []string
+		wantAdded int
+		wantNotes int
+	}{
+		{"nothing new", []string{"v1", "v2", "v3"}, 0, 0},
+		{"new ones on top push seen ones to the next page", []string{"v5", "v4", "v1", "v2", "v3"}, 2, 1},
+		{"seen ones are not found again", []string{"v5", "v4", "v1"}, 0, 1},
+		{"one more", []string{"v6", "v5", "v4"}, 1, 2},
+	}
+
+	for _, tt := range tests {
+		stub.set(false, tt.ids...)
+		added, err := runSearch(ctx, client, reload(t, s))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if added != tt.wantAdded {
+			t.Errorf("%s: added %d, want %d", tt.name, added, tt.wantAdded)
+		}
+		if n, err := repo.CountUnreadNotifications(ctx, s.UserID); err != nil || n != tt.wantNotes {
+			t.Errorf("%s: %d notifications, want %d (%v)", tt.name, n, tt.wantNotes, err)
+		}
+	}
+
+	notes, err := repo.ListNotifications(ctx, s.UserID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) == 0 || notes[0].Kind != storage.NotifySearch || notes[0].Text != "1 new vacancies for Go in Moscow" {
+		t.Errorf("latest notification: got %+v", notes)
+	}
+
+	results, err := repo.ListSearchResults(ctx, s.UserID, s.ID, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 6 {
+		t.Errorf("stored %d results, want 6", len(results))
+	}
+}
+
+func TestRunSearchError(t *testing.T) {
+	stub := &vacancyStub{pageSize: 2}
+	client := withStub(t, stub)
+	s := newSearch(t)
+	stub.set(true)
+
+	if _, err := runSearch(context.Background(), client, s); err == nil {
+		t.Fatal("no error from a failing search")
+	}
+	if got := reload(t, s); !strings.Contains(got.LastError, "502") || got.LastRunAt.IsZero() {
+		t.Errorf("failed search: got %+v", got)
+	}
+
+	// a run that works again clears the error
+	stub.set(false, "v1")
+	if _, err := runSearch(context.Background(), client, reload(t, s)); err != nil {
+		t.Fatal(err)
+	}
+	if got := reload(t, s); got.LastError != "" {
+		t.Errorf("error after a run that worked: %q", got.LastError)
+	}
+}
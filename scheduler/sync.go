@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"hhcv/hh"
+	"hhcv/storage"
+)
+
+const defaultSyncIntervalHours = 12
+
+// hhClient calls hh with client on behalf of the users in repo
+func hhClient(client *http.Client) *hh.Client {
+	return &hh.Client{HTTP: client, Store: repo, Audit: audit}
+}
+
+// syncResumes syncs every user in userIDs and records the ones
+// that changed or failed
+func syncResumes(ctx context.Context, client *http.Client, userIDs []string, source string) []storage.ResumeSync {
+	saveCtx := context.WithoutCancel(ctx)
+
+	var syncs []storage.ResumeSync
+	for _, uid := range userIDs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		rs := storage.ResumeSync{UserID: uid, Timestamp: time.Now(), Source: source}
+		diff, err := hhClient(client).SyncUser(ctx, uid)
+		rs.Changes = diff
+		if err != nil {
+			rs.Error = err.Error()
+		}
+
+		if err := hh.RecordSync(saveCtx, repo, &rs); err != nil {
+			log.Printf("sync %s: %v", uid, err)
+		}
+		if source == storage.SyncManual {
+			details := diff.String()
+			if rs.Error != "" {
+				details = rs.Error
+			}
+			audit(ctx, storage.AuditEvent{Actor: storage.ActorCLI, Action: storage.AuditResumesSync, UserID: uid, Details: details})
+		}
+		syncs = append(syncs, rs)
+	}
+
+	return syncs
+}
+
+// activeUsers lists users that are not disabled and have a token that
+// decrypts, calls to hh for the others fail until they log in again
+func activeUsers(ctx context.Context) ([]storage.UserSummary, error) {
+	users, err := repo.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var active []storage.UserSummary
+	for _, u := range users {
+		switch {
+		case u.IsDisabled:
+		case u.TokenStatus != storage.TokenOK:
+			log.Printf("skipping %s, token is %s", u.ID, u.TokenStatus)
+		default:
+			active = append(active, u)
+		}
+	}
+
+	return active, nil
+}
+
+func activeUserIDs(ctx context.Context) ([]string, error) {
+	users, err := activeUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]string, 0, len(users))
+	for _, u := range users {
+		userIDs = append(userIDs, u.ID)
+	}
+
+	return userIDs, nil
+}
+
+// syncInterval reads SYNC_INTERVAL_HOURS, 0 syncs before every run
+func syncInterval() (time.Duration, error) {
+	hours := defaultSyncIntervalHours
+	if raw := os.Getenv("SYNC_INTERVAL_HOURS"); raw != "" {
+		var err error
+		if hours, err = strconv.Atoi(raw); err != nil || hours < 0 {
+			return 0, fmt.Errorf("bad SYNC_INTERVAL_HOURS %q", raw)
+		}
+	}
+
+	return time.Duration(hours) * time.Hour, nil
+}
+
+// syncBeforeRun picks up resumes created, renamed or deleted on hh for
+// users not synced within syncInterval, failed syncs are tried again next run.
+// Resumes deleted in between are forgotten when publishing them gets a 404
+func syncBeforeRun(ctx context.Context, client *http.Client) error {
+	interval, err := syncInterval()
+	if err != nil {
+		return err
+	}
+
+	users, err := activeUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	var userIDs []string
+	for _, u := range users {
+		if time.Since(u.SyncedAt) >= interval {
+			userIDs = append(userIDs, u.ID)
+		}
+	}
+	if skipped := len(users) - len(userIDs); skipped > 0 {
+		log.Printf("%d users synced within %s, not syncing them", skipped, interval)
+	}
+
+	for _, rs := range syncResumes(ctx, client, userIDs, storage.SyncJob) {
+		switch {
+		case rs.Error != "":
+			log.Printf("sync %s: %s", rs.UserID, rs.Error)
+		case !rs.Changes.IsEmpty():
+			log.Printf("sync %s: %s", rs.UserID, rs.Changes)
+		}
+	}
+
+	return nil
+}
+
+// collectBeforeRun refreshes applications, matching vacancies and resume views,
+// a user failing one of them does not stop the others
+func collectBeforeRun(ctx context.Context, client *http.Client) error {
+	userIDs, err := activeUserIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := collectNegotiations(ctx, client, userIDs)
+	failed += collectMatches(ctx, client, userIDs)
+	failed += collectSearches(ctx, client, userIDs)
+	failed += collectViews(ctx, client, userIDs)
+	if failed > 0 {
+		return fmt.Errorf("%d collections failed", failed)
+	}
+
+	return nil
+}
+
+// forgetResume removes a resume hh no longer has, found out when publishing it
+func forgetResume(ctx context.Context, userID, resumeID, title string) {
+	if err := repo.DeleteResumes(ctx, userID, []string{resumeID}); err != nil {
+		log.Printf("could not remove resume %s of %s: %v", resumeID, userID, err)
+		return
+	}
+
+	audit(ctx, storage.AuditEvent{Action: storage.AuditResumeRemove, UserID: userID, Target: resumeID, Details: "hh answered 404 on publish"})
+
+	rs := storage.ResumeSync{
+		UserID:    userID,
+		Timestamp: time.Now(),
+		Source:    storage.SyncPublish,
+		Changes:   storage.ResumeDiff{Removed: []string{title}},
+	}
+	if err := repo.AddResumeSync(ctx, &rs); err != nil {
+		log.Println("err saving resume sync ", err)
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import "runtime/debug"
+
+// set at build time with -ldflags "-X main.version=..."
+var version string
+
+func binaryVersion() string {
+	if version != "" {
+		return version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+			return s.Value[:12]
+		}
+	}
+
+	return "dev"
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"hhcv/storage"
+	"hhcv/timing"
+)
+
+// syncViews stores views of every resume of a user hh still lists
+// and returns how many were not seen before
+func syncViews(ctx context.Context, client *http.Client, userID string) (int, error) {
+	resumes, err := repo.ListResumes(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var added int
+	var errs []error
+	for _, r := range resumes {
+		if ctx.Err() != nil {
+			return added, ctx.Err()
+		}
+
+		var views []View
+		err := hhClient(client).WithToken(ctx, userID, "collecting views", func(at string) (err error) {
+			views, err = HHGetResumeViews(ctx, client, at, r.ID)
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resume %s: %w", r.ID, err))
+			continue
+		}
+
+		converted := make([]storage.ResumeView, 0, len(views))
+		for _, v := range views {
+			converted = append(converted, v.toStorage(userID, r.ID))
+		}
+		n, err := repo.SaveResumeViews(ctx, userID, r.ID, converted)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resume %s: %w", r.ID, err))
+		}
+		added += n
+	}
+
+	return added, errors.Join(errs...)
+}
+
+// collectViews stores resume views of every active user, failures
+// are logged per user and do not stop the others
+func collectViews(ctx context.Context, client *http.Client, userIDs []string) int {
+	var failed int
+	for _, uid := range userIDs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		added, err := syncViews(ctx, client, uid)
+		if err != nil {
+			log.Printf("views %s: %v", uid, err)
+			failed++
+		}
+		if added > 0 {
+			log.Printf("views %s: %d new", uid, added)
+		}
+	}
+
+	return failed
+}
+
+// replanAuto plans the next slots of every active user in auto mode,
+// a user whose planning fails is left without slots and so falls
+// back to the fixed times
+func replanAuto(ctx context.Context) error {
+	loc, err := timing.Location()
+	if err != nil {
+		return err
+	}
+	users, err := repo.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, u := range users {
+		if u.IsDisabled || u.ScheduleMode != storage.ScheduleAuto {
+			continue
+		}
+
+		slots, note, err := timing.Replan(ctx, repo, u.ID, time.Now(), u.Location(loc))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", u.ID, err))
+			if err := repo.ReplaceBumpSlots(ctx, u.ID, nil); err != nil {
+				log.Printf("clearing slots of %s: %v", u.ID, err)
+			}
+			continue
+		}
+		log.Printf("slots %s: %d planned, %s", u.ID, len(slots), note)
+	}
+
+	return errors.Join(errs...)
+}
+
+// adminSlots switches the schedule mode of a user when asked, collects
+// their views and prints the slots planned from them with the reasons
+func adminSlots(ctx context.Context, client *http.Client, userID, mode string, asJSON bool) error {
+	user, err := repo.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if mode != "" && mode != user.ScheduleMode {
+		if err := repo.SetScheduleMode(ctx, userID, mode); err != nil {
+			return err
+		}
+		audit(ctx, storage.AuditEvent{Actor: storage.ActorCLI, Action: storage.AuditScheduleMode, UserID: userID, Details: user.ScheduleMode + " -> " + mode})
+		user.ScheduleMode = mode
+	}
+
+	if _, err := syncViews(ctx, client, userID); err != nil {
+		fmt.Fprintln(os.Stderr, "planning from the views collected before:", err)
+	}
+
+	loc, err := timing.Location()
+	if err != nil {
+		return err
+	}
+	loc = user.Location(loc)
+
+	var slots []storage.BumpSlot
+	var note string
+	if user.ScheduleMode == storage.ScheduleAuto {
+		if slots, note, err = timing.Replan(ctx, repo, userID, time.Now(), loc); err != nil {
+			return err
+		}
+	} else {
+		note = "fixed mode, bumped at SCHEDULE_TIMES"
+	}
+
+	if asJSON {
+		return printJSON(slots)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLOT\tREASON")
+	for _, s := range slots {
+		fmt.Fprintf(w, "%s\t%s\n", s.At.In(loc).Format(time.RFC3339), s.Reason)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%s: %s\n", user.ScheduleMode, note)
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (s *sqlStore) CreateCoverLetter(ctx context.Context, l *CoverLetter) error {
+	if l.CreatedAt.IsZero() {
+		l.CreatedAt = time.Now()
+	}
+
+	return s.retry(ctx, func() error {
+		return s.queryRow(
+			ctx,
+			`insert into cover_letters (user_id, name, body, created_at) values (?, ?, ?, ?) returning id`,
+			l.UserID, l.Name, l.Body, formatTime(l.CreatedAt),
+		).Scan(&l.ID)
+	})
+}
+
+func scanCoverLetters(rows *sql.Rows) ([]CoverLetter, error) {
+	var letters []CoverLetter
+	for rows.Next() {
+		var l CoverLetter
+		var createdAt string
+		if err := rows.Scan(&l.ID, &l.UserID, &l.Name, &l.Body, &createdAt); err != nil {
+			return nil, err
+		}
+		l.CreatedAt = parseTime(createdAt)
+		letters = append(letters, l)
+	}
+
+	return letters, rows.Err()
+}
+
+func (s *sqlStore) ListCoverLetters(ctx context.Context, userID string) ([]CoverLetter, error) {
+	rows, err := s.query(ctx, `
+	select id, user_id, name, body, created_at
+	from cover_letters
+	where user_id = ?
+	order by name, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanCoverLetters(rows)
+}
+
+func (s *sqlStore) GetCoverLetter(ctx context.Context, userID string, letterID int64) (*CoverLetter, error) {
+	var l CoverLetter
+	var createdAt string
+	err := s.queryRow(
+		ctx,
+		`select id, user_id, name, body, created_at from cover_letters where id = ? and user_id = ?`,
+		letterID, userID,
+	).Scan(&l.ID, &l.UserID, &l.Name, &l.Body, &createdAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	l.CreatedAt = parseTime(createdAt)
+
+	return &l, nil
+}
+
+func (s *sqlStore) DeleteCoverLetter(ctx context.Context, userID string, letterID int64) error {
+	res, err := s.exec(ctx, `delete from cover_letters where id = ? and user_id = ?`, letterID, userID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// countApplications counts what the cap is about, failed applications are left out
+const countApplications = `
+select count(*) from applications
+where user_id = ? and created_at >= ? and status in ('` + ApplicationPending + `', '` + ApplicationSent + `')
+`
+
+// ReserveApplication counts and inserts under the user's lock, under read
+// committed two reserves could both count below the limit otherwise
+func (s *sqlStore) ReserveApplication(ctx context.Context, a *Application, since time.Time, limit int) error {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+	a.Status = ApplicationPending
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if limit > 0 {
+			if s.d.lockUser != "" {
+				if _, err := tx.ExecContext(ctx, s.d.rebind(s.d.lockUser), a.UserID); err != nil {
+					return err
+				}
+			}
+			var n int
+			if err := tx.QueryRowContext(ctx, s.d.rebind(countApplications), a.UserID, formatTime(since)).Scan(&n); err != nil {
+				return err
+			}
+			if n >= limit {
+				return ErrCapReached
+			}
+		}
+
+		return tx.QueryRowContext(
+			ctx,
+			s.d.rebind(`
+			insert into applications (user_id, resume_id, vacancy_id, vacancy_name, employer, message, created_at, status)
+			values (?, ?, ?, ?, ?, ?, ?, ?) returning id
+			`),
+			a.UserID, a.ResumeID, a.VacancyID, a.VacancyName, a.Employer, a.Message, formatTime(a.CreatedAt), a.Status,
+		).Scan(&a.ID)
+	})
+}
+
+func (s *sqlStore) FinishApplication(ctx context.Context, a *Application) error {
+	res, err := s.exec(
+		ctx,
+		`update applications set status = ?, negotiation_id = ?, error = ? where id = ? and user_id = ?`,
+		a.Status, a.NegotiationID, a.Error, a.ID, a.UserID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *sqlStore) CountApplications(ctx context.Context, userID string, since time.Time) (int, error) {
+	var n int
+	err := s.queryRow(ctx, countApplications, userID, formatTime(since)).Scan(&n)
+	return n, err
+}
+
+const applicationColumns = `id, user_id, resume_id, vacancy_id, coalesce(vacancy_name, ''), coalesce(employer, ''),
+	coalesce(message, ''), created_at, status, coalesce(negotiation_id, ''), coalesce(error, '')`
+
+func scanApplications(rows *sql.Rows) ([]Application, error) {
+	var apps []Application
+	for rows.Next() {
+		var a Application
+		var createdAt string
+		if err := rows.Scan(
+			&a.ID, &a.UserID, &a.ResumeID, &a.VacancyID, &a.VacancyName, &a.Employer,
+			&a.Message, &createdAt, &a.Status, &a.NegotiationID, &a.Error,
+		); err != nil {
+			return nil, err
+		}
+		a.CreatedAt = parseTime(createdAt)
+		apps = append(apps, a)
+	}
+
+	return apps, rows.Err()
+}
+
+func (s *sqlStore) ListApplications(ctx context.Context, userID string, limit int) ([]Application, error) {
+	rows, err := s.query(ctx, `
+	select `+applicationColumns+`
+	from applications
+	where user_id = ?
+	order by created_at desc, id desc
+	limit ?
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanApplications(rows)
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+func (s *sqlStore) ReplaceBlacklist(ctx context.Context, userID, resumeID string, employers []BlacklistedEmployer) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		keep := make(map[string]bool, len(employers))
+		for _, e := range employers {
+			keep[e.EmployerID] = true
+		}
+
+		rows, err := tx.QueryContext(ctx, s.d.rebind(`select employer_id from resume_blacklist where user_id = ? and resume_id = ?`), userID, resumeID)
+		if err != nil {
+			return err
+		}
+		var stale []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			if !keep[id] {
+				stale = append(stale, id)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range stale {
+			if _, err := tx.ExecContext(
+				ctx,
+				s.d.rebind(`delete from resume_blacklist where user_id = ? and resume_id = ? and employer_id = ?`),
+				userID, resumeID, id,
+			); err != nil {
+				return err
+			}
+		}
+
+		now := formatTime(time.Now())
+		for _, e := range employers {
+			if _, err := tx.ExecContext(ctx, s.d.rebind(`
+			insert into resume_blacklist (user_id, resume_id, employer_id, name, url, added_at) values (?, ?, ?, ?, ?, ?)
+			on conflict(resume_id, employer_id) do update set name = excluded.name, url = excluded.url
+			`), userID, resumeID, e.EmployerID, e.Name, e.URL, now); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *sqlStore) AddBlacklisted(ctx context.Context, e *BlacklistedEmployer) error {
+	if e.AddedAt.IsZero() {
+		e.AddedAt = time.Now()
+	}
+
+	query := `
+	insert into resume_blacklist (user_id, resume_id, employer_id, name, url, added_at) values (?, ?, ?, ?, ?, ?)
+	on conflict(resume_id, employer_id) do update set name = excluded.name, url = excluded.url
+	`
+	_, err := s.exec(ctx, query, e.UserID, e.ResumeID, e.EmployerID, e.Name, e.URL, formatTime(e.AddedAt))
+	return err
+}
+
+func (s *sqlStore) RemoveBlacklisted(ctx context.Context, userID, resumeID, employerID string) error {
+	res, err := s.exec(ctx, `delete from resume_blacklist where user_id = ? and resume_id = ? and employer_id = ?`, userID, resumeID, employerID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+const blacklistColumns = `user_id, resume_id, employer_id, coalesce(name, ''), coalesce(url, ''), added_at`
+
+func scanBlacklist(rows *sql.Rows) ([]BlacklistedEmployer, error) {
+	var employers []BlacklistedEmployer
+	for rows.Next() {
+		var e BlacklistedEmployer
+		var addedAt string
+		if err := rows.Scan(&e.UserID, &e.ResumeID, &e.EmployerID, &e.Name, &e.URL, &addedAt); err != nil {
+			return nil, err
+		}
+		e.AddedAt = parseTime(addedAt)
+		employers = append(employers, e)
+	}
+
+	return employers, rows.Err()
+}
+
+func (s *sqlStore) ListBlacklist(ctx context.Context, userID, resumeID string) ([]BlacklistedEmployer, error) {
+	rows, err := s.query(ctx, `
+	select `+blacklistColumns+`
+	from resume_blacklist
+	where user_id = ? and resume_id = ?
+	order by name
+	`, userID, resumeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanBlacklist(rows)
+}
+
+func (s *sqlStore) CountBlacklisted(ctx context.Context, userID string) (map[string]int, error) {
+	rows, err := s.query(ctx, `select resume_id, count(*) from resume_blacklist where user_id = ? group by resume_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var resumeID string
+		var n int
+		if err := rows.Scan(&resumeID, &n); err != nil {
+			return nil, err
+		}
+		counts[resumeID] = n
+	}
+
+	return counts, rows.Err()
+}
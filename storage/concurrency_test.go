@@ -0,0 +1,146 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"hhcv/storage"
+)
+
+// TestConcurrentHandles writes through two handles on one sqlite file the way
+// the scheduler and web do while both run, busy errors must not surface
+func TestConcurrentHandles(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEY", testKey)
+
+	cfg := storage.Config{Driver: storage.DriverSQLite, DSN: filepath.Join(t.TempDir(), "db.sqlite")}
+	scheduler := open(t, cfg)
+	web := open(t, cfg)
+	backup := open(t, cfg)
+
+	const (
+		runs     = 50
+		attempts = 5
+		users    = 50
+		resumes  = 3
+	)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < runs; i++ {
+			run := &storage.Run{Trigger: "cron", Version: "test"}
+			if err := scheduler.StartRun(ctx, run); err != nil {
+				errs <- fmt.Errorf("start run %d: %w", i, err)
+				return
+			}
+			for j := 0; j < attempts; j++ {
+				a := &storage.Attempt{RunID: run.ID, UserID: fmt.Sprintf("u%d", j), ResumeID: fmt.Sprintf("r%d", j), Timestamp: time.Now(), Status: "ok"}
+				if err := scheduler.AddAttempt(ctx, a); err != nil {
+					errs <- fmt.Errorf("attempt %d of run %d: %w", j, i, err)
+					return
+				}
+			}
+			run.Attempted, run.Succeeded = attempts, attempts
+			if err := scheduler.FinishRun(ctx, run); err != nil {
+				errs <- fmt.Errorf("finish run %d: %w", i, err)
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < users; i++ {
+			userID := fmt.Sprintf("u%d", i)
+			if err := web.UpsertUser(ctx, &storage.User{ID: userID, FirstName: "Ivan", LastName: "Petrov"}); err != nil {
+				errs <- fmt.Errorf("upsert user %s: %w", userID, err)
+				return
+			}
+			var list []storage.Resume
+			for j := 0; j < resumes; j++ {
+				list = append(list, resume(fmt.Sprintf("%s-r%d", userID, j), fmt.Sprintf("Resume %d", j)))
+			}
+			if _, err := web.ReplaceResumes(ctx, userID, list); err != nil {
+				errs <- fmt.Errorf("replace resumes of %s: %w", userID, err)
+				return
+			}
+			if err := web.SetResumeScheduled(ctx, userID, list[0].ID, true); err != nil {
+				errs <- fmt.Errorf("schedule resume of %s: %w", userID, err)
+				return
+			}
+		}
+	}()
+
+	// exports read while both write, the way a backup runs next to them
+	done := make(chan struct{})
+	exported := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-done:
+				exported <- nil
+				return
+			default:
+			}
+			if _, err := backup.Export(ctx, ""); err != nil {
+				exported <- fmt.Errorf("export: %w", err)
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(done)
+	errs <- <-exported
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if t.Failed() {
+		return
+	}
+
+	stored, err := web.ListRuns(ctx, 2*runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != runs {
+		t.Errorf("runs: got %d, want %d", len(stored), runs)
+	}
+	for _, r := range stored {
+		if r.FinishedAt.IsZero() || r.Succeeded != attempts {
+			t.Errorf("run %d was not finished: %+v", r.ID, r)
+		}
+	}
+
+	history, err := web.ListAttempts(ctx, 2*runs*attempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != runs*attempts {
+		t.Errorf("attempts: got %d, want %d", len(history), runs*attempts)
+	}
+
+	summaries, err := scheduler.ListUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != users {
+		t.Errorf("users: got %d, want %d", len(summaries), users)
+	}
+	for _, u := range summaries {
+		if u.ResumeCount != resumes || u.ScheduledCount != 1 {
+			t.Errorf("resumes of %s: got %d, %d scheduled", u.ID, u.ResumeCount, u.ScheduledCount)
+		}
+	}
+}
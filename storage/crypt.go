@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Encrypt seals plaintext with ENCRYPTION_KEY, tokens never hit the database in the clear
+func Encrypt(plaintext string) (string, error) {
+	return encryptWith(os.Getenv("ENCRYPTION_KEY"), plaintext)
+}
+
+func Decrypt(encryptedString string) (string, error) {
+	return decryptWith(os.Getenv("ENCRYPTION_KEY"), encryptedString)
+}
+
+// encryptWith and decryptWith take the key explicitly,
+// dumps seal tokens with their own key
+func encryptWith(key, plaintext string) (string, error) {
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return "", fmt.Errorf("could not create cipher block: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", fmt.Errorf("could not create GCM: %w", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("could not generate nonce: %w", err)
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+func decryptWith(key, encryptedString string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(encryptedString)
+	if err != nil {
+		return "", fmt.Errorf("could not decode base64: %w", err)
+	}
+
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return "", fmt.Errorf("could not create cipher block: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", fmt.Errorf("could not create GCM: %w", err)
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return "", fmt.Errorf("ciphertext too short (missing nonce)")
+	}
+
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+func encryptToken(t *Token) (string, string, error) {
+	at, err := Encrypt(t.AccessToken)
+	if err != nil {
+		return "", "", err
+	}
+
+	rt, err := Encrypt(t.RefreshToken)
+	if err != nil {
+		return "", "", err
+	}
+
+	return at, rt, nil
+}
+
+func decryptToken(t *Token, at, rt string) error {
+	var err error
+
+	if t.AccessToken, err = Decrypt(at); err != nil {
+		return fmt.Errorf("access token: %w", err)
+	}
+
+	if t.RefreshToken, err = Decrypt(rt); err != nil {
+		return fmt.Errorf("refresh token: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,647 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dialect is what differs between backends, queries are written
+// once with ? placeholders and rebound for postgres
+type dialect struct {
+	name string
+	// seq orders the scheduler history by insertion
+	seq       string
+	schema    string
+	rebind    func(query string) string
+	addColumn func(ctx context.Context, db *sql.DB, table, column, definition string) error
+	// isBusy tells lock contention worth retrying from other errors,
+	// nil when the backend waits for locks by itself
+	isBusy func(err error) bool
+	// lockUser makes writers of one user wait for each other until the
+	// transaction ends, empty when transactions already run one at a time
+	lockUser string
+}
+
+// columns added after the first deploy, create table if not exists
+// does not touch tables that are already there
+var migrations = []struct{ table, column, definition string }{
+	{"users", "is_disabled", "integer not null default 0"},
+	{"tokens", "obtained_at", "text"},
+	{"scheduler", "run_id", "integer references scheduler_runs(id) on delete cascade"},
+	{"scheduler", "status", "text"},
+	{"resumes", "matches_seen_at", "text"},
+	{"resumes", "status", "text"},
+	{"resumes", "visibility", "text"},
+	{"resumes", "moderation_note", "text"},
+	{"users", "schedule_mode", "text not null default 'fixed'"},
+	{"users", "time_zone", "text not null default ''"},
+	{"users", "synced_at", "text"},
+}
+
+var sqliteDialect = dialect{
+	name:      DriverSQLite,
+	seq:       "rowid",
+	rebind:    func(query string) string { return query },
+	addColumn: sqliteAddColumn,
+	isBusy:    sqliteIsBusy,
+	schema: `
+	create table if not exists users (
+		id text primary key,
+		first_name text,
+		last_name text,
+		middle_name text,
+		is_disabled integer not null default 0,
+		schedule_mode text not null default 'fixed',
+		time_zone text not null default '',
+		synced_at text
+	);
+
+	create table if not exists tokens (
+		access_token text,
+		refresh_token text,
+		expires_in integer,
+		code text unique,
+		user_id text unique,
+		obtained_at text,
+
+		foreign key (user_id) references users(id) on delete cascade
+	);
+
+	create table if not exists resumes (
+		id text primary key unique,
+		alternate_url text,
+		title text,
+		created_at text,
+		updated_at text,
+		user_id text,
+		is_scheduled integer not null default 0,
+		matches_seen_at text,
+		status text,
+		visibility text,
+		moderation_note text,
+
+		foreign key (user_id) references users(id) on delete cascade
+	);
+
+	create table if not exists scheduler_runs (
+		id integer primary key autoincrement,
+		started_at text not null,
+		finished_at text,
+		trigger text not null,
+		attempted integer not null default 0,
+		succeeded integer not null default 0,
+		skipped integer not null default 0,
+		failed integer not null default 0,
+		version text
+	);
+
+	create table if not exists scheduler (
+		user_id text,
+		resume_id text,
+		resume_title text,
+		timestamp text,
+		error text,
+		run_id integer references scheduler_runs(id) on delete cascade,
+		status text
+	);
+
+	create table if not exists resume_syncs (
+		id integer primary key autoincrement,
+		user_id text references users(id) on delete cascade,
+		timestamp text not null,
+		source text not null,
+		changes text,
+		error text
+	);
+
+	-- no foreign keys, the audit log outlives what it talks about
+	create table if not exists audit_log (
+		id integer primary key autoincrement,
+		timestamp text not null,
+		actor text not null,
+		action text not null,
+		user_id text,
+		target text,
+		ip text,
+		user_agent text,
+		details text
+	);
+
+	create index if not exists audit_log_user_id on audit_log (user_id);
+
+	create table if not exists account_links (
+		owner_id text not null references users(id) on delete cascade,
+		user_id text not null references users(id) on delete cascade,
+		linked_at text not null,
+		primary key (owner_id, user_id)
+	);
+
+	create table if not exists resume_matches (
+		resume_id text not null references resumes(id) on delete cascade,
+		vacancy_id text not null,
+		user_id text not null references users(id) on delete cascade,
+		name text,
+		employer_id text,
+		employer text,
+		url text,
+		salary text,
+		area text,
+		published_at text,
+		first_seen_at text not null,
+		interesting integer not null default 0,
+		primary key (resume_id, vacancy_id)
+	);
+
+	create index if not exists resume_matches_user_id on resume_matches (user_id);
+
+	create table if not exists hidden_employers (
+		user_id text not null references users(id) on delete cascade,
+		employer_id text not null,
+		name text,
+		hidden_at text not null,
+		primary key (user_id, employer_id)
+	);
+
+	create table if not exists saved_searches (
+		id integer primary key autoincrement,
+		user_id text not null references users(id) on delete cascade,
+		name text not null,
+		text text,
+		area text,
+		salary integer not null default 0,
+		experience text,
+		schedule text,
+		created_at text not null,
+		last_run_at text,
+		last_error text,
+		seen_at text
+	);
+
+	create table if not exists search_results (
+		search_id integer not null references saved_searches(id) on delete cascade,
+		vacancy_id text not null,
+		user_id text not null references users(id) on delete cascade,
+		name text,
+		employer_id text,
+		employer text,
+		url text,
+		salary text,
+		area text,
+		published_at text,
+		first_seen_at text not null,
+		primary key (search_id, vacancy_id)
+	);
+
+	create table if not exists resume_snapshots (
+		id integer primary key autoincrement,
+		user_id text not null references users(id) on delete cascade,
+		resume_id text not null references resumes(id) on delete cascade,
+		taken_at text not null,
+		hash text not null,
+		data text not null
+	);
+
+	create index if not exists resume_snapshots_resume_id on resume_snapshots (resume_id, taken_at);
+
+	create table if not exists resume_views (
+		user_id text not null references users(id) on delete cascade,
+		resume_id text not null references resumes(id) on delete cascade,
+		viewed_at text not null,
+		employer_id text not null default '',
+		employer_name text,
+
+		primary key (resume_id, viewed_at, employer_id)
+	);
+
+	create index if not exists resume_views_user_id on resume_views (user_id, viewed_at);
+
+	create table if not exists bump_slots (
+		user_id text not null references users(id) on delete cascade,
+		slot_at text not null,
+		reason text,
+
+		primary key (user_id, slot_at)
+	);
+
+	create table if not exists resume_blacklist (
+		user_id text not null references users(id) on delete cascade,
+		resume_id text not null references resumes(id) on delete cascade,
+		employer_id text not null,
+		name text,
+		url text,
+		added_at text not null,
+
+		primary key (resume_id, employer_id)
+	);
+
+	create table if not exists cover_letters (
+		id integer primary key autoincrement,
+		user_id text not null references users(id) on delete cascade,
+		name text not null,
+		body text not null,
+		created_at text not null
+	);
+
+	create table if not exists applications (
+		id integer primary key autoincrement,
+		user_id text not null references users(id) on delete cascade,
+		resume_id text not null,
+		vacancy_id text not null,
+		vacancy_name text,
+		employer text,
+		message text,
+		created_at text not null,
+		status text not null,
+		negotiation_id text,
+		error text
+	);
+
+	create index if not exists applications_user_id on applications (user_id, created_at);
+
+	create table if not exists negotiations (
+		id text primary key,
+		user_id text not null references users(id) on delete cascade,
+		resume_id text,
+		vacancy_id text,
+		vacancy_name text,
+		employer text,
+		url text,
+		state text not null,
+		viewed integer not null default 0,
+		stage text not null,
+		created_at text,
+		updated_at text
+	);
+
+	create index if not exists negotiations_user_id on negotiations (user_id);
+
+	-- no foreign key to negotiations, hh may stop listing old ones
+	create table if not exists negotiation_changes (
+		id integer primary key autoincrement,
+		negotiation_id text not null,
+		user_id text not null references users(id) on delete cascade,
+		vacancy_name text,
+		timestamp text not null,
+		from_stage text,
+		to_stage text not null
+	);
+
+	create index if not exists negotiation_changes_user_id on negotiation_changes (user_id);
+
+	create table if not exists notifications (
+		id integer primary key autoincrement,
+		user_id text not null references users(id) on delete cascade,
+		created_at text not null,
+		kind text not null,
+		text text not null,
+		url text,
+		read_at text
+	);
+
+	create index if not exists notifications_user_id on notifications (user_id);
+
+	create table if not exists tombstones (
+		id integer primary key autoincrement,
+		user_id text not null,
+		deleted_at text not null,
+		actor text not null,
+		revoked integer not null default 0,
+		details text
+	);
+	`,
+}
+
+var postgresDialect = dialect{
+	name:      DriverPostgres,
+	seq:       "id",
+	rebind:    rebindDollar,
+	addColumn: postgresAddColumn,
+	lockUser:  `select pg_advisory_xact_lock(hashtext(?))`,
+	schema: `
+	create table if not exists users (
+		id text primary key,
+		first_name text,
+		last_name text,
+		middle_name text,
+		is_disabled integer not null default 0,
+		schedule_mode text not null default 'fixed',
+		time_zone text not null default '',
+		synced_at text
+	);
+
+	create table if not exists tokens (
+		access_token text,
+		refresh_token text,
+		expires_in integer,
+		code text unique,
+		user_id text unique references users(id) on delete cascade,
+		obtained_at text
+	);
+
+	create table if not exists resumes (
+		id text primary key,
+		alternate_url text,
+		title text,
+		created_at text,
+		updated_at text,
+		user_id text references users(id) on delete cascade,
+		is_scheduled integer not null default 0,
+		matches_seen_at text,
+		status text,
+		visibility text,
+		moderation_note text
+	);
+
+	create table if not exists scheduler_runs (
+		id bigserial primary key,
+		started_at text not null,
+		finished_at text,
+		trigger text not null,
+		attempted integer not null default 0,
+		succeeded integer not null default 0,
+		skipped integer not null default 0,
+		failed integer not null default 0,
+		version text
+	);
+
+	create table if not exists scheduler (
+		id bigserial primary key,
+		user_id text,
+		resume_id text,
+		resume_title text,
+		timestamp text,
+		error text,
+		run_id bigint references scheduler_runs(id) on delete cascade,
+		status text
+	);
+
+	create table if not exists resume_syncs (
+		id bigserial primary key,
+		user_id text references users(id) on delete cascade,
+		timestamp text not null,
+		source text not null,
+		changes text,
+		error text
+	);
+
+	-- no foreign keys, the audit log outlives what it talks about
+	create table if not exists audit_log (
+		id bigserial primary key,
+		timestamp text not null,
+		actor text not null,
+		action text not null,
+		user_id text,
+		target text,
+		ip text,
+		user_agent text,
+		details text
+	);
+
+	create index if not exists audit_log_user_id on audit_log (user_id);
+
+	create table if not exists account_links (
+		owner_id text not null references users(id) on delete cascade,
+		user_id text not null references users(id) on delete cascade,
+		linked_at text not null,
+		primary key (owner_id, user_id)
+	);
+
+	create table if not exists resume_matches (
+		resume_id text not null references resumes(id) on delete cascade,
+		vacancy_id text not null,
+		user_id text not null references users(id) on delete cascade,
+		name text,
+		employer_id text,
+		employer text,
+		url text,
+		salary text,
+		area text,
+		published_at text,
+		first_seen_at text not null,
+		interesting integer not null default 0,
+		primary key (resume_id, vacancy_id)
+	);
+
+	create index if not exists resume_matches_user_id on resume_matches (user_id);
+
+	create table if not exists hidden_employers (
+		user_id text not null references users(id) on delete cascade,
+		employer_id text not null,
+		name text,
+		hidden_at text not null,
+		primary key (user_id, employer_id)
+	);
+
+	create table if not exists saved_searches (
+		id bigserial primary key,
+		user_id text not null references users(id) on delete cascade,
+		name text not null,
+		text text,
+		area text,
+		salary integer not null default 0,
+		experience text,
+		schedule text,
+		created_at text not null,
+		last_run_at text,
+		last_error text,
+		seen_at text
+	);
+
+	create table if not exists search_results (
+		search_id bigint not null references saved_searches(id) on delete cascade,
+		vacancy_id text not null,
+		user_id text not null references users(id) on delete cascade,
+		name text,
+		employer_id text,
+		employer text,
+		url text,
+		salary text,
+		area text,
+		published_at text,
+		first_seen_at text not null,
+		primary key (search_id, vacancy_id)
+	);
+
+	create table if not exists resume_snapshots (
+		id bigserial primary key,
+		user_id text not null references users(id) on delete cascade,
+		resume_id text not null references resumes(id) on delete cascade,
+		taken_at text not null,
+		hash text not null,
+		data text not null
+	);
+
+	create index if not exists resume_snapshots_resume_id on resume_snapshots (resume_id, taken_at);
+
+	create table if not exists resume_views (
+		user_id text not null references users(id) on delete cascade,
+		resume_id text not null references resumes(id) on delete cascade,
+		viewed_at text not null,
+		employer_id text not null default '',
+		employer_name text,
+
+		primary key (resume_id, viewed_at, employer_id)
+	);
+
+	create index if not exists resume_views_user_id on resume_views (user_id, viewed_at);
+
+	create table if not exists bump_slots (
+		user_id text not null references users(id) on delete cascade,
+		slot_at text not null,
+		reason text,
+
+		primary key (user_id, slot_at)
+	);
+
+	create table if not exists resume_blacklist (
+		user_id text not null references users(id) on delete cascade,
+		resume_id text not null references resumes(id) on delete cascade,
+		employer_id text not null,
+		name text,
+		url text,
+		added_at text not null,
+
+		primary key (resume_id, employer_id)
+	);
+
+	create table if not exists cover_letters (
+		id bigserial primary key,
+		user_id text not null references users(id) on delete cascade,
+		name text not null,
+		body text not null,
+		created_at text not null
+	);
+
+	create table if not exists applications (
+		id bigserial primary key,
+		user_id text not null references users(id) on delete cascade,
+		resume_id text not null,
+		vacancy_id text not null,
+		vacancy_name text,
+		employer text,
+		message text,
+		created_at text not null,
+		status text not null,
+		negotiation_id text,
+		error text
+	);
+
+	create index if not exists applications_user_id on applications (user_id, created_at);
+
+	create table if not exists negotiations (
+		id text primary key,
+		user_id text not null references users(id) on delete cascade,
+		resume_id text,
+		vacancy_id text,
+		vacancy_name text,
+		employer text,
+		url text,
+		state text not null,
+		viewed integer not null default 0,
+		stage text not null,
+		created_at text,
+		updated_at text
+	);
+
+	create index if not exists negotiations_user_id on negotiations (user_id);
+
+	-- no foreign key to negotiations, hh may stop listing old ones
+	create table if not exists negotiation_changes (
+		id bigserial primary key,
+		negotiation_id text not null,
+		user_id text not null references users(id) on delete cascade,
+		vacancy_name text,
+		timestamp text not null,
+		from_stage text,
+		to_stage text not null
+	);
+
+	create index if not exists negotiation_changes_user_id on negotiation_changes (user_id);
+
+	create table if not exists notifications (
+		id bigserial primary key,
+		user_id text not null references users(id) on delete cascade,
+		created_at text not null,
+		kind text not null,
+		text text not null,
+		url text,
+		read_at text
+	);
+
+	create index if not exists notifications_user_id on notifications (user_id);
+
+	create table if not exists tombstones (
+		id bigserial primary key,
+		user_id text not null,
+		deleted_at text not null,
+		actor text not null,
+		revoked integer not null default 0,
+		details text
+	);
+	`,
+}
+
+func rebindDollar(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func sqliteAddColumn(ctx context.Context, db *sql.DB, table, column, definition string) error {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("pragma table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf("alter table %s add column %s %s", table, column, definition))
+	return err
+}
+
+func postgresAddColumn(ctx context.Context, db *sql.DB, table, column, definition string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("alter table %s add column if not exists %s %s", table, column, definition))
+	return err
+}
+
+func (d dialect) migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, d.schema); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if err := d.addColumn(ctx, db, m.table, m.column, m.definition); err != nil {
+			return fmt.Errorf("migrating %s.%s: %w", m.table, m.column, err)
+		}
+	}
+
+	return nil
+}
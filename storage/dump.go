@@ -0,0 +1,904 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *sqlStore) Backup(ctx context.Context, path string) error {
+	if s.d.name != DriverSQLite {
+		return fmt.Errorf("storage: backup of %s is left to its own tools: %w", s.d.name, errors.ErrUnsupported)
+	}
+
+	// vacuum into reads from one snapshot, writers are not blocked while it runs
+	_, err := s.db.ExecContext(ctx, `vacuum into ?`, path)
+	return err
+}
+
+func (s *sqlStore) Export(ctx context.Context, dumpKey string) (*Dump, error) {
+	d := &Dump{Version: DumpVersion, ExportedAt: time.Now().UTC()}
+
+	// one transaction so history and resumes are read from the same state
+	err := s.withReadTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		if d.Users, err = s.exportUsers(ctx, tx); err != nil {
+			return fmt.Errorf("users: %w", err)
+		}
+		if dumpKey != "" {
+			if d.Tokens, err = s.exportTokens(ctx, tx, dumpKey); err != nil {
+				return fmt.Errorf("tokens: %w", err)
+			}
+		}
+		if d.Resumes, err = s.exportResumes(ctx, tx, ""); err != nil {
+			return fmt.Errorf("resumes: %w", err)
+		}
+		if d.Runs, err = s.exportRuns(ctx, tx); err != nil {
+			return fmt.Errorf("runs: %w", err)
+		}
+		if d.Attempts, err = s.exportAttempts(ctx, tx, ""); err != nil {
+			return fmt.Errorf("attempts: %w", err)
+		}
+		if d.Syncs, err = s.exportSyncs(ctx, tx, ""); err != nil {
+			return fmt.Errorf("syncs: %w", err)
+		}
+		if d.Audit, err = s.exportAudit(ctx, tx); err != nil {
+			return fmt.Errorf("audit: %w", err)
+		}
+		if d.Links, err = s.exportLinks(ctx, tx, ""); err != nil {
+			return fmt.Errorf("account links: %w", err)
+		}
+		if err = s.exportNegotiations(ctx, tx, "", &d.Negotiations, &d.NegotiationChanges, &d.Notifications); err != nil {
+			return err
+		}
+		if err = s.exportMatches(ctx, tx, "", &d.Matches, &d.HiddenEmployers); err != nil {
+			return err
+		}
+		if err = s.exportSearches(ctx, tx, "", &d.Searches, &d.SearchResults); err != nil {
+			return err
+		}
+		if err = s.exportApplications(ctx, tx, "", &d.CoverLetters, &d.Applications); err != nil {
+			return err
+		}
+		if d.Snapshots, err = s.exportSnapshots(ctx, tx, ""); err != nil {
+			return fmt.Errorf("resume snapshots: %w", err)
+		}
+		if d.Blacklist, err = s.exportBlacklist(ctx, tx, ""); err != nil {
+			return fmt.Errorf("resume blacklist: %w", err)
+		}
+		if err = s.exportViews(ctx, tx, "", &d.Views, &d.Slots); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (s *sqlStore) exportUsers(ctx context.Context, tx *sql.Tx) ([]User, error) {
+	rows, err := tx.QueryContext(ctx, `
+	select id, coalesce(first_name, ''), coalesce(last_name, ''), coalesce(middle_name, ''), is_disabled, schedule_mode, time_zone
+	from users
+	order by id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.MiddleName, &u.IsDisabled, &u.ScheduleMode, &u.TimeZone); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// tokens that do not decrypt with ENCRYPTION_KEY are left out,
+// they are of no use on the other side either
+func (s *sqlStore) exportTokens(ctx context.Context, tx *sql.Tx, dumpKey string) ([]DumpToken, error) {
+	rows, err := tx.QueryContext(ctx, `
+	select user_id, access_token, refresh_token, coalesce(expires_in, 0), coalesce(obtained_at, '')
+	from tokens
+	where user_id is not null
+	order by user_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []DumpToken
+	for rows.Next() {
+		var at, rt, obtainedAt string
+		var dt DumpToken
+		if err := rows.Scan(&dt.UserID, &at, &rt, &dt.ExpiresIn, &obtainedAt); err != nil {
+			return nil, err
+		}
+		dt.ObtainedAt = parseTime(obtainedAt)
+
+		var t Token
+		if err := decryptToken(&t, at, rt); err != nil {
+			continue
+		}
+		if dt.AccessToken, err = encryptWith(dumpKey, t.AccessToken); err != nil {
+			return nil, err
+		}
+		if dt.RefreshToken, err = encryptWith(dumpKey, t.RefreshToken); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, dt)
+	}
+
+	return tokens, rows.Err()
+}
+
+// the export helpers below read every user when userID is empty
+func (s *sqlStore) exportResumes(ctx context.Context, tx *sql.Tx, userID string) ([]Resume, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		s.d.rebind(`select `+resumeColumns+` from resumes where ? = '' or user_id = ? order by user_id, id`),
+		userID, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var resumes []Resume
+	for rows.Next() {
+		r, err := scanResume(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		resumes = append(resumes, r)
+	}
+
+	return resumes, rows.Err()
+}
+
+func (s *sqlStore) exportRuns(ctx context.Context, tx *sql.Tx) ([]Run, error) {
+	rows, err := tx.QueryContext(ctx, `
+	select id, started_at, coalesce(finished_at, ''), trigger, attempted, succeeded, skipped, failed, coalesce(version, '')
+	from scheduler_runs
+	order by id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		var r Run
+		var startedAt, finishedAt string
+		if err := rows.Scan(
+			&r.ID, &startedAt, &finishedAt, &r.Trigger, &r.Attempted, &r.Succeeded, &r.Skipped, &r.Failed, &r.Version,
+		); err != nil {
+			return nil, err
+		}
+		r.StartedAt = parseTime(startedAt)
+		r.FinishedAt = parseTime(finishedAt)
+		runs = append(runs, r)
+	}
+
+	return runs, rows.Err()
+}
+
+func (s *sqlStore) exportAttempts(ctx context.Context, tx *sql.Tx, userID string) ([]Attempt, error) {
+	rows, err := tx.QueryContext(ctx, s.d.rebind(fmt.Sprintf(`
+	select coalesce(run_id, 0), coalesce(user_id, ''), coalesce(resume_id, ''), coalesce(resume_title, ''),
+		coalesce(timestamp, ''), coalesce(status, ''), coalesce(error, '')
+	from scheduler
+	where ? = '' or user_id = ?
+	order by %s
+	`, s.d.seq)), userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []Attempt
+	for rows.Next() {
+		var a Attempt
+		var timestamp string
+		if err := rows.Scan(&a.RunID, &a.UserID, &a.ResumeID, &a.ResumeTitle, &timestamp, &a.Status, &a.Error); err != nil {
+			return nil, err
+		}
+		a.Timestamp = parseTime(timestamp)
+		attempts = append(attempts, a)
+	}
+
+	return attempts, rows.Err()
+}
+
+func (s *sqlStore) exportSyncs(ctx context.Context, tx *sql.Tx, userID string) ([]ResumeSync, error) {
+	rows, err := tx.QueryContext(ctx, s.d.rebind(`
+	select id, coalesce(user_id, ''), timestamp, source, coalesce(changes, ''), coalesce(error, '')
+	from resume_syncs
+	where ? = '' or user_id = ?
+	order by id
+	`), userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var syncs []ResumeSync
+	for rows.Next() {
+		var rs ResumeSync
+		var timestamp, changes string
+		if err := rows.Scan(&rs.ID, &rs.UserID, &timestamp, &rs.Source, &changes, &rs.Error); err != nil {
+			return nil, err
+		}
+		rs.Timestamp = parseTime(timestamp)
+		if changes != "" {
+			if err := json.Unmarshal([]byte(changes), &rs.Changes); err != nil {
+				return nil, fmt.Errorf("resume sync %d: %w", rs.ID, err)
+			}
+		}
+		syncs = append(syncs, rs)
+	}
+
+	return syncs, rows.Err()
+}
+
+func (s *sqlStore) exportAudit(ctx context.Context, tx *sql.Tx) ([]AuditEvent, error) {
+	rows, err := tx.QueryContext(ctx, `
+	select id, timestamp, actor, action, coalesce(user_id, ''), coalesce(target, ''),
+		coalesce(ip, ''), coalesce(user_agent, ''), coalesce(details, '')
+	from audit_log
+	order by id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		var timestamp string
+		if err := rows.Scan(&e.ID, &timestamp, &e.Actor, &e.Action, &e.UserID, &e.Target, &e.IP, &e.UserAgent, &e.Details); err != nil {
+			return nil, err
+		}
+		e.Timestamp = parseTime(timestamp)
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// exportLinks reads links from and to userID
+func (s *sqlStore) exportLinks(ctx context.Context, tx *sql.Tx, userID string) ([]AccountLink, error) {
+	rows, err := tx.QueryContext(ctx, s.d.rebind(`
+	select owner_id, user_id, linked_at
+	from account_links
+	where ? = '' or owner_id = ? or user_id = ?
+	order by owner_id, linked_at
+	`), userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []AccountLink
+	for rows.Next() {
+		var l AccountLink
+		var linkedAt string
+		if err := rows.Scan(&l.OwnerID, &l.UserID, &linkedAt); err != nil {
+			return nil, err
+		}
+		l.LinkedAt = parseTime(linkedAt)
+		links = append(links, l)
+	}
+
+	return links, rows.Err()
+}
+
+// exportNegotiations reads negotiations with their changes and notifications
+func (s *sqlStore) exportNegotiations(
+	ctx context.Context, tx *sql.Tx, userID string,
+	negotiations *[]Negotiation, changes *[]NegotiationChange, notifications *[]Notification,
+) error {
+	rows, err := tx.QueryContext(ctx, s.d.rebind(`select `+negotiationColumns+` from negotiations where ? = '' or user_id = ? order by user_id, id`), userID, userID)
+	if err != nil {
+		return fmt.Errorf("negotiations: %w", err)
+	}
+	for rows.Next() {
+		n, err := scanNegotiation(rows.Scan)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("negotiations: %w", err)
+		}
+		*negotiations = append(*negotiations, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("negotiations: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, s.d.rebind(`
+	select id, negotiation_id, user_id, coalesce(vacancy_name, ''), timestamp, coalesce(from_stage, ''), to_stage
+	from negotiation_changes
+	where ? = '' or user_id = ?
+	order by id
+	`), userID, userID)
+	if err != nil {
+		return fmt.Errorf("negotiation changes: %w", err)
+	}
+	*changes, err = scanNegotiationChanges(rows)
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("negotiation changes: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, s.d.rebind(`
+	select id, user_id, created_at, kind, text, coalesce(url, ''), read_at is not null
+	from notifications
+	where ? = '' or user_id = ?
+	order by id
+	`), userID, userID)
+	if err != nil {
+		return fmt.Errorf("notifications: %w", err)
+	}
+	*notifications, err = scanNotifications(rows)
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("notifications: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) exportMatches(ctx context.Context, tx *sql.Tx, userID string, matches *[]Match, hidden *[]HiddenEmployer) error {
+	rows, err := tx.QueryContext(ctx, s.d.rebind(`
+	select `+matchColumns+`
+	from resume_matches m
+	where ? = '' or m.user_id = ?
+	order by m.user_id, m.resume_id, m.vacancy_id
+	`), userID, userID)
+	if err != nil {
+		return fmt.Errorf("matches: %w", err)
+	}
+	*matches, err = scanMatches(rows)
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("matches: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, s.d.rebind(`
+	select user_id, employer_id, coalesce(name, ''), hidden_at
+	from hidden_employers
+	where ? = '' or user_id = ?
+	order by user_id, employer_id
+	`), userID, userID)
+	if err != nil {
+		return fmt.Errorf("hidden employers: %w", err)
+	}
+	*hidden, err = scanHiddenEmployers(rows)
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("hidden employers: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) exportSearches(ctx context.Context, tx *sql.Tx, userID string, searches *[]SavedSearch, results *[]SearchResult) error {
+	rows, err := tx.QueryContext(ctx, s.d.rebind(`
+	select `+searchColumns+`
+	from saved_searches s
+	where ? = '' or s.user_id = ?
+	order by s.id
+	`), userID, userID)
+	if err != nil {
+		return fmt.Errorf("searches: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ss, err := scanSearch(rows.Scan)
+		if err != nil {
+			return fmt.Errorf("searches: %w", err)
+		}
+		*searches = append(*searches, ss)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("searches: %w", err)
+	}
+	rows.Close()
+
+	rows, err = tx.QueryContext(ctx, s.d.rebind(`
+	select `+searchResultColumns+`
+	from search_results r
+	where ? = '' or r.user_id = ?
+	order by r.search_id, r.vacancy_id
+	`), userID, userID)
+	if err != nil {
+		return fmt.Errorf("search results: %w", err)
+	}
+	*results, err = scanSearchResults(rows)
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("search results: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) exportApplications(ctx context.Context, tx *sql.Tx, userID string, letters *[]CoverLetter, apps *[]Application) error {
+	rows, err := tx.QueryContext(ctx, s.d.rebind(`
+	select id, user_id, name, body, created_at
+	from cover_letters
+	where ? = '' or user_id = ?
+	order by id
+	`), userID, userID)
+	if err != nil {
+		return fmt.Errorf("cover letters: %w", err)
+	}
+	*letters, err = scanCoverLetters(rows)
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("cover letters: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, s.d.rebind(`
+	select `+applicationColumns+`
+	from applications
+	where ? = '' or user_id = ?
+	order by id
+	`), userID, userID)
+	if err != nil {
+		return fmt.Errorf("applications: %w", err)
+	}
+	*apps, err = scanApplications(rows)
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("applications: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) exportSnapshots(ctx context.Context, tx *sql.Tx, userID string) ([]ResumeSnapshot, error) {
+	rows, err := tx.QueryContext(ctx, s.d.rebind(`
+	select id, user_id, resume_id, taken_at, hash, data
+	from resume_snapshots
+	where ? = '' or user_id = ?
+	order by id
+	`), userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSnapshots(rows)
+}
+
+func (s *sqlStore) exportBlacklist(ctx context.Context, tx *sql.Tx, userID string) ([]BlacklistedEmployer, error) {
+	rows, err := tx.QueryContext(ctx, s.d.rebind(`
+	select `+blacklistColumns+`
+	from resume_blacklist
+	where ? = '' or user_id = ?
+	order by user_id, resume_id, employer_id
+	`), userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanBlacklist(rows)
+}
+
+func (s *sqlStore) exportViews(ctx context.Context, tx *sql.Tx, userID string, views *[]ResumeView, slots *[]BumpSlot) error {
+	rows, err := tx.QueryContext(ctx, s.d.rebind(`
+	select `+viewColumns+`
+	from resume_views
+	where ? = '' or user_id = ?
+	order by user_id, viewed_at
+	`), userID, userID)
+	if err != nil {
+		return fmt.Errorf("resume views: %w", err)
+	}
+	*views, err = scanViews(rows)
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("resume views: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx, s.d.rebind(`
+	select user_id, slot_at, coalesce(reason, '')
+	from bump_slots
+	where ? = '' or user_id = ?
+	order by user_id, slot_at
+	`), userID, userID)
+	if err != nil {
+		return fmt.Errorf("bump slots: %w", err)
+	}
+	*slots, err = scanSlots(rows)
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("bump slots: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqlStore) ExportUser(ctx context.Context, userID string) (*UserData, error) {
+	d := &UserData{ExportedAt: time.Now().UTC()}
+
+	err := s.withReadTx(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, s.d.rebind(`
+		select id, coalesce(first_name, ''), coalesce(last_name, ''), coalesce(middle_name, ''), is_disabled, schedule_mode, time_zone
+		from users
+		where id = ?
+		`), userID).Scan(&d.User.ID, &d.User.FirstName, &d.User.LastName, &d.User.MiddleName, &d.User.IsDisabled, &d.User.ScheduleMode, &d.User.TimeZone); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("user: %w", err)
+		}
+
+		var err error
+		if d.Token, err = s.describeToken(ctx, tx, userID); err != nil {
+			return fmt.Errorf("token: %w", err)
+		}
+		if d.Resumes, err = s.exportResumes(ctx, tx, userID); err != nil {
+			return fmt.Errorf("resumes: %w", err)
+		}
+		if d.Attempts, err = s.exportAttempts(ctx, tx, userID); err != nil {
+			return fmt.Errorf("attempts: %w", err)
+		}
+		if d.Syncs, err = s.exportSyncs(ctx, tx, userID); err != nil {
+			return fmt.Errorf("syncs: %w", err)
+		}
+		if d.Links, err = s.exportLinks(ctx, tx, userID); err != nil {
+			return fmt.Errorf("account links: %w", err)
+		}
+		if err = s.exportNegotiations(ctx, tx, userID, &d.Negotiations, &d.NegotiationChanges, &d.Notifications); err != nil {
+			return err
+		}
+		if err = s.exportMatches(ctx, tx, userID, &d.Matches, &d.HiddenEmployers); err != nil {
+			return err
+		}
+		if err = s.exportSearches(ctx, tx, userID, &d.Searches, &d.SearchResults); err != nil {
+			return err
+		}
+		if err = s.exportApplications(ctx, tx, userID, &d.CoverLetters, &d.Applications); err != nil {
+			return err
+		}
+		if d.Snapshots, err = s.exportSnapshots(ctx, tx, userID); err != nil {
+			return fmt.Errorf("resume snapshots: %w", err)
+		}
+		if d.Blacklist, err = s.exportBlacklist(ctx, tx, userID); err != nil {
+			return fmt.Errorf("resume blacklist: %w", err)
+		}
+		if err = s.exportViews(ctx, tx, userID, &d.Views, &d.Slots); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// describeToken decrypts only to tell a working token from a broken one
+func (s *sqlStore) describeToken(ctx context.Context, tx *sql.Tx, userID string) (*TokenInfo, error) {
+	var at, rt, obtainedAt string
+	var expiresIn uint
+	err := tx.QueryRowContext(ctx, s.d.rebind(`
+	select access_token, refresh_token, coalesce(expires_in, 0), coalesce(obtained_at, '')
+	from tokens
+	where user_id = ?
+	`), userID).Scan(&at, &rt, &expiresIn, &obtainedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &TokenInfo{Status: TokenMissing}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t := Token{ExpiresIn: expiresIn, ObtainedAt: parseTime(obtainedAt)}
+	info := &TokenInfo{Status: TokenOK, ObtainedAt: t.ObtainedAt}
+	if expiresAt, ok := t.ExpiresAt(); ok {
+		info.ExpiresAt = expiresAt
+	}
+	if err := decryptToken(&t, at, rt); err != nil {
+		info.Status = TokenBroken
+	}
+
+	return info, nil
+}
+
+func (s *sqlStore) Import(ctx context.Context, d *Dump, dumpKey string) error {
+	if d.Version != DumpVersion {
+		return fmt.Errorf("storage: dump version %d, expected %d", d.Version, DumpVersion)
+	}
+	if len(d.Tokens) > 0 && dumpKey == "" {
+		return fmt.Errorf("storage: dump has tokens but no key was given to open them")
+	}
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		exec := func(query string, args ...any) error {
+			_, err := tx.ExecContext(ctx, s.d.rebind(query), args...)
+			return err
+		}
+
+		var users int
+		if err := tx.QueryRowContext(ctx, `select count(*) from users`).Scan(&users); err != nil {
+			return err
+		}
+		if users > 0 {
+			return ErrNotEmpty
+		}
+
+		for _, u := range d.Users {
+			// dumps from before schedule modes have none
+			mode := u.ScheduleMode
+			if mode == "" {
+				mode = ScheduleFixed
+			}
+			if err := exec(
+				`insert into users (id, first_name, last_name, middle_name, is_disabled, schedule_mode, time_zone) values (?, ?, ?, ?, ?, ?, ?)`,
+				u.ID, u.FirstName, u.LastName, u.MiddleName, boolToInt(u.IsDisabled), mode, u.TimeZone,
+			); err != nil {
+				return fmt.Errorf("user %s: %w", u.ID, err)
+			}
+		}
+
+		for _, l := range d.Links {
+			if err := exec(
+				`insert into account_links (owner_id, user_id, linked_at) values (?, ?, ?)`,
+				l.OwnerID, l.UserID, formatTime(l.LinkedAt),
+			); err != nil {
+				return fmt.Errorf("account link %s to %s: %w", l.OwnerID, l.UserID, err)
+			}
+		}
+
+		for _, dt := range d.Tokens {
+			if err := s.importToken(exec, dt, dumpKey); err != nil {
+				return fmt.Errorf("token of %s: %w", dt.UserID, err)
+			}
+		}
+
+		for _, r := range d.Resumes {
+			if err := exec(
+				`insert into resumes (id, user_id, title, alternate_url, created_at, updated_at, is_scheduled, status, visibility, moderation_note) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				r.ID, r.UserID, r.Title, r.AlternateURL,
+				r.CreatedAt.UTC().Format(resumeTimeLayout), r.UpdatedAt.UTC().Format(resumeTimeLayout), boolToInt(r.IsScheduled),
+				r.Status, r.Visibility, r.ModerationNote,
+			); err != nil {
+				return fmt.Errorf("resume %s: %w", r.ID, err)
+			}
+		}
+
+		for _, snap := range d.Snapshots {
+			if err := exec(
+				`insert into resume_snapshots (user_id, resume_id, taken_at, hash, data) values (?, ?, ?, ?, ?)`,
+				snap.UserID, snap.ResumeID, formatTime(snap.TakenAt), snap.Hash, snap.Data,
+			); err != nil {
+				return fmt.Errorf("snapshot %d of resume %s: %w", snap.ID, snap.ResumeID, err)
+			}
+		}
+
+		for _, e := range d.Blacklist {
+			if err := exec(
+				`insert into resume_blacklist (user_id, resume_id, employer_id, name, url, added_at) values (?, ?, ?, ?, ?, ?)`,
+				e.UserID, e.ResumeID, e.EmployerID, e.Name, e.URL, formatTime(e.AddedAt),
+			); err != nil {
+				return fmt.Errorf("blacklisted employer %s of resume %s: %w", e.EmployerID, e.ResumeID, err)
+			}
+		}
+
+		for _, v := range d.Views {
+			if err := exec(
+				`insert into resume_views (user_id, resume_id, viewed_at, employer_id, employer_name) values (?, ?, ?, ?, ?)`,
+				v.UserID, v.ResumeID, formatTime(v.ViewedAt), v.EmployerID, v.EmployerName,
+			); err != nil {
+				return fmt.Errorf("view of resume %s: %w", v.ResumeID, err)
+			}
+		}
+
+		for _, slot := range d.Slots {
+			if err := exec(
+				`insert into bump_slots (user_id, slot_at, reason) values (?, ?, ?)`,
+				slot.UserID, formatTime(slot.At), slot.Reason,
+			); err != nil {
+				return fmt.Errorf("bump slot of %s: %w", slot.UserID, err)
+			}
+		}
+
+		// runs get new ids, postgres sequences would not know about the old ones
+		runIDs := make(map[int64]int64, len(d.Runs))
+		for _, r := range d.Runs {
+			var id int64
+			if err := tx.QueryRowContext(
+				ctx,
+				s.d.rebind(`
+				insert into scheduler_runs (started_at, finished_at, trigger, attempted, succeeded, skipped, failed, version)
+				values (?, ?, ?, ?, ?, ?, ?, ?) returning id
+				`),
+				formatTime(r.StartedAt), formatTime(r.FinishedAt), r.Trigger, r.Attempted, r.Succeeded, r.Skipped, r.Failed, r.Version,
+			).Scan(&id); err != nil {
+				return fmt.Errorf("run %d: %w", r.ID, err)
+			}
+			runIDs[r.ID] = id
+		}
+
+		for _, a := range d.Attempts {
+			var runID sql.NullInt64
+			if id, ok := runIDs[a.RunID]; ok {
+				runID = sql.NullInt64{Int64: id, Valid: true}
+			}
+			if err := exec(
+				`insert into scheduler (run_id, user_id, resume_id, resume_title, timestamp, status, error) values (?, ?, ?, ?, ?, ?, ?)`,
+				runID, a.UserID, a.ResumeID, a.ResumeTitle, formatTime(a.Timestamp), a.Status, a.Error,
+			); err != nil {
+				return fmt.Errorf("attempt: %w", err)
+			}
+		}
+
+		for _, rs := range d.Syncs {
+			changes, err := json.Marshal(rs.Changes)
+			if err != nil {
+				return err
+			}
+			if err := exec(
+				`insert into resume_syncs (user_id, timestamp, source, changes, error) values (?, ?, ?, ?, ?)`,
+				rs.UserID, formatTime(rs.Timestamp), rs.Source, string(changes), rs.Error,
+			); err != nil {
+				return fmt.Errorf("resume sync %d: %w", rs.ID, err)
+			}
+		}
+
+		for _, m := range d.Matches {
+			if err := exec(
+				`insert into resume_matches (resume_id, vacancy_id, user_id, name, employer_id, employer, url, salary, area, published_at, first_seen_at, interesting)
+				values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				m.ResumeID, m.VacancyID, m.UserID, m.Name, m.EmployerID, m.Employer, m.URL, m.Salary, m.Area,
+				formatTime(m.PublishedAt), formatTime(m.FirstSeenAt), boolToInt(m.Interesting),
+			); err != nil {
+				return fmt.Errorf("match %s of resume %s: %w", m.VacancyID, m.ResumeID, err)
+			}
+		}
+
+		for _, e := range d.HiddenEmployers {
+			if err := exec(
+				`insert into hidden_employers (user_id, employer_id, name, hidden_at) values (?, ?, ?, ?)`,
+				e.UserID, e.EmployerID, e.Name, formatTime(e.HiddenAt),
+			); err != nil {
+				return fmt.Errorf("hidden employer %s of %s: %w", e.EmployerID, e.UserID, err)
+			}
+		}
+
+		// searches get new ids like runs do
+		searchIDs := make(map[int64]int64, len(d.Searches))
+		for _, ss := range d.Searches {
+			var id int64
+			if err := tx.QueryRowContext(
+				ctx,
+				s.d.rebind(`
+				insert into saved_searches (user_id, name, text, area, salary, experience, schedule, created_at, last_run_at, last_error)
+				values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) returning id
+				`),
+				ss.UserID, ss.Name, ss.Text, ss.Area, ss.Salary, ss.Experience, ss.Schedule,
+				formatTime(ss.CreatedAt), formatTime(ss.LastRunAt), ss.LastError,
+			).Scan(&id); err != nil {
+				return fmt.Errorf("search %d: %w", ss.ID, err)
+			}
+			searchIDs[ss.ID] = id
+		}
+
+		for _, r := range d.SearchResults {
+			id, ok := searchIDs[r.SearchID]
+			if !ok {
+				continue
+			}
+			if err := exec(
+				`insert into search_results (search_id, vacancy_id, user_id, name, employer_id, employer, url, salary, area, published_at, first_seen_at)
+				values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				id, r.VacancyID, r.UserID, r.Name, r.EmployerID, r.Employer, r.URL, r.Salary, r.Area,
+				formatTime(r.PublishedAt), formatTime(r.FirstSeenAt),
+			); err != nil {
+				return fmt.Errorf("result %s of search %d: %w", r.VacancyID, r.SearchID, err)
+			}
+		}
+
+		for _, l := range d.CoverLetters {
+			if err := exec(
+				`insert into cover_letters (user_id, name, body, created_at) values (?, ?, ?, ?)`,
+				l.UserID, l.Name, l.Body, formatTime(l.CreatedAt),
+			); err != nil {
+				return fmt.Errorf("cover letter %d: %w", l.ID, err)
+			}
+		}
+
+		for _, a := range d.Applications {
+			if err := exec(
+				`insert into applications (user_id, resume_id, vacancy_id, vacancy_name, employer, message, created_at, status, negotiation_id, error)
+				values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				a.UserID, a.ResumeID, a.VacancyID, a.VacancyName, a.Employer, a.Message,
+				formatTime(a.CreatedAt), a.Status, a.NegotiationID, a.Error,
+			); err != nil {
+				return fmt.Errorf("application %d: %w", a.ID, err)
+			}
+		}
+
+		for _, n := range d.Negotiations {
+			if err := exec(
+				`insert into negotiations (id, user_id, resume_id, vacancy_id, vacancy_name, employer, url, state, viewed, stage, created_at, updated_at)
+				values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				n.ID, n.UserID, n.ResumeID, n.VacancyID, n.VacancyName, n.Employer, n.URL,
+				n.State, boolToInt(n.Viewed), n.Stage, formatTime(n.CreatedAt), formatTime(n.UpdatedAt),
+			); err != nil {
+				return fmt.Errorf("negotiation %s: %w", n.ID, err)
+			}
+		}
+
+		for _, c := range d.NegotiationChanges {
+			if err := exec(
+				`insert into negotiation_changes (negotiation_id, user_id, vacancy_name, timestamp, from_stage, to_stage) values (?, ?, ?, ?, ?, ?)`,
+				c.NegotiationID, c.UserID, c.VacancyName, formatTime(c.Timestamp), c.From, c.To,
+			); err != nil {
+				return fmt.Errorf("negotiation change %d: %w", c.ID, err)
+			}
+		}
+
+		// notifications come back read, they were seen or missed on the old host
+		for _, n := range d.Notifications {
+			if err := exec(
+				`insert into notifications (user_id, created_at, kind, text, url, read_at) values (?, ?, ?, ?, ?, ?)`,
+				n.UserID, formatTime(n.CreatedAt), n.Kind, n.Text, n.URL, formatTime(d.ExportedAt),
+			); err != nil {
+				return fmt.Errorf("notification %d: %w", n.ID, err)
+			}
+		}
+
+		for _, e := range d.Audit {
+			if err := exec(
+				`insert into audit_log (timestamp, actor, action, user_id, target, ip, user_agent, details) values (?, ?, ?, ?, ?, ?, ?, ?)`,
+				formatTime(e.Timestamp), e.Actor, e.Action, e.UserID, e.Target, e.IP, e.UserAgent, e.Details,
+			); err != nil {
+				return fmt.Errorf("audit event %d: %w", e.ID, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// importToken opens a token with the dump key and seals it with ENCRYPTION_KEY
+func (s *sqlStore) importToken(exec func(query string, args ...any) error, dt DumpToken, dumpKey string) error {
+	var t Token
+	var err error
+	if t.AccessToken, err = decryptWith(dumpKey, dt.AccessToken); err != nil {
+		return fmt.Errorf("access token: %w", err)
+	}
+	if t.RefreshToken, err = decryptWith(dumpKey, dt.RefreshToken); err != nil {
+		return fmt.Errorf("refresh token: %w", err)
+	}
+
+	at, rt, err := encryptToken(&t)
+	if err != nil {
+		return err
+	}
+
+	return exec(
+		`insert into tokens (access_token, refresh_token, expires_in, user_id, obtained_at) values (?, ?, ?, ?, ?)`,
+		at, rt, dt.ExpiresIn, dt.UserID, formatTime(dt.ObtainedAt),
+	)
+}
@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const matchColumns = `m.resume_id, m.vacancy_id, m.user_id, coalesce(m.name, ''), coalesce(m.employer_id, ''), coalesce(m.employer, ''),
+	coalesce(m.url, ''), coalesce(m.salary, ''), coalesce(m.area, ''), coalesce(m.published_at, ''), m.first_seen_at, m.interesting`
+
+func scanMatches(rows *sql.Rows) ([]Match, error) {
+	var matches []Match
+	for rows.Next() {
+		var m Match
+		var publishedAt, firstSeenAt string
+		if err := rows.Scan(
+			&m.ResumeID, &m.VacancyID, &m.UserID, &m.Name, &m.EmployerID, &m.Employer,
+			&m.URL, &m.Salary, &m.Area, &publishedAt, &firstSeenAt, &m.Interesting,
+		); err != nil {
+			return nil, err
+		}
+		m.PublishedAt = parseTime(publishedAt)
+		m.FirstSeenAt = parseTime(firstSeenAt)
+		matches = append(matches, m)
+	}
+
+	return matches, rows.Err()
+}
+
+func (s *sqlStore) SaveMatches(ctx context.Context, userID, resumeID string, matches []Match) (int, error) {
+	var added int
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, s.d.rebind(`
+		insert into resume_matches (resume_id, vacancy_id, user_id, name, employer_id, employer, url, salary, area, published_at, first_seen_at)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on conflict(resume_id, vacancy_id) do nothing
+		`))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		update, err := tx.PrepareContext(ctx, s.d.rebind(`
+		update resume_matches set name = ?, employer = ?, url = ?, salary = ?, area = ?, published_at = ?
+		where resume_id = ? and vacancy_id = ?
+		`))
+		if err != nil {
+			return err
+		}
+		defer update.Close()
+
+		added = 0
+		now := formatTime(time.Now())
+		for _, m := range matches {
+			res, err := stmt.ExecContext(
+				ctx, resumeID, m.VacancyID, userID, m.Name, m.EmployerID, m.Employer, m.URL, m.Salary, m.Area, formatTime(m.PublishedAt), now,
+			)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err == nil && n > 0 {
+				added++
+				continue
+			}
+
+			if _, err := update.ExecContext(
+				ctx, m.Name, m.Employer, m.URL, m.Salary, m.Area, formatTime(m.PublishedAt), resumeID, m.VacancyID,
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return added, err
+}
+
+func (s *sqlStore) ListMatches(ctx context.Context, userID, resumeID string) ([]Match, error) {
+	query := `
+	select ` + matchColumns + `
+	from resume_matches m
+	where m.user_id = ? and m.resume_id = ?
+	and not exists (select 1 from hidden_employers h where h.user_id = m.user_id and h.employer_id = m.employer_id)
+	order by m.first_seen_at desc, m.published_at desc
+	`
+	rows, err := s.query(ctx, query, userID, resumeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMatches(rows)
+}
+
+func (s *sqlStore) CountNewMatches(ctx context.Context, userID string) (map[string]int, error) {
+	query := `
+	select m.resume_id, count(*)
+	from resume_matches m
+	join resumes r on r.id = m.resume_id
+	where m.user_id = ?
+	and (r.matches_seen_at is null or m.first_seen_at > r.matches_seen_at)
+	and not exists (select 1 from hidden_employers h where h.user_id = m.user_id and h.employer_id = m.employer_id)
+	group by m.resume_id
+	`
+	rows, err := s.query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var resumeID string
+		var n int
+		if err := rows.Scan(&resumeID, &n); err != nil {
+			return nil, err
+		}
+		counts[resumeID] = n
+	}
+
+	return counts, rows.Err()
+}
+
+func (s *sqlStore) MarkMatchesSeen(ctx context.Context, userID, resumeID string) (time.Time, error) {
+	var previous time.Time
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var seenAt string
+		err := tx.QueryRowContext(
+			ctx,
+			s.d.rebind(`select coalesce(matches_seen_at, '') from resumes where id = ? and user_id = ?`),
+			resumeID, userID,
+		).Scan(&seenAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		previous = parseTime(seenAt)
+
+		_, err = tx.ExecContext(
+			ctx,
+			s.d.rebind(`update resumes set matches_seen_at = ? where id = ? and user_id = ?`),
+			formatTime(time.Now()), resumeID, userID,
+		)
+		return err
+	})
+
+	return previous, err
+}
+
+func (s *sqlStore) SetMatchInteresting(ctx context.Context, userID, resumeID, vacancyID string, interesting bool) error {
+	res, err := s.exec(
+		ctx,
+		`update resume_matches set interesting = ? where user_id = ? and resume_id = ? and vacancy_id = ?`,
+		boolToInt(interesting), userID, resumeID, vacancyID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *sqlStore) HideEmployer(ctx context.Context, e *HiddenEmployer) error {
+	if e.HiddenAt.IsZero() {
+		e.HiddenAt = time.Now()
+	}
+
+	query := `
+	insert into hidden_employers (user_id, employer_id, name, hidden_at) values (?, ?, ?, ?)
+	on conflict(user_id, employer_id) do update set name = excluded.name
+	`
+	_, err := s.exec(ctx, query, e.UserID, e.EmployerID, e.Name, formatTime(e.HiddenAt))
+	return err
+}
+
+func (s *sqlStore) UnhideEmployer(ctx context.Context, userID, employerID string) error {
+	res, err := s.exec(ctx, `delete from hidden_employers where user_id = ? and employer_id = ?`, userID, employerID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *sqlStore) ListHiddenEmployers(ctx context.Context, userID string) ([]HiddenEmployer, error) {
+	rows, err := s.query(ctx, `
+	select user_id, employer_id, coalesce(name, ''), hidden_at
+	from hidden_employers
+	where user_id = ?
+	order by name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanHiddenEmployers(rows)
+}
+
+func scanHiddenEmployers(rows *sql.Rows) ([]HiddenEmployer, error) {
+	var employers []HiddenEmployer
+	for rows.Next() {
+		var e HiddenEmployer
+		var hiddenAt string
+		if err := rows.Scan(&e.UserID, &e.EmployerID, &e.Name, &hiddenAt); err != nil {
+			return nil, err
+		}
+		e.HiddenAt = parseTime(hiddenAt)
+		employers = append(employers, e)
+	}
+
+	return employers, rows.Err()
+}
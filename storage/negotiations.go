@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const negotiationColumns = `id, user_id, coalesce(resume_id, ''), coalesce(vacancy_id, ''), coalesce(vacancy_name, ''),
+	coalesce(employer, ''), coalesce(url, ''), state, viewed, stage, coalesce(created_at, ''), coalesce(updated_at, '')`
+
+func scanNegotiation(scan func(dest ...any) error) (Negotiation, error) {
+	var n Negotiation
+	var createdAt, updatedAt string
+	if err := scan(
+		&n.ID, &n.UserID, &n.ResumeID, &n.VacancyID, &n.VacancyName,
+		&n.Employer, &n.URL, &n.State, &n.Viewed, &n.Stage, &createdAt, &updatedAt,
+	); err != nil {
+		return n, err
+	}
+	n.CreatedAt = parseTime(createdAt)
+	n.UpdatedAt = parseTime(updatedAt)
+
+	return n, nil
+}
+
+func (s *sqlStore) SaveNegotiations(ctx context.Context, userID string, negotiations []Negotiation) ([]NegotiationChange, error) {
+	var changes []NegotiationChange
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, s.d.rebind(`select id, stage from negotiations where user_id = ?`), userID)
+		if err != nil {
+			return err
+		}
+		stages := make(map[string]string)
+		for rows.Next() {
+			var id, stage string
+			if err := rows.Scan(&id, &stage); err != nil {
+				rows.Close()
+				return err
+			}
+			stages[id] = stage
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// worked out again on every attempt, withTx may retry
+		changes = nil
+		for _, n := range negotiations {
+			n.UserID = userID
+			if n.Stage == "" {
+				n.Stage = NegotiationStage(n.State, n.Viewed)
+			}
+
+			if _, err := tx.ExecContext(ctx, s.d.rebind(`
+			insert into negotiations (id, user_id, resume_id, vacancy_id, vacancy_name, employer, url, state, viewed, stage, created_at, updated_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			on conflict(id) do update set
+			resume_id = excluded.resume_id,
+			vacancy_name = excluded.vacancy_name,
+			employer = excluded.employer,
+			url = excluded.url,
+			state = excluded.state,
+			viewed = excluded.viewed,
+			stage = excluded.stage,
+			updated_at = excluded.updated_at
+			`),
+				n.ID, userID, n.ResumeID, n.VacancyID, n.VacancyName, n.Employer, n.URL,
+				n.State, boolToInt(n.Viewed), n.Stage, formatTime(n.CreatedAt), formatTime(n.UpdatedAt),
+			); err != nil {
+				return err
+			}
+
+			from, seen := stages[n.ID]
+			if seen && from == n.Stage {
+				continue
+			}
+
+			// hh moves updated_at when the state changes, it is closer than now
+			c := NegotiationChange{NegotiationID: n.ID, UserID: userID, VacancyName: n.VacancyName, Timestamp: n.UpdatedAt, From: from, To: n.Stage}
+			if c.Timestamp.IsZero() {
+				c.Timestamp = time.Now()
+			}
+			if _, err := tx.ExecContext(
+				ctx,
+				s.d.rebind(`insert into negotiation_changes (negotiation_id, user_id, vacancy_name, timestamp, from_stage, to_stage) values (?, ?, ?, ?, ?, ?)`),
+				c.NegotiationID, userID, c.VacancyName, formatTime(c.Timestamp), c.From, c.To,
+			); err != nil {
+				return err
+			}
+			changes = append(changes, c)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+func (s *sqlStore) ListNegotiations(ctx context.Context, userID string) ([]Negotiation, error) {
+	rows, err := s.query(ctx, `select `+negotiationColumns+` from negotiations where user_id = ? order by updated_at desc, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var negotiations []Negotiation
+	for rows.Next() {
+		n, err := scanNegotiation(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		negotiations = append(negotiations, n)
+	}
+
+	return negotiations, rows.Err()
+}
+
+func (s *sqlStore) ListNegotiationChanges(ctx context.Context, userID string, limit int) ([]NegotiationChange, error) {
+	query := `
+	select id, negotiation_id, user_id, coalesce(vacancy_name, ''), timestamp, coalesce(from_stage, ''), to_stage
+	from negotiation_changes
+	where user_id = ?
+	order by timestamp desc, id desc
+	limit ?
+	`
+	rows, err := s.query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNegotiationChanges(rows)
+}
+
+func scanNegotiationChanges(rows *sql.Rows) ([]NegotiationChange, error) {
+	var changes []NegotiationChange
+	for rows.Next() {
+		var c NegotiationChange
+		var timestamp string
+		if err := rows.Scan(&c.ID, &c.NegotiationID, &c.UserID, &c.VacancyName, &timestamp, &c.From, &c.To); err != nil {
+			return nil, err
+		}
+		c.Timestamp = parseTime(timestamp)
+		changes = append(changes, c)
+	}
+
+	return changes, rows.Err()
+}
+
+func (s *sqlStore) AddNotification(ctx context.Context, n *Notification) error {
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+
+	query := `insert into notifications (user_id, created_at, kind, text, url) values (?, ?, ?, ?, ?)`
+	_, err := s.exec(ctx, query, n.UserID, formatTime(n.CreatedAt), n.Kind, n.Text, n.URL)
+	return err
+}
+
+func (s *sqlStore) ListNotifications(ctx context.Context, userID string, limit int) ([]Notification, error) {
+	query := `
+	select id, user_id, created_at, kind, text, coalesce(url, ''), read_at is not null
+	from notifications
+	where user_id = ?
+	order by id desc
+	limit ?
+	`
+	rows, err := s.query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNotifications(rows)
+}
+
+func scanNotifications(rows *sql.Rows) ([]Notification, error) {
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		var createdAt string
+		if err := rows.Scan(&n.ID, &n.UserID, &createdAt, &n.Kind, &n.Text, &n.URL, &n.Read); err != nil {
+			return nil, err
+		}
+		n.CreatedAt = parseTime(createdAt)
+		notifications = append(notifications, n)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (s *sqlStore) CountUnreadNotifications(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := s.queryRow(ctx, `select count(*) from notifications where user_id = ? and read_at is null`, userID).Scan(&n)
+	return n, err
+}
+
+func (s *sqlStore) MarkNotificationsRead(ctx context.Context, userID string) error {
+	_, err := s.exec(ctx, `update notifications set read_at = ? where user_id = ? and read_at is null`, formatTime(time.Now()), userID)
+	return err
+}
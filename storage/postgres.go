@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func openPostgres(ctx context.Context, url string) (Repository, error) {
+	if url == "" {
+		return nil, fmt.Errorf("storage: no postgres connection url")
+	}
+
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s, err := newSQLStore(ctx, db, postgresDialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
@@ -0,0 +1,1349 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hhcv/storage"
+)
+
+const (
+	testKey  = "0123456789abcdef0123456789abcdef"
+	otherKey = "fedcba9876543210fedcba9876543210"
+	dumpKey  = "dump-key-dump-key-dump-key-12345"
+)
+
+// backend opens an empty repository, every call gets a database of its own
+type backend struct {
+	name string
+	open func(t *testing.T) storage.Repository
+}
+
+// backends is sqlite in a temp dir, and postgres when DATABASE_URL is set,
+// each postgres repository lives in a schema dropped after the test
+func backends(t *testing.T) []backend {
+	t.Helper()
+
+	list := []backend{{name: storage.DriverSQLite, open: openSQLite}}
+	if os.Getenv("DATABASE_URL") != "" {
+		list = append(list, backend{name: storage.DriverPostgres, open: openPostgres})
+	}
+
+	return list
+}
+
+func openSQLite(t *testing.T) storage.Repository {
+	t.Helper()
+
+	return open(t, storage.Config{Driver: storage.DriverSQLite, DSN: filepath.Join(t.TempDir(), "db.sqlite")})
+}
+
+func openPostgres(t *testing.T) storage.Repository {
+	t.Helper()
+
+	base := os.Getenv("DATABASE_URL")
+	db, err := sql.Open("pgx", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := db.Exec(`create schema ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.Exec(`drop schema ` + schema + ` cascade`); err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+	})
+
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	return open(t, storage.Config{Driver: storage.DriverPostgres, DSN: u.String()})
+}
+
+func open(t *testing.T, cfg storage.Config) storage.Repository {
+	t.Helper()
+
+	repo, err := storage.Open(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("open %s: %v", cfg.Driver, err)
+	}
+	t.Cleanup(func() { repo.Close() })
+
+	return repo
+}
+
+// forEachBackend runs fn against a fresh repository of every backend
+func forEachBackend(t *testing.T, fn func(t *testing.T, b backend, repo storage.Repository)) {
+	t.Setenv("ENCRYPTION_KEY", testKey)
+
+	for _, b := range backends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			fn(t, b, b.open(t))
+		})
+	}
+}
+
+func mustUser(t *testing.T, repo storage.Repository, id, first, last string) {
+	t.Helper()
+
+	if err := repo.UpsertUser(context.Background(), &storage.User{ID: id, FirstName: first, LastName: last}); err != nil {
+		t.Fatalf("upsert user %s: %v", id, err)
+	}
+}
+
+func mustToken(t *testing.T, repo storage.Repository, userID string) {
+	t.Helper()
+
+	token := &storage.Token{AccessToken: "at-" + userID, RefreshToken: "rt-" + userID, ExpiresIn: 3600}
+	if err := repo.SaveToken(context.Background(), userID, "code-"+userID, token); err != nil {
+		t.Fatalf("save token of %s: %v", userID, err)
+	}
+}
+
+func resume(id, title string) storage.Resume {
+	created := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	return storage.Resume{
+		ID:           id,
+		Title:        title,
+		AlternateURL: "https://hh.ru/resume/" + id,
+		CreatedAt:    created,
+		UpdatedAt:    created,
+		Status:       storage.ResumePublished,
+		Visibility:   storage.VisibilityEveryone,
+	}
+}
+
+func TestUsers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+
+		if _, err := repo.GetUser(ctx, "u1"); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("get missing user: got %v, want ErrNotFound", err)
+		}
+
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		mustUser(t, repo, "u2", "Anna", "Ivanova")
+		// a second upsert renames, it does not add a user
+		mustUser(t, repo, "u1", "Ivan", "Sidorov")
+		mustToken(t, repo, "u1")
+
+		u, err := repo.GetUser(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.LastName != "Sidorov" || u.IsDisabled || u.ScheduleMode != storage.ScheduleFixed {
+			t.Errorf("get user: got %+v", u)
+		}
+
+		users, err := repo.ListUsers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, u := range users {
+			got = append(got, u.ID+":"+u.TokenStatus)
+		}
+		if want := "u2:missing,u1:ok"; strings.Join(got, ",") != want {
+			t.Errorf("list users: got %s, want %s", strings.Join(got, ","), want)
+		}
+	})
+}
+
+func TestTokens(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+
+		if _, err := repo.GetToken(ctx, "u1"); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("get missing token: got %v, want ErrNotFound", err)
+		}
+
+		mustToken(t, repo, "u1")
+		// a refresh saves without a code, the first one is kept
+		fresh := &storage.Token{AccessToken: "at2", RefreshToken: "rt2", ExpiresIn: 60}
+		if err := repo.SaveToken(ctx, "u1", "", fresh); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := repo.GetToken(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.AccessToken != "at2" || got.RefreshToken != "rt2" || got.ExpiresIn != 60 {
+			t.Errorf("get token: got %+v", got)
+		}
+		if got.ObtainedAt.IsZero() {
+			t.Error("get token: no obtained_at")
+		}
+
+		t.Setenv("ENCRYPTION_KEY", otherKey)
+		if _, err := repo.GetToken(ctx, "u1"); !errors.Is(err, storage.ErrTokenBroken) {
+			t.Errorf("get token under another key: got %v, want ErrTokenBroken", err)
+		}
+
+		users, err := repo.ListUsers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 || users[0].TokenStatus != storage.TokenBroken {
+			t.Errorf("list users under another key: got %+v", users)
+		}
+	})
+}
+
+func TestReplaceResumes(t *testing.T) {
+	blocked := resume("r2", "Go lead")
+	blocked.Status = storage.ResumeBlocked
+	blocked.ModerationNote = "Salary is unrealistic"
+
+	renamed := resume("r1", "Senior Go developer")
+
+	tests := []struct {
+		name    string
+		resumes []storage.Resume
+		want    storage.ResumeDiff
+	}{
+		{
+			name:    "first sync adds",
+			resumes: []storage.Resume{resume("r1", "Go developer"), resume("r2", "Go lead")},
+			want:    storage.ResumeDiff{Added: []string{"Go developer", "Go lead"}},
+		},
+		{
+			name:    "same resumes change nothing",
+			resumes: []storage.Resume{resume("r1", "Go developer"), resume("r2", "Go lead")},
+		},
+		{
+			name:    "moderation blocks one",
+			resumes: []storage.Resume{resume("r1", "Go developer"), blocked},
+			want:    storage.ResumeDiff{Updated: []string{"Go lead"}, Blocked: []string{"Go lead"}},
+		},
+		{
+			name:    "still blocked is not blocked again",
+			resumes: []storage.Resume{resume("r1", "Go developer"), blocked},
+		},
+		{
+			name:    "rename and removal",
+			resumes: []storage.Resume{renamed},
+			want:    storage.ResumeDiff{Updated: []string{"Senior Go developer"}, Removed: []string{"Go lead"}},
+		},
+	}
+
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+
+		for i, tt := range tests {
+			diff, err := repo.ReplaceResumes(ctx, "u1", tt.resumes)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if !reflect.DeepEqual(diff, tt.want) {
+				t.Errorf("%s: got %+v, want %+v", tt.name, diff, tt.want)
+			}
+
+			// is_scheduled is ours, syncs keep it
+			if i == 0 {
+				if err := repo.SetResumeScheduled(ctx, "u1", "r1", true); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		r, err := repo.GetResume(ctx, "u1", "r1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Title != "Senior Go developer" || !r.IsScheduled {
+			t.Errorf("get resume after syncs: got %+v", r)
+		}
+		if _, err := repo.GetResume(ctx, "u1", "r2"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("get removed resume: got %v, want ErrNotFound", err)
+		}
+
+		users, err := repo.ListUsers(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 || time.Since(users[0].SyncedAt) > time.Minute {
+			t.Errorf("synced at after syncs: got %+v", users)
+		}
+	})
+}
+
+func TestListDueResumes(t *testing.T) {
+	hidden := resume("r3", "Hidden")
+	hidden.Visibility = storage.VisibilityNoOne
+	blocked := resume("r2", "Blocked")
+	blocked.Status = storage.ResumeBlocked
+	blocked.ModerationNote = "Photo missing"
+	unpublished := resume("r4", "Draft")
+	unpublished.Status = storage.ResumeNotPublished
+
+	want := map[string]string{
+		"r1": "",
+		"r2": "blocked by hh moderation: Photo missing",
+		"r3": "hidden from everyone on hh",
+		"r4": "not published on hh",
+	}
+
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		mustToken(t, repo, "u1")
+		mustUser(t, repo, "u2", "Anna", "Ivanova")
+		mustToken(t, repo, "u2")
+
+		if _, err := repo.ReplaceResumes(ctx, "u1", []storage.Resume{resume("r1", "Go developer"), blocked, hidden, unpublished}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.ReplaceResumes(ctx, "u2", []storage.Resume{resume("r5", "Disabled")}); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []string{"r1", "r2", "r3", "r4"} {
+			if err := repo.SetResumeScheduled(ctx, "u1", id, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := repo.SetResumeScheduled(ctx, "u2", "r5", true); err != nil {
+			t.Fatal(err)
+		}
+		// disabled users are not due
+		if err := repo.SetUserDisabled(ctx, "u2", true); err != nil {
+			t.Fatal(err)
+		}
+
+		due, err := repo.ListDueResumes(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != len(want) {
+			t.Fatalf("due resumes: got %d, want %d: %+v", len(due), len(want), due)
+		}
+		for _, d := range due {
+			reason, ok := want[d.ResumeID]
+			if !ok {
+				t.Errorf("resume %s is due", d.ResumeID)
+				continue
+			}
+			if d.SkipReason != reason {
+				t.Errorf("skip reason of %s: got %q, want %q", d.ResumeID, d.SkipReason, reason)
+			}
+			if d.Token.AccessToken != "at-u1" || d.Error != "" {
+				t.Errorf("token of %s: got %+v, error %q", d.ResumeID, d.Token, d.Error)
+			}
+		}
+	})
+}
+
+func TestRuns(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+
+		first := &storage.Run{Trigger: "cron", Version: "v1"}
+		if err := repo.StartRun(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+		second := &storage.Run{Trigger: "manual", Version: "v1"}
+		if err := repo.StartRun(ctx, second); err != nil {
+			t.Fatal(err)
+		}
+		if first.ID == 0 || second.ID <= first.ID {
+			t.Fatalf("run ids: got %d and %d", first.ID, second.ID)
+		}
+
+		for _, a := range []storage.Attempt{
+			{RunID: first.ID, UserID: "u1", ResumeID: "r1", ResumeTitle: "Go developer", Status: "ok"},
+			{RunID: first.ID, UserID: "u1", ResumeID: "r2", ResumeTitle: "Go lead", Status: "failed", Error: "too many bumps"},
+			{RunID: first.ID, UserID: "u2", ResumeID: "r3", ResumeTitle: "Go lead", Status: "failed", Error: "too many bumps"},
+		} {
+			a.Timestamp = time.Now()
+			if err := repo.AddAttempt(ctx, &a); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		first.Attempted, first.Succeeded, first.Failed = 3, 1, 2
+		if err := repo.FinishRun(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+
+		runs, err := repo.ListRuns(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) != 2 {
+			t.Fatalf("runs: got %d, want 2", len(runs))
+		}
+		// newest first, the unfinished one has no finish time
+		if runs[0].ID != second.ID || !runs[0].FinishedAt.IsZero() {
+			t.Errorf("latest run: got %+v", runs[0])
+		}
+		got := runs[1]
+		if got.ID != first.ID || got.Trigger != "cron" || got.Attempted != 3 || got.Succeeded != 1 || got.Failed != 2 || got.FinishedAt.IsZero() {
+			t.Errorf("finished run: got %+v", got)
+		}
+		if len(got.Failures) != 1 || got.Failures[0].Count != 2 {
+			t.Errorf("failures of finished run: got %+v", got.Failures)
+		}
+
+		attempts, err := repo.ListAttempts(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(attempts) != 3 {
+			t.Errorf("attempts: got %d, want 3", len(attempts))
+		}
+
+		if runs, err := repo.ListRuns(ctx, 1); err != nil || len(runs) != 1 {
+			t.Errorf("runs with limit 1: got %d, %v", len(runs), err)
+		}
+	})
+}
+
+func TestPruneAudit(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		now := time.Now()
+
+		for _, age := range []time.Duration{400 * 24 * time.Hour, 100 * 24 * time.Hour, time.Hour} {
+			e := &storage.AuditEvent{Timestamp: now.Add(-age), Actor: "u1", Action: "login", UserID: "u1"}
+			if err := repo.AddAudit(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		pruned, err := repo.PruneAudit(ctx, now.Add(-90*24*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pruned != 2 {
+			t.Errorf("pruned: got %d, want 2", pruned)
+		}
+
+		events, err := repo.ListAudit(ctx, "", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || now.Sub(events[0].Timestamp) > 2*time.Hour {
+			t.Errorf("left after pruning: got %+v", events)
+		}
+	})
+}
+
+func TestPurgeUser(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		mustToken(t, repo, "u1")
+		mustUser(t, repo, "u2", "Anna", "Ivanova")
+		if _, err := repo.ReplaceResumes(ctx, "u1", []storage.Resume{resume("r1", "Go developer")}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.AddAttempt(ctx, &storage.Attempt{UserID: "u1", ResumeID: "r1", Timestamp: time.Now(), Status: "ok"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.AddAudit(ctx, &storage.AuditEvent{Actor: "u1", Action: "login", UserID: "u1", IP: "10.0.0.1", UserAgent: "Firefox"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.AddAudit(ctx, &storage.AuditEvent{Actor: "u2", Action: "login", UserID: "u2", IP: "10.0.0.2", UserAgent: "Chrome"}); err != nil {
+			t.Fatal(err)
+		}
+
+		tomb := &storage.Tombstone{UserID: "u1", Actor: "u1", Revoked: true, Details: "1 resume"}
+		if err := repo.PurgeUser(ctx, tomb); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := repo.GetUser(ctx, "u1"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("get purged user: got %v, want ErrNotFound", err)
+		}
+		if _, err := repo.GetToken(ctx, "u1"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("get token of purged user: got %v, want ErrNotFound", err)
+		}
+		if resumes, err := repo.ListResumes(ctx, "u1"); err != nil || len(resumes) != 0 {
+			t.Errorf("resumes of purged user: got %d, %v", len(resumes), err)
+		}
+		if attempts, err := repo.ListAttempts(ctx, 10); err != nil || len(attempts) != 0 {
+			t.Errorf("attempts of purged user: got %d, %v", len(attempts), err)
+		}
+		// the audit log outlives the user, where they came from does not
+		events, err := repo.ListAudit(ctx, "u1", 10)
+		if err != nil || len(events) != 1 {
+			t.Fatalf("audit of purged user: got %d, %v", len(events), err)
+		}
+		if events[0].IP != "" || events[0].UserAgent != "" || events[0].Action != "login" {
+			t.Errorf("audit of purged user: got %+v", events[0])
+		}
+		if events, err := repo.ListAudit(ctx, "u2", 10); err != nil || len(events) != 1 || events[0].IP != "10.0.0.2" || events[0].UserAgent != "Chrome" {
+			t.Errorf("audit of other user: got %+v, %v", events, err)
+		}
+		if _, err := repo.GetUser(ctx, "u2"); err != nil {
+			t.Errorf("get other user: %v", err)
+		}
+
+		tombstones, err := repo.ListTombstones(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tombstones) != 1 {
+			t.Fatalf("tombstones: got %d, want 1", len(tombstones))
+		}
+		got := tombstones[0]
+		if got.UserID != "u1" || got.Actor != "u1" || !got.Revoked || got.Details != "1 resume" || got.DeletedAt.IsZero() {
+			t.Errorf("tombstone: got %+v", got)
+		}
+	})
+}
+
+func TestExportImport(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		mustToken(t, repo, "u1")
+		mustUser(t, repo, "u2", "Anna", "Ivanova")
+		if err := repo.SetTimeZone(ctx, "u2", "Asia/Yekaterinburg"); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.LinkAccount(ctx, "u1", "u2"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.ReplaceResumes(ctx, "u1", []storage.Resume{resume("r1", "Go developer"), resume("r2", "Go lead")}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.SetResumeScheduled(ctx, "u1", "r1", true); err != nil {
+			t.Fatal(err)
+		}
+		run := &storage.Run{Trigger: "cron", Version: "v1"}
+		if err := repo.StartRun(ctx, run); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.AddAttempt(ctx, &storage.Attempt{RunID: run.ID, UserID: "u1", ResumeID: "r1", ResumeTitle: "Go developer", Timestamp: time.Now(), Status: "ok"}); err != nil {
+			t.Fatal(err)
+		}
+		run.Attempted, run.Succeeded = 1, 1
+		if err := repo.FinishRun(ctx, run); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.AddAudit(ctx, &storage.AuditEvent{Actor: "u1", Action: "login", UserID: "u1"}); err != nil {
+			t.Fatal(err)
+		}
+
+		dump, err := repo.Export(ctx, dumpKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(dump.Tokens) != 1 {
+			t.Fatalf("exported tokens: got %d, want 1", len(dump.Tokens))
+		}
+
+		// dumps go through a file in real use
+		raw, err := json.Marshal(dump)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var loaded storage.Dump
+		if err := json.Unmarshal(raw, &loaded); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := repo.Import(ctx, &loaded, dumpKey); !errors.Is(err, storage.ErrNotEmpty) {
+			t.Errorf("import into a used database: got %v, want ErrNotEmpty", err)
+		}
+
+		target := b.open(t)
+		if err := target.Import(ctx, &loaded, dumpKey); err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := target.GetToken(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != "at-u1" || token.RefreshToken != "rt-u1" {
+			t.Errorf("imported token: got %+v", token)
+		}
+
+		again, err := target.Export(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dump.Tokens, dump.ExportedAt, again.ExportedAt = nil, time.Time{}, time.Time{}
+		if got, want := mustJSON(t, again), mustJSON(t, dump); got != want {
+			t.Errorf("round trip changed the dump:\ngot  %s\nwant %s", got, want)
+		}
+
+		if err := target.Import(ctx, &loaded, ""); err == nil {
+			t.Error("import of tokens without a key: no error")
+		}
+	})
+}
+
+func TestAccountLinks(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		mustUser(t, repo, "u2", "Anna", "Ivanova")
+		mustUser(t, repo, "u3", "Oleg", "Sidorov")
+
+		for _, userID := range []string{"u2", "u3", "u2"} {
+			if err := repo.LinkAccount(ctx, "u1", userID); err != nil {
+				t.Fatalf("link %s: %v", userID, err)
+			}
+		}
+
+		linked, err := repo.ListLinkedAccounts(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(linked) != 2 || linked[0].ID != "u2" || linked[0].FirstName != "Anna" || linked[1].ID != "u3" {
+			t.Errorf("linked accounts: got %+v", linked)
+		}
+		// links go one way
+		if linked, err := repo.ListLinkedAccounts(ctx, "u2"); err != nil || len(linked) != 0 {
+			t.Errorf("accounts linked to u2: got %+v, %v", linked, err)
+		}
+
+		if err := repo.UnlinkAccount(ctx, "u1", "u2"); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.UnlinkAccount(ctx, "u1", "u2"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("unlink twice: got %v, want ErrNotFound", err)
+		}
+		if linked, err := repo.ListLinkedAccounts(ctx, "u1"); err != nil || len(linked) != 1 || linked[0].ID != "u3" {
+			t.Errorf("linked accounts after unlink: got %+v, %v", linked, err)
+		}
+	})
+}
+
+func TestNegotiations(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		created := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+
+		n1 := storage.Negotiation{ID: "n1", ResumeID: "r1", VacancyID: "v1", VacancyName: "Go developer", Employer: "Acme", State: "response", CreatedAt: created, UpdatedAt: created}
+		n2 := storage.Negotiation{ID: "n2", ResumeID: "r1", VacancyID: "v2", VacancyName: "Go lead", State: "response", CreatedAt: created, UpdatedAt: created.Add(time.Hour)}
+		changes, err := repo.SaveNegotiations(ctx, "u1", []storage.Negotiation{n1, n2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 2 || changes[0].From != "" || changes[0].To != storage.StageApplied {
+			t.Errorf("first save: got %+v", changes)
+		}
+
+		// the same stage again is no change, a viewed one moves
+		n1.Viewed, n1.UpdatedAt = true, created.Add(2*time.Hour)
+		changes, err = repo.SaveNegotiations(ctx, "u1", []storage.Negotiation{n1, n2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 1 || changes[0].NegotiationID != "n1" || changes[0].From != storage.StageApplied ||
+			changes[0].To != storage.StageViewed || !changes[0].Timestamp.Equal(n1.UpdatedAt) {
+			t.Errorf("second save: got %+v", changes)
+		}
+
+		n2.State, n2.UpdatedAt = "invitation", created.Add(3*time.Hour)
+		if _, err := repo.SaveNegotiations(ctx, "u1", []storage.Negotiation{n2}); err != nil {
+			t.Fatal(err)
+		}
+
+		negotiations, err := repo.ListNegotiations(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(negotiations) != 2 {
+			t.Fatalf("negotiations: got %d, want 2", len(negotiations))
+		}
+		if got := negotiations[0]; got.ID != "n2" || got.Stage != storage.StageInvited || got.UserID != "u1" {
+			t.Errorf("latest updated negotiation: got %+v", got)
+		}
+		if got := negotiations[1]; !got.Viewed || got.Employer != "Acme" || !got.CreatedAt.Equal(created) {
+			t.Errorf("viewed negotiation: got %+v", got)
+		}
+
+		history, err := repo.ListNegotiationChanges(ctx, "u1", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 4 || history[0].NegotiationID != "n2" || history[0].To != storage.StageInvited {
+			t.Errorf("changes newest first: got %+v", history)
+		}
+		if history, err := repo.ListNegotiationChanges(ctx, "u2", 10); err != nil || len(history) != 0 {
+			t.Errorf("changes of another user: got %+v, %v", history, err)
+		}
+	})
+}
+
+func TestNotifications(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		mustUser(t, repo, "u2", "Anna", "Ivanova")
+
+		for _, n := range []storage.Notification{
+			{UserID: "u1", Kind: storage.NotifyInvitation, Text: "Acme invited you", URL: "/negotiations"},
+			{UserID: "u1", Kind: storage.NotifySearch, Text: "2 new vacancies for Go"},
+			{UserID: "u2", Kind: storage.NotifyBlocked, Text: "Go developer was blocked"},
+		} {
+			if err := repo.AddNotification(ctx, &n); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if n, err := repo.CountUnreadNotifications(ctx, "u1"); err != nil || n != 2 {
+			t.Errorf("unread: got %d, %v, want 2", n, err)
+		}
+		notes, err := repo.ListNotifications(ctx, "u1", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(notes) != 2 || notes[0].Kind != storage.NotifySearch || notes[1].URL != "/negotiations" || notes[0].Read {
+			t.Errorf("notifications newest first: got %+v", notes)
+		}
+
+		if err := repo.MarkNotificationsRead(ctx, "u1"); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := repo.CountUnreadNotifications(ctx, "u1"); err != nil || n != 0 {
+			t.Errorf("unread after marking: got %d, %v", n, err)
+		}
+		// read ones are still listed
+		if notes, err := repo.ListNotifications(ctx, "u1", 10); err != nil || len(notes) != 2 || !notes[0].Read {
+			t.Errorf("notifications after marking: got %+v, %v", notes, err)
+		}
+		if n, err := repo.CountUnreadNotifications(ctx, "u2"); err != nil || n != 1 {
+			t.Errorf("unread of another user: got %d, %v, want 1", n, err)
+		}
+	})
+}
+
+func TestMatches(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		if _, err := repo.ReplaceResumes(ctx, "u1", []storage.Resume{resume("r1", "Go developer"), resume("r2", "Go lead")}); err != nil {
+			t.Fatal(err)
+		}
+		published := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+
+		matches := []storage.Match{
+			{VacancyID: "v1", Name: "Go developer", EmployerID: "e1", Employer: "Acme", Salary: "200 000", PublishedAt: published},
+			{VacancyID: "v2", Name: "Backend developer", EmployerID: "e2", Employer: "Initech", PublishedAt: published},
+		}
+		if added, err := repo.SaveMatches(ctx, "u1", "r1", matches); err != nil || added != 2 {
+			t.Fatalf("first save: added %d, %v", added, err)
+		}
+		if counts, err := repo.CountNewMatches(ctx, "u1"); err != nil || !reflect.DeepEqual(counts, map[string]int{"r1": 2}) {
+			t.Errorf("new matches: got %v, %v", counts, err)
+		}
+
+		// seen ones are refreshed, not added
+		matches[0].Salary = "250 000"
+		matches = append(matches, storage.Match{VacancyID: "v3", Name: "Go lead", EmployerID: "e1", Employer: "Acme", PublishedAt: published})
+		if added, err := repo.SaveMatches(ctx, "u1", "r1", matches); err != nil || added != 1 {
+			t.Fatalf("second save: added %d, %v", added, err)
+		}
+
+		previous, err := repo.MarkMatchesSeen(ctx, "u1", "r1")
+		if err != nil || !previous.IsZero() {
+			t.Fatalf("first visit: got %v, %v", previous, err)
+		}
+		if previous, err := repo.MarkMatchesSeen(ctx, "u1", "r1"); err != nil || previous.IsZero() {
+			t.Errorf("second visit: got %v, %v", previous, err)
+		}
+		if counts, err := repo.CountNewMatches(ctx, "u1"); err != nil || len(counts) != 0 {
+			t.Errorf("new matches after a visit: got %v, %v", counts, err)
+		}
+		if _, err := repo.MarkMatchesSeen(ctx, "u1", "r9"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("visit of a missing resume: got %v, want ErrNotFound", err)
+		}
+
+		if err := repo.SetMatchInteresting(ctx, "u1", "r1", "v2", true); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.SetMatchInteresting(ctx, "u1", "r2", "v2", true); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("mark a match of another resume: got %v, want ErrNotFound", err)
+		}
+
+		list, err := repo.ListMatches(ctx, "u1", "r1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 3 {
+			t.Fatalf("matches: got %d, want 3", len(list))
+		}
+		for _, m := range list {
+			if m.VacancyID == "v1" && m.Salary != "250 000" {
+				t.Errorf("refreshed match: got %+v", m)
+			}
+			if m.VacancyID == "v2" && !m.Interesting {
+				t.Errorf("interesting match: got %+v", m)
+			}
+		}
+
+		// hidden employers drop out of the list until shown again
+		if err := repo.HideEmployer(ctx, &storage.HiddenEmployer{UserID: "u1", EmployerID: "e1", Name: "Acme"}); err != nil {
+			t.Fatal(err)
+		}
+		if list, err := repo.ListMatches(ctx, "u1", "r1"); err != nil || len(list) != 1 || list[0].VacancyID != "v2" {
+			t.Errorf("matches without hidden employers: got %+v, %v", list, err)
+		}
+		hidden, err := repo.ListHiddenEmployers(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hidden) != 1 || hidden[0].Name != "Acme" || hidden[0].HiddenAt.IsZero() {
+			t.Errorf("hidden employers: got %+v", hidden)
+		}
+
+		if err := repo.UnhideEmployer(ctx, "u1", "e1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.UnhideEmployer(ctx, "u1", "e1"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("unhide twice: got %v, want ErrNotFound", err)
+		}
+		if list, err := repo.ListMatches(ctx, "u1", "r1"); err != nil || len(list) != 3 {
+			t.Errorf("matches after unhide: got %d, %v", len(list), err)
+		}
+	})
+}
+
+func TestSearches(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		mustUser(t, repo, "u2", "Anna", "Ivanova")
+
+		s := &storage.SavedSearch{UserID: "u1", Name: "Go in Moscow", Text: "golang", Area: "1", Salary: 200000, Schedule: "remote"}
+		if err := repo.CreateSearch(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+		other := &storage.SavedSearch{UserID: "u2", Name: "Python", Text: "python"}
+		if err := repo.CreateSearch(ctx, other); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := repo.GetSearch(ctx, "u1", s.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Text != "golang" || got.Salary != 200000 || got.Schedule != "remote" || !got.LastRunAt.IsZero() {
+			t.Errorf("search: got %+v", got)
+		}
+		if _, err := repo.GetSearch(ctx, "u2", s.ID); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("get search of another user: got %v, want ErrNotFound", err)
+		}
+		if all, err := repo.ListSearches(ctx, ""); err != nil || len(all) != 2 {
+			t.Errorf("searches of everyone: got %d, %v", len(all), err)
+		}
+
+		if err := repo.SetSearchError(ctx, s.ID, "hh answered 502"); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := repo.GetSearch(ctx, "u1", s.ID); err != nil || got.LastError != "hh answered 502" || got.LastRunAt.IsZero() {
+			t.Errorf("failed search: got %+v, %v", got, err)
+		}
+
+		results := []storage.SearchResult{
+			{VacancyID: "v1", Name: "Go developer", EmployerID: "e1", Employer: "Acme"},
+			{VacancyID: "v2", Name: "Go lead", EmployerID: "e2", Employer: "Initech"},
+		}
+		if added, err := repo.SaveSearchResults(ctx, s.ID, results); err != nil || added != 2 {
+			t.Fatalf("first results: added %d, %v", added, err)
+		}
+		if added, err := repo.SaveSearchResults(ctx, s.ID, results); err != nil || added != 0 {
+			t.Errorf("same results again: added %d, %v", added, err)
+		}
+		if _, err := repo.SaveSearchResults(ctx, s.ID+other.ID+1, results); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("results of a missing search: got %v, want ErrNotFound", err)
+		}
+		// a run that works clears the error
+		if got, err := repo.GetSearch(ctx, "u1", s.ID); err != nil || got.LastError != "" {
+			t.Errorf("search after a run: got %+v, %v", got, err)
+		}
+
+		searches, err := repo.ListSearches(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(searches) != 1 || searches[0].NewCount != 2 {
+			t.Errorf("searches of u1: got %+v", searches)
+		}
+
+		if previous, err := repo.MarkSearchSeen(ctx, "u1", s.ID); err != nil || !previous.IsZero() {
+			t.Errorf("first visit: got %v, %v", previous, err)
+		}
+		if _, err := repo.MarkSearchSeen(ctx, "u2", s.ID); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("visit of another user's search: got %v, want ErrNotFound", err)
+		}
+		if searches, err := repo.ListSearches(ctx, "u1"); err != nil || searches[0].NewCount != 0 {
+			t.Errorf("new results after a visit: got %+v, %v", searches, err)
+		}
+
+		if err := repo.HideEmployer(ctx, &storage.HiddenEmployer{UserID: "u1", EmployerID: "e1", Name: "Acme"}); err != nil {
+			t.Fatal(err)
+		}
+		list, err := repo.ListSearchResults(ctx, "u1", s.ID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 || list[0].VacancyID != "v2" || list[0].UserID != "u1" || list[0].FirstSeenAt.IsZero() {
+			t.Errorf("results without hidden employers: got %+v", list)
+		}
+
+		if err := repo.DeleteSearch(ctx, "u2", s.ID); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("delete search of another user: got %v, want ErrNotFound", err)
+		}
+		if err := repo.DeleteSearch(ctx, "u1", s.ID); err != nil {
+			t.Fatal(err)
+		}
+		if list, err := repo.ListSearchResults(ctx, "u1", s.ID, 10); err != nil || len(list) != 0 {
+			t.Errorf("results of a deleted search: got %d, %v", len(list), err)
+		}
+	})
+}
+
+func TestCoverLetters(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		mustUser(t, repo, "u2", "Anna", "Ivanova")
+
+		l := &storage.CoverLetter{UserID: "u1", Name: "Short", Body: "Hello {employer}, I am {name}."}
+		if err := repo.CreateCoverLetter(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+		if l.ID == 0 || l.CreatedAt.IsZero() {
+			t.Errorf("created letter: got %+v", l)
+		}
+		if err := repo.CreateCoverLetter(ctx, &storage.CoverLetter{UserID: "u1", Name: "Long", Body: "Dear {employer}"}); err != nil {
+			t.Fatal(err)
+		}
+
+		letters, err := repo.ListCoverLetters(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(letters) != 2 || letters[0].Name != "Long" || letters[1].Name != "Short" {
+			t.Errorf("letters by name: got %+v", letters)
+		}
+
+		got, err := repo.GetCoverLetter(ctx, "u1", l.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Body != l.Body {
+			t.Errorf("letter body: got %q, want %q", got.Body, l.Body)
+		}
+
+		// letters of others are not found, not even to delete
+		if _, err := repo.GetCoverLetter(ctx, "u2", l.ID); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("get letter of another user: got %v, want ErrNotFound", err)
+		}
+		if err := repo.DeleteCoverLetter(ctx, "u2", l.ID); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("delete letter of another user: got %v, want ErrNotFound", err)
+		}
+		if err := repo.DeleteCoverLetter(ctx, "u1", l.ID); err != nil {
+			t.Fatal(err)
+		}
+		if letters, err := repo.ListCoverLetters(ctx, "u1"); err != nil || len(letters) != 1 {
+			t.Errorf("letters after delete: got %d, %v", len(letters), err)
+		}
+	})
+}
+
+func TestApplications(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		now := time.Now()
+		since := now.Add(-24 * time.Hour)
+
+		// an application from before the window does not count
+		old := &storage.Application{UserID: "u1", ResumeID: "r1", VacancyID: "v0", CreatedAt: now.Add(-25 * time.Hour)}
+		if err := repo.ReserveApplication(ctx, old, time.Time{}, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		var reserved []*storage.Application
+		for _, vacancyID := range []string{"v1", "v2"} {
+			a := &storage.Application{UserID: "u1", ResumeID: "r1", VacancyID: vacancyID, VacancyName: "Go developer", Message: "Hello"}
+			if err := repo.ReserveApplication(ctx, a, since, 2); err != nil {
+				t.Fatalf("reserve %s: %v", vacancyID, err)
+			}
+			if a.ID == 0 || a.Status != storage.ApplicationPending {
+				t.Errorf("reserved application: got %+v", a)
+			}
+			reserved = append(reserved, a)
+		}
+
+		over := &storage.Application{UserID: "u1", ResumeID: "r1", VacancyID: "v3"}
+		if err := repo.ReserveApplication(ctx, over, since, 2); !errors.Is(err, storage.ErrCapReached) {
+			t.Fatalf("reserve over the cap: got %v, want ErrCapReached", err)
+		}
+		if err := repo.ReserveApplication(ctx, over, since, 0); err != nil {
+			t.Errorf("reserve without a cap: %v", err)
+		}
+
+		reserved[0].Status, reserved[0].NegotiationID = storage.ApplicationSent, "n1"
+		if err := repo.FinishApplication(ctx, reserved[0]); err != nil {
+			t.Fatal(err)
+		}
+		// failed ones give their place back
+		for _, a := range []*storage.Application{reserved[1], over} {
+			a.Status, a.Error = storage.ApplicationFailed, "hh said no"
+			if err := repo.FinishApplication(ctx, a); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n, err := repo.CountApplications(ctx, "u1", since); err != nil || n != 1 {
+			t.Errorf("applications counted: got %d, %v, want 1", n, err)
+		}
+
+		if err := repo.FinishApplication(ctx, &storage.Application{ID: reserved[0].ID, UserID: "u2", Status: storage.ApplicationSent}); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("finish application of another user: got %v, want ErrNotFound", err)
+		}
+
+		apps, err := repo.ListApplications(ctx, "u1", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(apps) != 4 || apps[len(apps)-1].VacancyID != "v0" {
+			t.Fatalf("applications newest first: got %+v", apps)
+		}
+		for _, a := range apps {
+			if a.ID == reserved[0].ID && (a.Status != storage.ApplicationSent || a.NegotiationID != "n1" || a.Message != "Hello") {
+				t.Errorf("sent application: got %+v", a)
+			}
+			if a.ID == over.ID && (a.Status != storage.ApplicationFailed || a.Error != "hh said no") {
+				t.Errorf("failed application: got %+v", a)
+			}
+		}
+	})
+}
+
+// TestReserveApplicationConcurrent reserves from many goroutines at once,
+// the way several apply forms sent together do, the cap must still hold
+func TestReserveApplicationConcurrent(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+
+		const (
+			limit   = 3
+			senders = 20
+		)
+		since := time.Now().Add(-24 * time.Hour)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, senders)
+		for i := 0; i < senders; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				a := &storage.Application{UserID: "u1", ResumeID: "r1", VacancyID: fmt.Sprintf("v%d", i)}
+				errs <- repo.ReserveApplication(ctx, a, since, limit)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		reserved := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				reserved++
+			case !errors.Is(err, storage.ErrCapReached):
+				t.Errorf("reserve: %v", err)
+			}
+		}
+		if reserved != limit {
+			t.Errorf("reserved %d applications, want %d", reserved, limit)
+		}
+		if n, err := repo.CountApplications(ctx, "u1", since); err != nil || n != limit {
+			t.Errorf("applications counted: got %d, %v, want %d", n, err, limit)
+		}
+	})
+}
+
+func TestResumeSnapshots(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		mustUser(t, repo, "u2", "Anna", "Ivanova")
+		if _, err := repo.ReplaceResumes(ctx, "u1", []storage.Resume{resume("r1", "Go developer"), resume("r2", "Go lead")}); err != nil {
+			t.Fatal(err)
+		}
+		taken := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+
+		snapshot := func(userID, resumeID, data string, at time.Time) *storage.ResumeSnapshot {
+			t.Helper()
+			s, err := storage.NewResumeSnapshot(userID, resumeID, []byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.TakenAt = at
+			return s
+		}
+		save := func(s *storage.ResumeSnapshot) bool {
+			t.Helper()
+			saved, err := repo.SaveResumeSnapshot(ctx, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return saved
+		}
+
+		if !save(snapshot("u1", "r1", `{"title":"Go developer","total_views":1}`, taken)) {
+			t.Error("first snapshot was not saved")
+		}
+		// views alone are no new version
+		if save(snapshot("u1", "r1", `{"title":"Go developer","total_views":7}`, taken.Add(time.Hour))) {
+			t.Error("snapshot with only more views was saved")
+		}
+		newer := snapshot("u1", "r1", `{"title":"Senior Go developer","total_views":7}`, taken.Add(2*time.Hour))
+		if !save(newer) || newer.ID == 0 {
+			t.Errorf("changed snapshot: got %+v", newer)
+		}
+		save(snapshot("u1", "r2", `{"title":"Go lead"}`, taken))
+		// snapshots stay with whoever had the resume then, a newer one
+		// of another user must not hide the latest of u1
+		save(snapshot("u2", "r1", `{"title":"Python developer"}`, taken.Add(3*time.Hour)))
+
+		list, err := repo.ListResumeSnapshots(ctx, "u1", "r1", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 || list[0].ID != newer.ID || !list[1].TakenAt.Equal(taken) {
+			t.Fatalf("snapshots newest first: got %+v", list)
+		}
+
+		latest, err := repo.LatestResumeSnapshots(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(latest) != 2 || latest["r1"].ID != newer.ID || latest["r2"].UserID != "u1" {
+			t.Errorf("latest snapshots: got %+v", latest)
+		}
+
+		changes, err := storage.DiffResumeSnapshots(list[1], list[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []storage.SnapshotChange{{Field: "title", From: "Go developer", To: "Senior Go developer"}}
+		if !reflect.DeepEqual(changes, want) {
+			t.Errorf("diff: got %+v, want %+v", changes, want)
+		}
+	})
+}
+
+func TestBlacklist(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		if _, err := repo.ReplaceResumes(ctx, "u1", []storage.Resume{resume("r1", "Go developer"), resume("r2", "Go lead")}); err != nil {
+			t.Fatal(err)
+		}
+		added := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+
+		if err := repo.AddBlacklisted(ctx, &storage.BlacklistedEmployer{UserID: "u1", ResumeID: "r1", EmployerID: "e1", Name: "Acme", AddedAt: added}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.AddBlacklisted(ctx, &storage.BlacklistedEmployer{UserID: "u1", ResumeID: "r2", EmployerID: "e1", Name: "Acme"}); err != nil {
+			t.Fatal(err)
+		}
+
+		// hh is the source, the mirror follows it and keeps when an employer was added
+		mirror := []storage.BlacklistedEmployer{
+			{EmployerID: "e1", Name: "Acme Group", URL: "https://hh.ru/employer/e1"},
+			{EmployerID: "e2", Name: "Initech"},
+		}
+		if err := repo.ReplaceBlacklist(ctx, "u1", "r1", mirror); err != nil {
+			t.Fatal(err)
+		}
+
+		list, err := repo.ListBlacklist(ctx, "u1", "r1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 || list[0].EmployerID != "e1" || list[0].Name != "Acme Group" || !list[0].AddedAt.Equal(added) || list[1].UserID != "u1" {
+			t.Fatalf("blacklist after replace: got %+v", list)
+		}
+
+		if err := repo.ReplaceBlacklist(ctx, "u1", "r1", mirror[1:]); err != nil {
+			t.Fatal(err)
+		}
+		if list, err := repo.ListBlacklist(ctx, "u1", "r1"); err != nil || len(list) != 1 || list[0].EmployerID != "e2" {
+			t.Errorf("blacklist after hh dropped e1: got %+v, %v", list, err)
+		}
+
+		counts, err := repo.CountBlacklisted(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(counts, map[string]int{"r1": 1, "r2": 1}) {
+			t.Errorf("counts: got %v", counts)
+		}
+
+		if err := repo.RemoveBlacklisted(ctx, "u1", "r2", "e1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.RemoveBlacklisted(ctx, "u1", "r2", "e1"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("remove twice: got %v, want ErrNotFound", err)
+		}
+		if list, err := repo.ListBlacklist(ctx, "u1", "r2"); err != nil || len(list) != 0 {
+			t.Errorf("blacklist after remove: got %+v, %v", list, err)
+		}
+	})
+}
+
+func TestResumeViews(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		if _, err := repo.ReplaceResumes(ctx, "u1", []storage.Resume{resume("r1", "Go developer"), resume("r2", "Go lead")}); err != nil {
+			t.Fatal(err)
+		}
+		base := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+
+		views := []storage.ResumeView{
+			{ViewedAt: base, EmployerID: "e1", EmployerName: "Acme"},
+			{ViewedAt: base.Add(time.Hour), EmployerID: "e2", EmployerName: "Initech"},
+		}
+		if added, err := repo.SaveResumeViews(ctx, "u1", "r1", views); err != nil || added != 2 {
+			t.Fatalf("first save: added %d, %v", added, err)
+		}
+		// hh lists the same views again on the next fetch
+		views = append(views, storage.ResumeView{ViewedAt: base.Add(-time.Hour), EmployerID: "e1", EmployerName: "Acme"})
+		if added, err := repo.SaveResumeViews(ctx, "u1", "r1", views); err != nil || added != 1 {
+			t.Fatalf("second save: added %d, %v", added, err)
+		}
+		if _, err := repo.SaveResumeViews(ctx, "u1", "r2", views[:1]); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := repo.ListResumeViews(ctx, "u1", base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 3 || got[0].ViewedAt.Before(base) || got[2].EmployerName != "Initech" || got[0].UserID != "u1" {
+			t.Errorf("views since base, oldest first: got %+v", got)
+		}
+
+		for i, status := range []string{storage.AttemptOK, "error", storage.AttemptOK} {
+			a := &storage.Attempt{UserID: "u1", ResumeID: "r1", Timestamp: base.Add(time.Duration(i) * time.Hour), Status: status}
+			if err := repo.AddAttempt(ctx, a); err != nil {
+				t.Fatal(err)
+			}
+		}
+		bumps, err := repo.ListBumpTimes(ctx, "u1", base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []time.Time{base, base.Add(2 * time.Hour)}; len(bumps) != 2 || !bumps[0].Equal(want[0]) || !bumps[1].Equal(want[1]) {
+			t.Errorf("bump times: got %v, want %v", bumps, want)
+		}
+	})
+}
+
+func TestBumpSlots(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, _ backend, repo storage.Repository) {
+		ctx := context.Background()
+		mustUser(t, repo, "u1", "Ivan", "Petrov")
+		mustUser(t, repo, "u2", "Anna", "Ivanova")
+		base := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+
+		if err := repo.SetScheduleMode(ctx, "u9", storage.ScheduleAuto); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("mode of a missing user: got %v, want ErrNotFound", err)
+		}
+		for _, userID := range []string{"u1", "u2"} {
+			if err := repo.SetScheduleMode(ctx, userID, storage.ScheduleAuto); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if u, err := repo.GetUser(ctx, "u1"); err != nil || u.ScheduleMode != storage.ScheduleAuto {
+			t.Errorf("user in auto mode: got %+v, %v", u, err)
+		}
+
+		slots := []storage.BumpSlot{
+			{At: base.Add(5 * time.Hour), Reason: "most views"},
+			{At: base, Reason: "second most views"},
+		}
+		if err := repo.ReplaceBumpSlots(ctx, "u1", slots); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.ReplaceBumpSlots(ctx, "u2", []storage.BumpSlot{{At: base.Add(2 * time.Hour)}}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := repo.ListBumpSlots(ctx, "u1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || !got[0].At.Equal(base) || got[0].Reason != "second most views" || got[1].UserID != "u1" {
+			t.Errorf("slots in time order: got %+v", got)
+		}
+
+		tests := []struct {
+			name  string
+			after time.Time
+			want  time.Time
+		}{
+			{"earliest of everyone", base.Add(-time.Hour), base},
+			{"after is left out", base, base.Add(2 * time.Hour)},
+			{"none left", base.Add(5 * time.Hour), time.Time{}},
+		}
+		for _, tt := range tests {
+			if next, err := repo.NextBumpSlot(ctx, tt.after); err != nil || !next.Equal(tt.want) {
+				t.Errorf("%s: got %v, %v, want %v", tt.name, next, err, tt.want)
+			}
+		}
+
+		// slots of disabled users and users back in fixed mode do not count
+		if err := repo.SetUserDisabled(ctx, "u2", true); err != nil {
+			t.Fatal(err)
+		}
+		if next, err := repo.NextBumpSlot(ctx, base); err != nil || !next.Equal(base.Add(5*time.Hour)) {
+			t.Errorf("next without the disabled user: got %v, %v", next, err)
+		}
+		if err := repo.SetScheduleMode(ctx, "u1", storage.ScheduleFixed); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := repo.ListBumpSlots(ctx, "u1"); err != nil || len(got) != 0 {
+			t.Errorf("slots after switching to fixed: got %+v, %v", got, err)
+		}
+		if next, err := repo.NextBumpSlot(ctx, base.Add(-time.Hour)); err != nil || !next.IsZero() {
+			t.Errorf("next with nobody in auto mode: got %v, %v", next, err)
+		}
+	})
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const searchColumns = `s.id, s.user_id, s.name, coalesce(s.text, ''), coalesce(s.area, ''), s.salary,
+	coalesce(s.experience, ''), coalesce(s.schedule, ''), s.created_at, coalesce(s.last_run_at, ''), coalesce(s.last_error, '')`
+
+func scanSearch(scan func(dest ...any) error, extra ...any) (SavedSearch, error) {
+	var s SavedSearch
+	var createdAt, lastRunAt string
+	if err := scan(append([]any{
+		&s.ID, &s.UserID, &s.Name, &s.Text, &s.Area, &s.Salary,
+		&s.Experience, &s.Schedule, &createdAt, &lastRunAt, &s.LastError,
+	}, extra...)...); err != nil {
+		return s, err
+	}
+	s.CreatedAt = parseTime(createdAt)
+	s.LastRunAt = parseTime(lastRunAt)
+
+	return s, nil
+}
+
+func (s *sqlStore) CreateSearch(ctx context.Context, ss *SavedSearch) error {
+	if ss.CreatedAt.IsZero() {
+		ss.CreatedAt = time.Now()
+	}
+
+	return s.retry(ctx, func() error {
+		return s.queryRow(
+			ctx,
+			`
+			insert into saved_searches (user_id, name, text, area, salary, experience, schedule, created_at)
+			values (?, ?, ?, ?, ?, ?, ?, ?) returning id
+			`,
+			ss.UserID, ss.Name, ss.Text, ss.Area, ss.Salary, ss.Experience, ss.Schedule, formatTime(ss.CreatedAt),
+		).Scan(&ss.ID)
+	})
+}
+
+func (s *sqlStore) ListSearches(ctx context.Context, userID string) ([]SavedSearch, error) {
+	query := `
+	select ` + searchColumns + `,
+		(select count(*) from search_results r
+		where r.search_id = s.id and (s.seen_at is null or r.first_seen_at > s.seen_at)
+		and not exists (select 1 from hidden_employers h where h.user_id = r.user_id and h.employer_id = r.employer_id))
+	from saved_searches s
+	where ? = '' or s.user_id = ?
+	order by s.user_id, s.name, s.id
+	`
+	rows, err := s.query(ctx, query, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var searches []SavedSearch
+	for rows.Next() {
+		var newCount int
+		ss, err := scanSearch(rows.Scan, &newCount)
+		if err != nil {
+			return nil, err
+		}
+		ss.NewCount = newCount
+		searches = append(searches, ss)
+	}
+
+	return searches, rows.Err()
+}
+
+func (s *sqlStore) GetSearch(ctx context.Context, userID string, searchID int64) (*SavedSearch, error) {
+	query := `select ` + searchColumns + ` from saved_searches s where s.id = ? and s.user_id = ?`
+	ss, err := scanSearch(s.queryRow(ctx, query, searchID, userID).Scan)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &ss, nil
+}
+
+func (s *sqlStore) DeleteSearch(ctx context.Context, userID string, searchID int64) error {
+	res, err := s.exec(ctx, `delete from saved_searches where id = ? and user_id = ?`, searchID, userID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *sqlStore) SaveSearchResults(ctx context.Context, searchID int64, results []SearchResult) (int, error) {
+	var added int
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var userID string
+		err := tx.QueryRowContext(ctx, s.d.rebind(`select user_id from saved_searches where id = ?`), searchID).Scan(&userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		stmt, err := tx.PrepareContext(ctx, s.d.rebind(`
+		insert into search_results (search_id, vacancy_id, user_id, name, employer_id, employer, url, salary, area, published_at, first_seen_at)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on conflict(search_id, vacancy_id) do nothing
+		`))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		added = 0
+		now := formatTime(time.Now())
+		for _, r := range results {
+			res, err := stmt.ExecContext(
+				ctx, searchID, r.VacancyID, userID, r.Name, r.EmployerID, r.Employer, r.URL, r.Salary, r.Area, formatTime(r.PublishedAt), now,
+			)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err == nil && n > 0 {
+				added++
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, s.d.rebind(`update saved_searches set last_run_at = ?, last_error = '' where id = ?`), now, searchID)
+		return err
+	})
+
+	return added, err
+}
+
+func (s *sqlStore) SetSearchError(ctx context.Context, searchID int64, runErr string) error {
+	_, err := s.exec(ctx, `update saved_searches set last_run_at = ?, last_error = ? where id = ?`, formatTime(time.Now()), runErr, searchID)
+	return err
+}
+
+const searchResultColumns = `r.search_id, r.vacancy_id, r.user_id, coalesce(r.name, ''), coalesce(r.employer_id, ''), coalesce(r.employer, ''),
+	coalesce(r.url, ''), coalesce(r.salary, ''), coalesce(r.area, ''), coalesce(r.published_at, ''), r.first_seen_at`
+
+func scanSearchResults(rows *sql.Rows) ([]SearchResult, error) {
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		var publishedAt, firstSeenAt string
+		if err := rows.Scan(
+			&r.SearchID, &r.VacancyID, &r.UserID, &r.Name, &r.EmployerID, &r.Employer,
+			&r.URL, &r.Salary, &r.Area, &publishedAt, &firstSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		r.PublishedAt = parseTime(publishedAt)
+		r.FirstSeenAt = parseTime(firstSeenAt)
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+func (s *sqlStore) ListSearchResults(ctx context.Context, userID string, searchID int64, limit int) ([]SearchResult, error) {
+	query := `
+	select ` + searchResultColumns + `
+	from search_results r
+	where r.user_id = ? and r.search_id = ?
+	and not exists (select 1 from hidden_employers h where h.user_id = r.user_id and h.employer_id = r.employer_id)
+	order by r.first_seen_at desc, r.published_at desc
+	limit ?
+	`
+	rows, err := s.query(ctx, query, userID, searchID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSearchResults(rows)
+}
+
+func (s *sqlStore) MarkSearchSeen(ctx context.Context, userID string, searchID int64) (time.Time, error) {
+	var previous time.Time
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var seenAt string
+		err := tx.QueryRowContext(
+			ctx,
+			s.d.rebind(`select coalesce(seen_at, '') from saved_searches where id = ? and user_id = ?`),
+			searchID, userID,
+		).Scan(&seenAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		previous = parseTime(seenAt)
+
+		_, err = tx.ExecContext(
+			ctx,
+			s.d.rebind(`update saved_searches set seen_at = ? where id = ? and user_id = ?`),
+			formatTime(time.Now()), searchID, userID,
+		)
+		return err
+	})
+
+	return previous, err
+}
@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// volatileResumeKeys change on their own, a new view or a bump
+// alone must not make a new snapshot
+var volatileResumeKeys = []string{
+	"updated_at", "next_publish_at", "can_publish_or_update", "publish_url",
+	"total_views", "new_views", "views_url", "counters",
+	"actions", "download", "negotiations_history", "paid_services", "photo", "owner",
+}
+
+// NewResumeSnapshot checks that data is a json object and hashes it
+// without volatileResumeKeys, encoding/json sorts keys so the same
+// resume always hashes the same
+func NewResumeSnapshot(userID, resumeID string, data []byte) (*ResumeSnapshot, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("resume %s: %w", resumeID, err)
+	}
+	for _, k := range volatileResumeKeys {
+		delete(fields, k)
+	}
+
+	stable, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(stable)
+
+	return &ResumeSnapshot{
+		UserID:   userID,
+		ResumeID: resumeID,
+		TakenAt:  time.Now(),
+		Hash:     hex.EncodeToString(sum[:]),
+		Data:     string(data),
+	}, nil
+}
+
+// resumeContent is the part of a resume the diff is about
+type resumeContent struct {
+	Title  string `json:"title"`
+	Salary *struct {
+		Amount   int    `json:"amount"`
+		Currency string `json:"currency"`
+	} `json:"salary"`
+	Area *struct {
+		Name string `json:"name"`
+	} `json:"area"`
+	Status *struct {
+		Name string `json:"name"`
+	} `json:"status"`
+	Roles []struct {
+		Name string `json:"name"`
+	} `json:"professional_roles"`
+	SkillSet   []string `json:"skill_set"`
+	Skills     string   `json:"skills"`
+	Experience []struct {
+		Company     string  `json:"company"`
+		Position    string  `json:"position"`
+		Start       string  `json:"start"`
+		End         *string `json:"end"`
+		Description string  `json:"description"`
+	} `json:"experience"`
+	TotalViews int `json:"total_views"`
+}
+
+func (c resumeContent) salary() string {
+	if c.Salary == nil || c.Salary.Amount == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d %s", c.Salary.Amount, c.Salary.Currency)
+}
+
+func (c resumeContent) roles() string {
+	names := make([]string, 0, len(c.Roles))
+	for _, r := range c.Roles {
+		names = append(names, r.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// experience maps entries to how they read, keyed by company, position and start
+func (c resumeContent) experience() map[string]string {
+	entries := make(map[string]string, len(c.Experience))
+	for _, e := range c.Experience {
+		end := "now"
+		if e.End != nil {
+			end = *e.End
+		}
+		key := fmt.Sprintf("%s at %s since %s", e.Position, e.Company, e.Start)
+		entries[key] = fmt.Sprintf("until %s: %s", end, e.Description)
+	}
+	return entries
+}
+
+func parseResumeContent(data string) (resumeContent, error) {
+	var c resumeContent
+	err := json.Unmarshal([]byte(data), &c)
+	return c, err
+}
+
+// SnapshotViews is how many views the resume had when the snapshot was taken
+func SnapshotViews(s ResumeSnapshot) int {
+	c, err := parseResumeContent(s.Data)
+	if err != nil {
+		return 0
+	}
+	return c.TotalViews
+}
+
+// DiffResumeSnapshots tells what changed from older to newer in the title,
+// salary, area, roles, status, skills and experience entries
+func DiffResumeSnapshots(older, newer ResumeSnapshot) ([]SnapshotChange, error) {
+	a, err := parseResumeContent(older.Data)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %d: %w", older.ID, err)
+	}
+	b, err := parseResumeContent(newer.Data)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %d: %w", newer.ID, err)
+	}
+
+	var changes []SnapshotChange
+	field := func(name, from, to string) {
+		if from != to {
+			changes = append(changes, SnapshotChange{Field: name, From: from, To: to})
+		}
+	}
+	var areaA, areaB, statusA, statusB string
+	if a.Area != nil {
+		areaA = a.Area.Name
+	}
+	if b.Area != nil {
+		areaB = b.Area.Name
+	}
+	if a.Status != nil {
+		statusA = a.Status.Name
+	}
+	if b.Status != nil {
+		statusB = b.Status.Name
+	}
+
+	field("title", a.Title, b.Title)
+	field("salary", a.salary(), b.salary())
+	field("area", areaA, areaB)
+	field("roles", a.roles(), b.roles())
+	field("status", statusA, statusB)
+
+	var added, removed []string
+	for _, s := range b.SkillSet {
+		if !slices.Contains(a.SkillSet, s) {
+			added = append(added, s)
+		}
+	}
+	for _, s := range a.SkillSet {
+		if !slices.Contains(b.SkillSet, s) {
+			removed = append(removed, s)
+		}
+	}
+	if len(added) > 0 || len(removed) > 0 {
+		changes = append(changes, SnapshotChange{Field: "skills", From: strings.Join(removed, ", "), To: strings.Join(added, ", ")})
+	}
+	field("about", a.Skills, b.Skills)
+
+	expA, expB := a.experience(), b.experience()
+	keys := make([]string, 0, len(expA)+len(expB))
+	for k := range expA {
+		keys = append(keys, k)
+	}
+	for k := range expB {
+		if _, ok := expA[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		field("experience: "+k, expA[k], expB[k])
+	}
+
+	return changes, nil
+}
+
+func (s *sqlStore) SaveResumeSnapshot(ctx context.Context, snap *ResumeSnapshot) (bool, error) {
+	if snap.TakenAt.IsZero() {
+		snap.TakenAt = time.Now()
+	}
+
+	var saved bool
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		saved = false
+
+		var latest string
+		err := tx.QueryRowContext(ctx, s.d.rebind(`
+		select hash from resume_snapshots
+		where user_id = ? and resume_id = ?
+		order by taken_at desc, id desc
+		limit 1
+		`), snap.UserID, snap.ResumeID).Scan(&latest)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if latest == snap.Hash {
+			return nil
+		}
+
+		if err := tx.QueryRowContext(
+			ctx,
+			s.d.rebind(`insert into resume_snapshots (user_id, resume_id, taken_at, hash, data) values (?, ?, ?, ?, ?) returning id`),
+			snap.UserID, snap.ResumeID, formatTime(snap.TakenAt), snap.Hash, snap.Data,
+		).Scan(&snap.ID); err != nil {
+			return err
+		}
+		saved = true
+
+		return nil
+	})
+
+	return saved, err
+}
+
+func scanSnapshots(rows *sql.Rows) ([]ResumeSnapshot, error) {
+	var snaps []ResumeSnapshot
+	for rows.Next() {
+		var snap ResumeSnapshot
+		var takenAt string
+		if err := rows.Scan(&snap.ID, &snap.UserID, &snap.ResumeID, &takenAt, &snap.Hash, &snap.Data); err != nil {
+			return nil, err
+		}
+		snap.TakenAt = parseTime(takenAt)
+		snaps = append(snaps, snap)
+	}
+
+	return snaps, rows.Err()
+}
+
+func (s *sqlStore) ListResumeSnapshots(ctx context.Context, userID, resumeID string, limit int) ([]ResumeSnapshot, error) {
+	rows, err := s.query(ctx, `
+	select id, user_id, resume_id, taken_at, hash, data
+	from resume_snapshots
+	where user_id = ? and resume_id = ?
+	order by taken_at desc, id desc
+	limit ?
+	`, userID, resumeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSnapshots(rows)
+}
+
+func (s *sqlStore) LatestResumeSnapshots(ctx context.Context, userID string) (map[string]ResumeSnapshot, error) {
+	rows, err := s.query(ctx, `
+	select s.id, s.user_id, s.resume_id, s.taken_at, s.hash, s.data
+	from resume_snapshots s
+	where s.user_id = ?
+	and not exists (
+		select 1 from resume_snapshots n
+		where n.user_id = s.user_id and n.resume_id = s.resume_id
+		and (n.taken_at > s.taken_at or (n.taken_at = s.taken_at and n.id > s.id))
+	)
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snaps, err := scanSnapshots(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]ResumeSnapshot, len(snaps))
+	for _, snap := range snaps {
+		latest[snap.ResumeID] = snap
+	}
+
+	return latest, nil
+}
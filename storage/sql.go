@@ -0,0 +1,963 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// resume times keep the layout web used before the repository existed
+const resumeTimeLayout = "2006-01-02 15:04:05-07:00"
+
+// sqlStore implements Repository over database/sql, the dialect
+// covers the differences between sqlite and postgres
+type sqlStore struct {
+	db *sql.DB
+	// reads runs read-only transactions, it is db unless the backend
+	// needs a pool of its own for them
+	reads *sql.DB
+	d     dialect
+}
+
+func newSQLStore(ctx context.Context, db *sql.DB, d dialect) (*sqlStore, error) {
+	if err := d.migrate(ctx, db); err != nil {
+		return nil, err
+	}
+
+	return &sqlStore{db: db, reads: db, d: d}, nil
+}
+
+func (s *sqlStore) Close() error {
+	if s.reads != s.db {
+		s.reads.Close()
+	}
+	return s.db.Close()
+}
+
+// busy retries back off from busyBackoff, doubling each time. The driver
+// already waited for the busy timeout before each of them
+const (
+	busyRetries = 5
+	busyBackoff = 50 * time.Millisecond
+)
+
+// retry runs fn again while the backend reports the database as locked
+// by another connection, which with sqlite may be the other binary
+func (s *sqlStore) retry(ctx context.Context, fn func() error) error {
+	backoff := busyBackoff
+	for i := 0; ; i++ {
+		err := fn()
+		if err == nil || s.d.isBusy == nil || !s.d.isBusy(err) || i == busyRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// withTx runs fn in a transaction that is retried as a whole when busy
+func (s *sqlStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return s.retry(ctx, func() error {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
+// withReadTx runs fn in a read-only transaction, it sees one state of the
+// database without taking the write lock writers wait for
+func (s *sqlStore) withReadTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return s.retry(ctx, func() error {
+		tx, err := s.reads.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
+func (s *sqlStore) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	var res sql.Result
+	err := s.retry(ctx, func() (err error) {
+		res, err = s.db.ExecContext(ctx, s.d.rebind(query), args...)
+		return err
+	})
+
+	return res, err
+}
+
+func (s *sqlStore) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, s.d.rebind(query), args...)
+}
+
+func (s *sqlStore) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.db.QueryRowContext(ctx, s.d.rebind(query), args...)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseTime reads every layout that ended up in the text columns:
+// ours, the one web wrote resumes with and what the sqlite driver
+// makes of a time.Time
+func parseTime(s string) time.Time {
+	for _, layout := range []string{
+		time.RFC3339Nano,
+		resumeTimeLayout,
+		"2006-01-02 15:04:05.999999999-07:00",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (s *sqlStore) UpsertUser(ctx context.Context, u *User) error {
+	query := `
+	insert into users (id, first_name, last_name, middle_name) values (?, ?, ?, ?)
+	on conflict(id) do update set
+	first_name = excluded.first_name,
+	last_name = excluded.last_name,
+	middle_name = excluded.middle_name
+	`
+	_, err := s.exec(ctx, query, u.ID, u.FirstName, u.LastName, u.MiddleName)
+	return err
+}
+
+func (s *sqlStore) GetUser(ctx context.Context, userID string) (*User, error) {
+	query := `
+	select id, coalesce(first_name, ''), coalesce(last_name, ''), coalesce(middle_name, ''), is_disabled, schedule_mode, time_zone
+	from users
+	where id = ?
+	`
+	var u User
+	if err := s.queryRow(ctx, query, userID).Scan(
+		&u.ID,
+		&u.FirstName,
+		&u.LastName,
+		&u.MiddleName,
+		&u.IsDisabled,
+		&u.ScheduleMode,
+		&u.TimeZone,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+func (s *sqlStore) ListUsers(ctx context.Context) ([]UserSummary, error) {
+	query := fmt.Sprintf(`
+	select
+		u.id, coalesce(u.first_name, ''), coalesce(u.last_name, ''), coalesce(u.middle_name, ''), u.is_disabled, u.schedule_mode, u.time_zone,
+		(select count(*) from resumes r where r.user_id = u.id),
+		(select count(*) from resumes r where r.user_id = u.id and r.is_scheduled = 1),
+		t.access_token, t.refresh_token,
+		coalesce((select h.timestamp from scheduler h where h.user_id = u.id order by h.%[1]s desc limit 1), ''),
+		coalesce((select h.error from scheduler h where h.user_id = u.id order by h.%[1]s desc limit 1), ''),
+		coalesce(u.synced_at, '')
+	from users u
+	left join tokens t on t.user_id = u.id
+	order by u.last_name, u.first_name
+	`, s.d.seq)
+	rows, err := s.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []UserSummary
+	for rows.Next() {
+		var u UserSummary
+		var at, rt sql.NullString
+		var lastAttempt, syncedAt string
+		if err := rows.Scan(
+			&u.ID,
+			&u.FirstName,
+			&u.LastName,
+			&u.MiddleName,
+			&u.IsDisabled,
+			&u.ScheduleMode,
+			&u.TimeZone,
+			&u.ResumeCount,
+			&u.ScheduledCount,
+			&at,
+			&rt,
+			&lastAttempt,
+			&u.LastError,
+			&syncedAt,
+		); err != nil {
+			return nil, err
+		}
+		u.LastAttempt = parseTime(lastAttempt)
+		u.SyncedAt = parseTime(syncedAt)
+
+		switch {
+		case !at.Valid || !rt.Valid:
+			u.TokenStatus = TokenMissing
+		case decryptToken(&Token{}, at.String, rt.String) != nil:
+			u.TokenStatus = TokenBroken
+		default:
+			u.TokenStatus = TokenOK
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *sqlStore) SetUserDisabled(ctx context.Context, userID string, isDisabled bool) error {
+	_, err := s.exec(ctx, `update users set is_disabled = ? where id = ?`, boolToInt(isDisabled), userID)
+	return err
+}
+
+func (s *sqlStore) SetTimeZone(ctx context.Context, userID, zone string) error {
+	res, err := s.exec(ctx, `update users set time_zone = ? where id = ?`, zone, userID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *sqlStore) DeleteUser(ctx context.Context, userID string) error {
+	res, err := s.exec(ctx, `delete from users where id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *sqlStore) PurgeUser(ctx context.Context, t *Tombstone) error {
+	if t.DeletedAt.IsZero() {
+		t.DeletedAt = time.Now()
+	}
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		// history has no foreign key to users, it goes first by hand. The
+		// audit log stays but forgets where the user came from
+		for _, query := range []string{
+			`delete from scheduler where user_id = ?`,
+			`delete from resume_syncs where user_id = ?`,
+			`update audit_log set ip = null, user_agent = null where user_id = ?`,
+			`delete from users where id = ?`,
+		} {
+			if _, err := tx.ExecContext(ctx, s.d.rebind(query), t.UserID); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.ExecContext(
+			ctx,
+			s.d.rebind(`insert into tombstones (user_id, deleted_at, actor, revoked, details) values (?, ?, ?, ?, ?)`),
+			t.UserID, formatTime(t.DeletedAt), t.Actor, boolToInt(t.Revoked), t.Details,
+		)
+		return err
+	})
+}
+
+func (s *sqlStore) ListTombstones(ctx context.Context, limit int) ([]Tombstone, error) {
+	query := `
+	select user_id, deleted_at, actor, revoked, coalesce(details, '')
+	from tombstones
+	order by id desc
+	limit ?
+	`
+	rows, err := s.query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tombstones []Tombstone
+	for rows.Next() {
+		var t Tombstone
+		var deletedAt string
+		if err := rows.Scan(&t.UserID, &deletedAt, &t.Actor, &t.Revoked, &t.Details); err != nil {
+			return nil, err
+		}
+		t.DeletedAt = parseTime(deletedAt)
+		tombstones = append(tombstones, t)
+	}
+
+	return tombstones, rows.Err()
+}
+
+func (s *sqlStore) LinkAccount(ctx context.Context, ownerID, userID string) error {
+	query := `
+	insert into account_links (owner_id, user_id, linked_at) values (?, ?, ?)
+	on conflict(owner_id, user_id) do nothing
+	`
+	_, err := s.exec(ctx, query, ownerID, userID, formatTime(time.Now()))
+	return err
+}
+
+func (s *sqlStore) UnlinkAccount(ctx context.Context, ownerID, userID string) error {
+	res, err := s.exec(ctx, `delete from account_links where owner_id = ? and user_id = ?`, ownerID, userID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *sqlStore) ListLinkedAccounts(ctx context.Context, ownerID string) ([]User, error) {
+	query := `
+	select u.id, coalesce(u.first_name, ''), coalesce(u.last_name, ''), coalesce(u.middle_name, ''), u.is_disabled, u.schedule_mode, u.time_zone
+	from account_links l
+	join users u on u.id = l.user_id
+	where l.owner_id = ?
+	order by l.linked_at, u.id
+	`
+	rows, err := s.query(ctx, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.FirstName, &u.LastName, &u.MiddleName, &u.IsDisabled, &u.ScheduleMode, &u.TimeZone); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *sqlStore) SaveToken(ctx context.Context, userID, code string, t *Token) error {
+	query := `
+	insert into tokens (access_token, refresh_token, expires_in, code, user_id, obtained_at) values (?, ?, ?, ?, ?, ?)
+	on conflict(user_id) do update set
+	access_token = excluded.access_token,
+	refresh_token = excluded.refresh_token,
+	expires_in = excluded.expires_in,
+	code = coalesce(excluded.code, tokens.code),
+	obtained_at = excluded.obtained_at
+	`
+	eat, ert, err := encryptToken(t)
+	if err != nil {
+		return err
+	}
+
+	if t.ObtainedAt.IsZero() {
+		t.ObtainedAt = time.Now()
+	}
+
+	var c sql.NullString
+	if code != "" {
+		c = sql.NullString{String: code, Valid: true}
+	}
+
+	_, err = s.exec(ctx, query, eat, ert, t.ExpiresIn, c, userID, formatTime(t.ObtainedAt))
+	return err
+}
+
+func (s *sqlStore) GetToken(ctx context.Context, userID string) (*Token, error) {
+	query := `
+	select access_token, refresh_token, coalesce(expires_in, 0), coalesce(obtained_at, '')
+	from tokens
+	where user_id = ?
+	`
+	var t Token
+	var at, rt, obtainedAt string
+	if err := s.queryRow(ctx, query, userID).Scan(&at, &rt, &t.ExpiresIn, &obtainedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	if err := decryptToken(&t, at, rt); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenBroken, err)
+	}
+	t.ObtainedAt = parseTime(obtainedAt)
+
+	return &t, nil
+}
+
+const upsertResumeQuery = `
+	insert into resumes (id, title, alternate_url, created_at, updated_at, user_id, status, visibility, moderation_note) values (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	on conflict(id) do update set
+	title = excluded.title,
+	alternate_url = excluded.alternate_url,
+	created_at = excluded.created_at,
+	updated_at = excluded.updated_at,
+	user_id = excluded.user_id,
+	status = excluded.status,
+	visibility = excluded.visibility,
+	moderation_note = excluded.moderation_note
+	`
+
+func (s *sqlStore) upsertResumes(ctx context.Context, tx *sql.Tx, userID string, resumes []Resume) error {
+	stmt, err := tx.PrepareContext(ctx, s.d.rebind(upsertResumeQuery))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range resumes {
+		if _, err := stmt.ExecContext(
+			ctx,
+			r.ID,
+			r.Title,
+			r.AlternateURL,
+			r.CreatedAt.UTC().Format(resumeTimeLayout),
+			r.UpdatedAt.UTC().Format(resumeTimeLayout),
+			userID,
+			r.Status,
+			r.Visibility,
+			r.ModerationNote,
+		); err != nil {
+			return fmt.Errorf("failed to execute statement for resume ID %s: %w", r.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlStore) deleteResumes(ctx context.Context, tx *sql.Tx, userID string, resumeIDs []string) error {
+	stmt, err := tx.PrepareContext(ctx, s.d.rebind(`delete from resumes where id = ? and user_id = ?`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, id := range resumeIDs {
+		if _, err := stmt.ExecContext(ctx, id, userID); err != nil {
+			return fmt.Errorf("failed to execute statement for resume ID %s: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlStore) UpsertResumes(ctx context.Context, userID string, resumes []Resume) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		return s.upsertResumes(ctx, tx, userID, resumes)
+	})
+}
+
+func (s *sqlStore) DeleteResumes(ctx context.Context, userID string, resumeIDs []string) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		return s.deleteResumes(ctx, tx, userID, resumeIDs)
+	})
+}
+
+func (s *sqlStore) ReplaceResumes(ctx context.Context, userID string, resumes []Resume) (ResumeDiff, error) {
+	var diff ResumeDiff
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, s.d.rebind(`select `+resumeColumns+` from resumes where user_id = ?`), userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		stored := make(map[string]Resume)
+		for rows.Next() {
+			r, err := scanResume(rows.Scan)
+			if err != nil {
+				return err
+			}
+			stored[r.ID] = r
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		// the diff is worked out again on every attempt, withTx may retry
+		diff = ResumeDiff{}
+		var changed []Resume
+		keep := make(map[string]bool, len(resumes))
+		for _, r := range resumes {
+			keep[r.ID] = true
+
+			old, ok := stored[r.ID]
+			switch {
+			case !ok:
+				diff.Added = append(diff.Added, r.Title)
+			case resumeChanged(old, r):
+				diff.Updated = append(diff.Updated, r.Title)
+			default:
+				continue
+			}
+			if r.Status == ResumeBlocked && old.Status != ResumeBlocked {
+				diff.Blocked = append(diff.Blocked, r.Title)
+			}
+			changed = append(changed, r)
+		}
+
+		var stale []string
+		for id, r := range stored {
+			if !keep[id] {
+				stale = append(stale, id)
+				diff.Removed = append(diff.Removed, r.Title)
+			}
+		}
+
+		if err := s.upsertResumes(ctx, tx, userID, changed); err != nil {
+			return err
+		}
+		if err := s.deleteResumes(ctx, tx, userID, stale); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, s.d.rebind(`update users set synced_at = ? where id = ?`), formatTime(time.Now()), userID)
+		return err
+	})
+	if err != nil {
+		return ResumeDiff{}, err
+	}
+
+	return diff, nil
+}
+
+// resumeChanged compares the fields hh owns, is_scheduled is ours
+func resumeChanged(old, r Resume) bool {
+	return old.Title != r.Title ||
+		old.AlternateURL != r.AlternateURL ||
+		!old.CreatedAt.Equal(r.CreatedAt) ||
+		!old.UpdatedAt.Equal(r.UpdatedAt) ||
+		old.Status != r.Status ||
+		old.Visibility != r.Visibility ||
+		old.ModerationNote != r.ModerationNote
+}
+
+func scanResume(scan func(dest ...any) error) (Resume, error) {
+	var r Resume
+	var createdAt, updatedAt string
+	if err := scan(
+		&r.ID,
+		&r.UserID,
+		&r.Title,
+		&r.AlternateURL,
+		&createdAt,
+		&updatedAt,
+		&r.IsScheduled,
+		&r.Status,
+		&r.Visibility,
+		&r.ModerationNote,
+	); err != nil {
+		return r, err
+	}
+	r.CreatedAt = parseTime(createdAt)
+	r.UpdatedAt = parseTime(updatedAt)
+
+	return r, nil
+}
+
+const resumeColumns = `id, user_id, coalesce(title, ''), coalesce(alternate_url, ''), coalesce(created_at, ''), coalesce(updated_at, ''), is_scheduled,
+	coalesce(status, ''), coalesce(visibility, ''), coalesce(moderation_note, '')`
+
+func (s *sqlStore) ListResumes(ctx context.Context, userID string) ([]Resume, error) {
+	query := `select ` + resumeColumns + ` from resumes where ? = '' or user_id = ? order by user_id, title`
+	rows, err := s.query(ctx, query, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var resumes []Resume
+	for rows.Next() {
+		r, err := scanResume(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		resumes = append(resumes, r)
+	}
+
+	return resumes, rows.Err()
+}
+
+func (s *sqlStore) GetResume(ctx context.Context, userID, resumeID string) (*Resume, error) {
+	query := `select ` + resumeColumns + ` from resumes where id = ? and user_id = ?`
+	r, err := scanResume(s.queryRow(ctx, query, resumeID, userID).Scan)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (s *sqlStore) SetResumeScheduled(ctx context.Context, userID, resumeID string, isScheduled bool) error {
+	query := `update resumes set is_scheduled = ? where id = ? and user_id = ?`
+	_, err := s.exec(ctx, query, boolToInt(isScheduled), resumeID, userID)
+	return err
+}
+
+func (s *sqlStore) ListDueResumes(ctx context.Context) ([]DueResume, error) {
+	query := `
+	select users.id, resumes.id, coalesce(resumes.title, ''),
+		coalesce(resumes.status, ''), coalesce(resumes.visibility, ''), coalesce(resumes.moderation_note, ''),
+		(select count(*) from resume_blacklist b where b.resume_id = resumes.id),
+		users.schedule_mode = ? and exists (select 1 from bump_slots b where b.user_id = users.id),
+		exists (select 1 from bump_slots b where b.user_id = users.id and b.slot_at <= ?),
+		tokens.access_token, tokens.refresh_token, coalesce(tokens.expires_in, 0), coalesce(tokens.obtained_at, '')
+	from users
+	join tokens on users.id = tokens.user_id
+	join resumes on users.id = resumes.user_id
+	where users.is_disabled = 0 and resumes.is_scheduled = 1
+	order by users.id
+	`
+	rows, err := s.query(ctx, query, ScheduleAuto, formatTime(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []DueResume
+	for rows.Next() {
+		var d DueResume
+		var r Resume
+		var blacklisted int
+		var at, rt, obtainedAt string
+		if err := rows.Scan(
+			&d.UserID, &d.ResumeID, &d.ResumeTitle,
+			&r.Status, &r.Visibility, &r.ModerationNote, &blacklisted,
+			&d.Auto, &d.SlotDue,
+			&at, &rt, &d.Token.ExpiresIn, &obtainedAt,
+		); err != nil {
+			return nil, err
+		}
+		d.SkipReason = r.SkipReason()
+		d.Warning = r.BlacklistWarning(blacklisted)
+		d.Token.ObtainedAt = parseTime(obtainedAt)
+
+		if err := decryptToken(&d.Token, at, rt); err != nil {
+			d.Error = err.Error()
+		}
+
+		due = append(due, d)
+	}
+
+	return due, rows.Err()
+}
+
+func (s *sqlStore) StartRun(ctx context.Context, run *Run) error {
+	run.StartedAt = time.Now()
+
+	return s.retry(ctx, func() error {
+		return s.queryRow(
+			ctx,
+			`insert into scheduler_runs (started_at, trigger, version) values (?, ?, ?) returning id`,
+			formatTime(run.StartedAt), run.Trigger, run.Version,
+		).Scan(&run.ID)
+	})
+}
+
+func (s *sqlStore) FinishRun(ctx context.Context, run *Run) error {
+	run.FinishedAt = time.Now()
+
+	query := `
+	update scheduler_runs
+	set finished_at = ?, attempted = ?, succeeded = ?, skipped = ?, failed = ?
+	where id = ?
+	`
+	_, err := s.exec(ctx, query, formatTime(run.FinishedAt), run.Attempted, run.Succeeded, run.Skipped, run.Failed, run.ID)
+	return err
+}
+
+func (s *sqlStore) AddAttempt(ctx context.Context, a *Attempt) error {
+	query := `
+	insert into scheduler (run_id, user_id, resume_id, resume_title, timestamp, status, error)
+	values (?, ?, ?, ?, ?, ?, ?)
+	`
+	var runID sql.NullInt64
+	if a.RunID != 0 {
+		runID = sql.NullInt64{Int64: a.RunID, Valid: true}
+	}
+
+	_, err := s.exec(ctx, query, runID, a.UserID, a.ResumeID, a.ResumeTitle, formatTime(a.Timestamp), a.Status, a.Error)
+	return err
+}
+
+func (s *sqlStore) ListRuns(ctx context.Context, limit int) ([]Run, error) {
+	query := `
+	select id, started_at, coalesce(finished_at, ''), trigger, attempted, succeeded, skipped, failed, coalesce(version, '')
+	from scheduler_runs
+	order by id desc
+	limit ?
+	`
+	rows, err := s.query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []Run
+	index := make(map[int64]int)
+	for rows.Next() {
+		var r Run
+		var startedAt, finishedAt string
+		if err := rows.Scan(
+			&r.ID,
+			&startedAt,
+			&finishedAt,
+			&r.Trigger,
+			&r.Attempted,
+			&r.Succeeded,
+			&r.Skipped,
+			&r.Failed,
+			&r.Version,
+		); err != nil {
+			return nil, err
+		}
+		r.StartedAt = parseTime(startedAt)
+		r.FinishedAt = parseTime(finishedAt)
+
+		index[r.ID] = len(runs)
+		runs = append(runs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	failures, err := s.query(ctx, `
+	select run_id, error, count(*) as n
+	from scheduler
+	where run_id in (select id from scheduler_runs order by id desc limit ?)
+	and error is not null and error != ''
+	group by run_id, error
+	order by n desc
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer failures.Close()
+
+	for failures.Next() {
+		var runID int64
+		var f FailureCount
+		if err := failures.Scan(&runID, &f.Error, &f.Count); err != nil {
+			return nil, err
+		}
+		if i, ok := index[runID]; ok {
+			runs[i].Failures = append(runs[i].Failures, f)
+		}
+	}
+
+	return runs, failures.Err()
+}
+
+func (s *sqlStore) ListAttempts(ctx context.Context, limit int) ([]Attempt, error) {
+	query := fmt.Sprintf(`
+	select coalesce(run_id, 0), coalesce(user_id, ''), coalesce(resume_id, ''), coalesce(resume_title, ''),
+		coalesce(timestamp, ''), coalesce(status, ''), coalesce(error, '')
+	from scheduler
+	order by %s desc
+	limit ?
+	`, s.d.seq)
+	rows, err := s.query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []Attempt
+	for rows.Next() {
+		var a Attempt
+		var timestamp string
+		if err := rows.Scan(&a.RunID, &a.UserID, &a.ResumeID, &a.ResumeTitle, &timestamp, &a.Status, &a.Error); err != nil {
+			return nil, err
+		}
+		a.Timestamp = parseTime(timestamp)
+		attempts = append(attempts, a)
+	}
+
+	return attempts, rows.Err()
+}
+
+func (s *sqlStore) FailureBreakdown(ctx context.Context, limit int) ([]FailureCount, error) {
+	query := fmt.Sprintf(`
+	select error, count(*) as n
+	from (select error from scheduler order by %s desc limit ?) recent
+	where error is not null and error != ''
+	group by error
+	order by n desc
+	`, s.d.seq)
+	rows, err := s.query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []FailureCount
+	for rows.Next() {
+		var f FailureCount
+		if err := rows.Scan(&f.Error, &f.Count); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+
+	return failures, rows.Err()
+}
+
+// changes are kept as json, titles may contain any separator
+func (s *sqlStore) AddResumeSync(ctx context.Context, rs *ResumeSync) error {
+	changes, err := json.Marshal(rs.Changes)
+	if err != nil {
+		return err
+	}
+
+	if rs.Timestamp.IsZero() {
+		rs.Timestamp = time.Now()
+	}
+
+	query := `insert into resume_syncs (user_id, timestamp, source, changes, error) values (?, ?, ?, ?, ?)`
+	_, err = s.exec(ctx, query, rs.UserID, formatTime(rs.Timestamp), rs.Source, string(changes), rs.Error)
+	return err
+}
+
+func (s *sqlStore) ListResumeSyncs(ctx context.Context, limit int) ([]ResumeSync, error) {
+	query := `
+	select id, coalesce(user_id, ''), timestamp, source, coalesce(changes, ''), coalesce(error, '')
+	from resume_syncs
+	order by id desc
+	limit ?
+	`
+	rows, err := s.query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var syncs []ResumeSync
+	for rows.Next() {
+		var rs ResumeSync
+		var timestamp, changes string
+		if err := rows.Scan(&rs.ID, &rs.UserID, &timestamp, &rs.Source, &changes, &rs.Error); err != nil {
+			return nil, err
+		}
+		rs.Timestamp = parseTime(timestamp)
+		if changes != "" {
+			if err := json.Unmarshal([]byte(changes), &rs.Changes); err != nil {
+				return nil, fmt.Errorf("resume sync %d: %w", rs.ID, err)
+			}
+		}
+		syncs = append(syncs, rs)
+	}
+
+	return syncs, rows.Err()
+}
+
+func (s *sqlStore) DeleteHistory(ctx context.Context, userID string) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.d.rebind(`delete from scheduler where user_id = ?`), userID); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, s.d.rebind(`delete from resume_syncs where user_id = ?`), userID)
+		return err
+	})
+}
+
+func (s *sqlStore) AddAudit(ctx context.Context, e *AuditEvent) error {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	query := `
+	insert into audit_log (timestamp, actor, action, user_id, target, ip, user_agent, details)
+	values (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := s.exec(ctx, query, formatTime(e.Timestamp), e.Actor, e.Action, e.UserID, e.Target, e.IP, e.UserAgent, e.Details)
+	return err
+}
+
+func (s *sqlStore) ListAudit(ctx context.Context, userID string, limit int) ([]AuditEvent, error) {
+	query := `
+	select id, timestamp, actor, action, coalesce(user_id, ''), coalesce(target, ''),
+		coalesce(ip, ''), coalesce(user_agent, ''), coalesce(details, '')
+	from audit_log
+	where ? = '' or user_id = ?
+	order by id desc
+	limit ?
+	`
+	rows, err := s.query(ctx, query, userID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		var timestamp string
+		if err := rows.Scan(&e.ID, &timestamp, &e.Actor, &e.Action, &e.UserID, &e.Target, &e.IP, &e.UserAgent, &e.Details); err != nil {
+			return nil, err
+		}
+		e.Timestamp = parseTime(timestamp)
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// timestamps are utc rfc3339, they compare as text
+func (s *sqlStore) PruneAudit(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.exec(ctx, `delete from audit_log where timestamp < ?`, formatTime(before))
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// sqliteBusyTimeout is how long, in milliseconds, a connection waits
+// for a lock held by the other binary before giving up
+const sqliteBusyTimeout = 5000
+
+// sqlite has one writer at a time, with WAL readers do not block it.
+// A few connections are enough and idle ones are kept so the
+// pragmas are not set up again on every request
+const (
+	sqliteMaxConns    = 4
+	sqliteReadConns   = 2
+	sqliteConnMaxIdle = 5 * time.Minute
+)
+
+func openSQLite(ctx context.Context, path string) (Repository, error) {
+	if path == "" {
+		return nil, fmt.Errorf("storage: no sqlite database path")
+	}
+
+	// pragmas are per connection, the dsn applies them to every one in the pool.
+	// The driver is picked at build time, see sqlite_cgo.go and sqlite_purego.go
+	db, err := sql.Open(sqliteDriver, sqliteDSN(path, "immediate"))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(sqliteMaxConns)
+	db.SetMaxIdleConns(sqliteMaxConns)
+	db.SetConnMaxIdleTime(sqliteConnMaxIdle)
+
+	s, err := newSQLStore(ctx, db, sqliteDialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// writes begin immediate so they queue on the busy timeout instead of
+	// failing on upgrade, the cgo driver does that for read-only ones too.
+	// Those get a pool whose transactions begin deferred and read a snapshot
+	reads, err := sql.Open(sqliteDriver, sqliteDSN(path, "deferred"))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	reads.SetMaxOpenConns(sqliteReadConns)
+	reads.SetMaxIdleConns(sqliteReadConns)
+	reads.SetConnMaxIdleTime(sqliteConnMaxIdle)
+	s.reads = reads
+
+	return s, nil
+}
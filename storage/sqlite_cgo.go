@@ -0,0 +1,26 @@
+//go:build !purego
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver needs cgo, build with -tags purego to drop it
+const sqliteDriver = "sqlite3"
+
+func sqliteDSN(path, txlock string) string {
+	return fmt.Sprintf("file:%s?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=%d&_txlock=%s", path, sqliteBusyTimeout, txlock)
+}
+
+func sqliteIsBusy(err error) bool {
+	var e sqlite3.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+
+	return e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked
+}
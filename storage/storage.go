@@ -0,0 +1,914 @@
+// Package storage keeps everything web and scheduler persist behind one
+// Repository, backed by SQLite or PostgreSQL.
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	// ErrNotEmpty is returned by Import, dumps only go into a fresh database
+	ErrNotEmpty = errors.New("database is not empty")
+	// ErrTokenBroken is returned by GetToken when the stored token does not decrypt
+	ErrTokenBroken = errors.New("token can not be decrypted")
+	// ErrCapReached is returned by ReserveApplication when the cap is used up
+	ErrCapReached = errors.New("application cap reached")
+)
+
+type User struct {
+	ID         string `json:"id"`
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	MiddleName string `json:"middle_name"`
+	IsDisabled bool   `json:"is_disabled"`
+	// ScheduleMode is ScheduleFixed or ScheduleAuto
+	ScheduleMode string `json:"schedule_mode"`
+	// TimeZone is the IANA name of the zone times are shown to the user in,
+	// empty until the browser or the user tells it
+	TimeZone string `json:"time_zone"`
+}
+
+// Location is the zone of TimeZone, fallback when it is empty or unknown
+func (u User) Location(fallback *time.Location) *time.Location {
+	if u.TimeZone == "" {
+		return fallback
+	}
+	loc, err := time.LoadLocation(u.TimeZone)
+	if err != nil {
+		return fallback
+	}
+	return loc
+}
+
+const (
+	// ScheduleFixed bumps at SCHEDULE_TIMES like cron does
+	ScheduleFixed = "fixed"
+	// ScheduleAuto bumps at the BumpSlots planned from views,
+	// at the fixed times until there are any
+	ScheduleAuto = "auto"
+)
+
+// Token holds decrypted tokens, they are encrypted on the way into the database.
+// ObtainedAt is zero for tokens stored before it was tracked
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresIn    uint      `json:"expires_in"`
+	ObtainedAt   time.Time `json:"-"`
+}
+
+func (t Token) ExpiresAt() (time.Time, bool) {
+	if t.ObtainedAt.IsZero() {
+		return time.Time{}, false
+	}
+
+	return t.ObtainedAt.Add(time.Duration(t.ExpiresIn) * time.Second), true
+}
+
+type Resume struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	Title        string    `json:"title"`
+	AlternateURL string    `json:"alternate_url"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	IsScheduled  bool      `json:"is_scheduled"`
+	// Status and Visibility are hh ids, see ResumeBlocked and VisibilityNoOne
+	Status         string `json:"status"`
+	Visibility     string `json:"visibility"`
+	ModerationNote string `json:"moderation_note"`
+}
+
+// resume statuses and visibilities hh sends that bumps care about
+const (
+	ResumePublished     = "published"
+	ResumeNotPublished  = "not_published"
+	ResumeBlocked       = "blocked"
+	VisibilityNoOne     = "no_one"
+	VisibilityBlacklist = "blacklist"
+	VisibilityClients   = "clients"
+	VisibilityEveryone  = "everyone"
+)
+
+var (
+	resumeStatusLabels = map[string]string{
+		ResumePublished:    "published",
+		ResumeNotPublished: "not published",
+		ResumeBlocked:      "blocked",
+	}
+	visibilityLabels = map[string]string{
+		VisibilityNoOne:     "no one",
+		"whitelist":         "selected employers only",
+		VisibilityBlacklist: "all but blocked employers",
+		VisibilityClients:   "hh employers only",
+		VisibilityEveryone:  "everyone",
+		"direct":            "anyone with the link",
+	}
+)
+
+func (r Resume) StatusLabel() string {
+	if l, ok := resumeStatusLabels[r.Status]; ok {
+		return l
+	}
+	return r.Status
+}
+
+func (r Resume) VisibilityLabel() string {
+	if l, ok := visibilityLabels[r.Visibility]; ok {
+		return l
+	}
+	return r.Visibility
+}
+
+// SkipReason tells why bumping the resume is pointless or bound to fail,
+// empty when it can be bumped. Resumes synced before statuses were
+// stored have none and are bumped as before
+func (r Resume) SkipReason() string {
+	switch {
+	case r.Status == ResumeBlocked && r.ModerationNote != "":
+		return "blocked by hh moderation: " + r.ModerationNote
+	case r.Status == ResumeBlocked:
+		return "blocked by hh moderation"
+	case r.Status == ResumeNotPublished:
+		return "not published on hh"
+	case r.Visibility == VisibilityNoOne:
+		return "hidden from everyone on hh"
+	default:
+		return ""
+	}
+}
+
+// BlacklistWarning is set when a resume has blacklisted employers but its
+// visibility is not all but blocked employers, hh ignores the blacklist then
+// and a bump puts the resume in front of them
+func (r Resume) BlacklistWarning(blacklisted int) string {
+	if blacklisted == 0 || (r.Visibility != VisibilityEveryone && r.Visibility != VisibilityClients) {
+		return ""
+	}
+
+	employers := fmt.Sprintf("%d employers", blacklisted)
+	if blacklisted == 1 {
+		employers = "1 employer"
+	}
+	return fmt.Sprintf("visible to %s, so hh ignores its blacklist of %s", r.VisibilityLabel(), employers)
+}
+
+// ModerationNote reads moderation_note of a resume, hh sends a list of
+// notes with names, older answers had a plain string
+func ModerationNote(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+
+	var notes []struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(raw, &notes) == nil {
+		names := make([]string, 0, len(notes))
+		for _, n := range notes {
+			if n.Name != "" {
+				names = append(names, n.Name)
+			}
+		}
+		return strings.Join(names, "; ")
+	}
+
+	var note struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(raw, &note) == nil {
+		return note.Name
+	}
+
+	return ""
+}
+
+// ResumeDiff lists titles of the resumes ReplaceResumes added,
+// updated and removed
+type ResumeDiff struct {
+	Added   []string `json:"added"`
+	Updated []string `json:"updated"`
+	Removed []string `json:"removed"`
+	// Blocked are the added or updated ones moderation has just blocked
+	Blocked []string `json:"blocked,omitempty"`
+}
+
+func (d ResumeDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Updated) == 0 && len(d.Removed) == 0
+}
+
+func (d ResumeDiff) String() string {
+	s := fmt.Sprintf("%d added, %d updated, %d removed", len(d.Added), len(d.Updated), len(d.Removed))
+	if len(d.Blocked) > 0 {
+		s += fmt.Sprintf(", %d blocked", len(d.Blocked))
+	}
+	return s
+}
+
+// DueResume is a resume the scheduler is going to publish,
+// Error is set when the tokens of its user could not be decrypted
+// and SkipReason when the last sync found the resume can not be bumped.
+// Warning does not stop a bump, see Resume.BlacklistWarning.
+// Auto is set for users in auto mode with planned slots, they are only
+// bumped once SlotDue
+type DueResume struct {
+	UserID      string
+	ResumeID    string
+	ResumeTitle string
+	Token       Token
+	Error       string
+	SkipReason  string
+	Warning     string
+	Auto        bool
+	SlotDue     bool
+}
+
+// UserSummary is a user with the numbers operators look at
+type UserSummary struct {
+	User
+	ResumeCount    int       `json:"resume_count"`
+	ScheduledCount int       `json:"scheduled_count"`
+	TokenStatus    string    `json:"token_status"`
+	LastAttempt    time.Time `json:"last_attempt"`
+	LastError      string    `json:"last_error"`
+	// SyncedAt is when resumes of the user were last fetched from hh, zero before the first time
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+const (
+	TokenOK      = "ok"
+	TokenMissing = "missing"
+	TokenBroken  = "broken"
+)
+
+const (
+	TriggerCron   = "cron"
+	TriggerDaemon = "daemon"
+	TriggerManual = "manual"
+	// TriggerAuto is a daemon run woken for a planned BumpSlot,
+	// it only bumps users in auto mode whose slot is due
+	TriggerAuto = "auto"
+)
+
+const (
+	AttemptOK      = "ok"
+	AttemptFailed  = "failed"
+	AttemptSkipped = "skipped"
+)
+
+type Run struct {
+	ID         int64          `json:"id"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Trigger    string         `json:"trigger"`
+	Attempted  int            `json:"attempted"`
+	Succeeded  int            `json:"succeeded"`
+	Skipped    int            `json:"skipped"`
+	Failed     int            `json:"failed"`
+	Version    string         `json:"version"`
+	Failures   []FailureCount `json:"failures,omitempty"`
+}
+
+// Attempt is one row of the scheduler history, RunID is zero
+// and Timestamp may be zero for rows written before runs were recorded
+type Attempt struct {
+	RunID       int64     `json:"run_id,omitempty"`
+	UserID      string    `json:"user_id"`
+	ResumeID    string    `json:"resume_id"`
+	ResumeTitle string    `json:"resume_title"`
+	Timestamp   time.Time `json:"timestamp"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error"`
+}
+
+// ResumeSync records one reconciliation of stored resumes of a user with hh,
+// syncs that changed nothing and did not fail are not recorded
+type ResumeSync struct {
+	ID        int64      `json:"id"`
+	UserID    string     `json:"user_id"`
+	Timestamp time.Time  `json:"timestamp"`
+	Source    string     `json:"source"`
+	Changes   ResumeDiff `json:"changes"`
+	Error     string     `json:"error"`
+}
+
+const (
+	// SyncJob runs before every scheduler run
+	SyncJob = "job"
+	// SyncManual is an operator syncing from the admin commands or dashboard
+	SyncManual = "manual"
+	// SyncUser is a user refreshing their resumes
+	SyncUser = "user"
+	// SyncPublish removes a resume hh answered 404 to on publish
+	SyncPublish = "publish"
+)
+
+// Match is a vacancy hh finds similar to a resume. FirstSeenAt is when
+// it first came up for that resume, later fetches keep it
+type Match struct {
+	ResumeID    string    `json:"resume_id"`
+	VacancyID   string    `json:"vacancy_id"`
+	UserID      string    `json:"user_id"`
+	Name        string    `json:"name"`
+	EmployerID  string    `json:"employer_id"`
+	Employer    string    `json:"employer"`
+	URL         string    `json:"url"`
+	Salary      string    `json:"salary"`
+	Area        string    `json:"area"`
+	PublishedAt time.Time `json:"published_at"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	Interesting bool      `json:"interesting"`
+}
+
+// HiddenEmployer is an employer a user does not want to see matches from
+type HiddenEmployer struct {
+	UserID     string    `json:"user_id"`
+	EmployerID string    `json:"employer_id"`
+	Name       string    `json:"name"`
+	HiddenAt   time.Time `json:"hidden_at"`
+}
+
+// BlacklistedEmployer is an employer a resume is hidden from on hh,
+// a mirror of the resume blacklist there
+type BlacklistedEmployer struct {
+	UserID     string    `json:"user_id"`
+	ResumeID   string    `json:"resume_id"`
+	EmployerID string    `json:"employer_id"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	AddedAt    time.Time `json:"added_at"`
+}
+
+// ResumeView is an employer opening a resume, as hh lists them
+type ResumeView struct {
+	UserID       string    `json:"user_id"`
+	ResumeID     string    `json:"resume_id"`
+	ViewedAt     time.Time `json:"viewed_at"`
+	EmployerID   string    `json:"employer_id"`
+	EmployerName string    `json:"employer_name"`
+}
+
+// BumpSlot is a time picked for the next bump of a user in auto mode,
+// Reason tells why it was picked
+type BumpSlot struct {
+	UserID string    `json:"user_id"`
+	At     time.Time `json:"at"`
+	Reason string    `json:"reason"`
+}
+
+// ResumeSnapshot is a resume as hh returned it in full, a new one is
+// only kept when something besides counters and timestamps changed
+type ResumeSnapshot struct {
+	ID       int64     `json:"id"`
+	UserID   string    `json:"user_id"`
+	ResumeID string    `json:"resume_id"`
+	TakenAt  time.Time `json:"taken_at"`
+	Hash     string    `json:"hash"`
+	Data     string    `json:"data"`
+}
+
+// SnapshotChange is one difference between two snapshots of a resume
+type SnapshotChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// CoverLetter is a letter template, {vacancy}, {employer} and {name}
+// in Body are filled in when applying
+type CoverLetter struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Application is one apply to a vacancy made from here, Message
+// is the letter as it was sent
+type Application struct {
+	ID            int64     `json:"id"`
+	UserID        string    `json:"user_id"`
+	ResumeID      string    `json:"resume_id"`
+	VacancyID     string    `json:"vacancy_id"`
+	VacancyName   string    `json:"vacancy_name"`
+	Employer      string    `json:"employer"`
+	Message       string    `json:"message"`
+	CreatedAt     time.Time `json:"created_at"`
+	Status        string    `json:"status"`
+	NegotiationID string    `json:"negotiation_id"`
+	Error         string    `json:"error"`
+}
+
+// pending applications are reserved and wait for hh to answer,
+// pending and sent ones count toward the cap
+const (
+	ApplicationPending = "pending"
+	ApplicationSent    = "sent"
+	ApplicationFailed  = "failed"
+)
+
+// SavedSearch is a vacancy search a user keeps running. Area is an hh
+// area id, Experience and Schedule are ids from the hh dictionaries,
+// empty and zero fields do not narrow the search
+type SavedSearch struct {
+	ID         int64     `json:"id"`
+	UserID     string    `json:"user_id"`
+	Name       string    `json:"name"`
+	Text       string    `json:"text"`
+	Area       string    `json:"area"`
+	Salary     int       `json:"salary"`
+	Experience string    `json:"experience"`
+	Schedule   string    `json:"schedule"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastRunAt  time.Time `json:"last_run_at"`
+	LastError  string    `json:"last_error"`
+	// NewCount is filled by ListSearches, results since the last visit
+	NewCount int `json:"-"`
+}
+
+// SearchResult is a vacancy a saved search found, FirstSeenAt
+// is when that search found it first
+type SearchResult struct {
+	SearchID    int64     `json:"search_id"`
+	VacancyID   string    `json:"vacancy_id"`
+	UserID      string    `json:"user_id"`
+	Name        string    `json:"name"`
+	EmployerID  string    `json:"employer_id"`
+	Employer    string    `json:"employer"`
+	URL         string    `json:"url"`
+	Salary      string    `json:"salary"`
+	Area        string    `json:"area"`
+	PublishedAt time.Time `json:"published_at"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+}
+
+// Negotiation is an application of a user to a vacancy as hh last reported
+// it, State is the hh state id and Stage where it is on the board
+type Negotiation struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	ResumeID    string    `json:"resume_id"`
+	VacancyID   string    `json:"vacancy_id"`
+	VacancyName string    `json:"vacancy_name"`
+	Employer    string    `json:"employer"`
+	URL         string    `json:"url"`
+	State       string    `json:"state"`
+	Viewed      bool      `json:"viewed"`
+	Stage       string    `json:"stage"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Stages of the board, in order
+const (
+	StageApplied  = "applied"
+	StageViewed   = "viewed"
+	StageInvited  = "invited"
+	StageRejected = "rejected"
+)
+
+var Stages = []string{StageApplied, StageViewed, StageInvited, StageRejected}
+
+// NegotiationStage places an hh state on the board, an application
+// stays applied until the employer opens it
+func NegotiationStage(state string, viewed bool) string {
+	switch state {
+	case "discard":
+		return StageRejected
+	case "invitation", "interview", "offer", "hired":
+		return StageInvited
+	}
+
+	if viewed {
+		return StageViewed
+	}
+	return StageApplied
+}
+
+// NegotiationChange is a move of a negotiation between stages,
+// From is empty the first time a negotiation is seen
+type NegotiationChange struct {
+	ID            int64     `json:"id"`
+	NegotiationID string    `json:"negotiation_id"`
+	UserID        string    `json:"user_id"`
+	VacancyName   string    `json:"vacancy_name"`
+	Timestamp     time.Time `json:"timestamp"`
+	From          string    `json:"from"`
+	To            string    `json:"to"`
+}
+
+// Notification is something users should not miss, shown
+// until they open the page it points to
+type Notification struct {
+	ID        int64     `json:"id"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Kind      string    `json:"kind"`
+	Text      string    `json:"text"`
+	URL       string    `json:"url"`
+	Read      bool      `json:"read"`
+}
+
+const (
+	NotifyInvitation = "invitation"
+	NotifySearch     = "search"
+	NotifyBlocked    = "blocked"
+)
+
+// AuditEvent is one row of the append-only audit log. UserID is whose data
+// was touched, Actor who touched it: a user id, ActorScheduler or ActorCLI
+type AuditEvent struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	UserID    string    `json:"user_id"`
+	Target    string    `json:"target"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Details   string    `json:"details"`
+}
+
+const (
+	ActorScheduler = "scheduler"
+	ActorCLI       = "cli"
+)
+
+const (
+	AuditLogin           = "login"
+	AuditLoginRefused    = "login.refused"
+	AuditLogout          = "logout"
+	AuditSchedule        = "resume.schedule"
+	AuditUnschedule      = "resume.unschedule"
+	AuditResumeRemove    = "resume.remove"
+	AuditResumesSync     = "resumes.sync"
+	AuditTokenRefresh    = "token.refresh"
+	AuditDataExport      = "user.export"
+	AuditUserDelete      = "user.delete"
+	AuditUserDisable     = "user.disable"
+	AuditUserEnable      = "user.enable"
+	AuditUserPurge       = "user.purge"
+	AuditDatabaseImport  = "database.import"
+	AuditAccountLink     = "account.link"
+	AuditAccountUnlink   = "account.unlink"
+	AuditVacancyApply    = "vacancy.apply"
+	AuditBlacklistAdd    = "blacklist.add"
+	AuditBlacklistRemove = "blacklist.remove"
+	AuditScheduleMode    = "user.schedule_mode"
+)
+
+type FailureCount struct {
+	Error string `json:"error"`
+	Count int    `json:"count"`
+}
+
+// DumpVersion is bumped when Dump changes in a way older imports can not read
+const DumpVersion = 1
+
+// Dump is a logical copy of the database for moving between hosts and backends.
+// Tokens are only there when a dump key was given, sealed with that key
+type Dump struct {
+	Version    int           `json:"version"`
+	ExportedAt time.Time     `json:"exported_at"`
+	Users      []User        `json:"users"`
+	Tokens     []DumpToken   `json:"tokens,omitempty"`
+	Resumes    []Resume      `json:"resumes"`
+	Runs       []Run         `json:"runs"`
+	Attempts   []Attempt     `json:"attempts"`
+	Syncs      []ResumeSync  `json:"syncs"`
+	Audit      []AuditEvent  `json:"audit"`
+	Links      []AccountLink `json:"account_links,omitempty"`
+
+	Negotiations       []Negotiation         `json:"negotiations,omitempty"`
+	NegotiationChanges []NegotiationChange   `json:"negotiation_changes,omitempty"`
+	Notifications      []Notification        `json:"notifications,omitempty"`
+	Matches            []Match               `json:"matches,omitempty"`
+	HiddenEmployers    []HiddenEmployer      `json:"hidden_employers,omitempty"`
+	Searches           []SavedSearch         `json:"searches,omitempty"`
+	SearchResults      []SearchResult        `json:"search_results,omitempty"`
+	CoverLetters       []CoverLetter         `json:"cover_letters,omitempty"`
+	Applications       []Application         `json:"applications,omitempty"`
+	Snapshots          []ResumeSnapshot      `json:"resume_snapshots,omitempty"`
+	Blacklist          []BlacklistedEmployer `json:"resume_blacklist,omitempty"`
+	Views              []ResumeView          `json:"resume_views,omitempty"`
+	Slots              []BumpSlot            `json:"bump_slots,omitempty"`
+}
+
+type DumpToken struct {
+	UserID       string    `json:"user_id"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresIn    uint      `json:"expires_in"`
+	ObtainedAt   time.Time `json:"obtained_at"`
+}
+
+// UserData is everything stored about one user, for them to download.
+// The token is only described, its values never leave the database
+type UserData struct {
+	ExportedAt time.Time     `json:"exported_at"`
+	User       User          `json:"user"`
+	Token      *TokenInfo    `json:"token,omitempty"`
+	Resumes    []Resume      `json:"resumes"`
+	Attempts   []Attempt     `json:"bump_history"`
+	Syncs      []ResumeSync  `json:"resume_syncs"`
+	Links      []AccountLink `json:"account_links"`
+
+	Negotiations       []Negotiation         `json:"negotiations"`
+	NegotiationChanges []NegotiationChange   `json:"negotiation_changes"`
+	Notifications      []Notification        `json:"notifications"`
+	Matches            []Match               `json:"matches"`
+	HiddenEmployers    []HiddenEmployer      `json:"hidden_employers"`
+	Searches           []SavedSearch         `json:"searches"`
+	SearchResults      []SearchResult        `json:"search_results"`
+	CoverLetters       []CoverLetter         `json:"cover_letters"`
+	Applications       []Application         `json:"applications"`
+	Snapshots          []ResumeSnapshot      `json:"resume_snapshots"`
+	Blacklist          []BlacklistedEmployer `json:"resume_blacklist"`
+	Views              []ResumeView          `json:"resume_views"`
+	Slots              []BumpSlot            `json:"bump_slots"`
+}
+
+type TokenInfo struct {
+	Status     string    `json:"status"`
+	ObtainedAt time.Time `json:"obtained_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// AccountLink lets whoever logged in as OwnerID act as UserID too,
+// each account keeps its own tokens and schedule
+type AccountLink struct {
+	OwnerID  string    `json:"owner_id"`
+	UserID   string    `json:"user_id"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// Tombstone is what is left of a deleted account: when, by whom
+// and whether its hh grant was revoked
+type Tombstone struct {
+	UserID    string    `json:"user_id"`
+	DeletedAt time.Time `json:"deleted_at"`
+	Actor     string    `json:"actor"`
+	Revoked   bool      `json:"revoked"`
+	Details   string    `json:"details"`
+}
+
+type UserStore interface {
+	UpsertUser(ctx context.Context, u *User) error
+	GetUser(ctx context.Context, userID string) (*User, error)
+	ListUsers(ctx context.Context) ([]UserSummary, error)
+	SetUserDisabled(ctx context.Context, userID string, isDisabled bool) error
+	// SetTimeZone stores the IANA zone name of a user, the caller checks it loads
+	SetTimeZone(ctx context.Context, userID, zone string) error
+	// DeleteUser removes the user together with tokens and resumes
+	DeleteUser(ctx context.Context, userID string) error
+	// PurgeUser removes the user, tokens, resumes, scheduler history and resume
+	// syncs, clears ip and user agent from the audit log of the user and
+	// records t in one transaction. The rest of the audit log is kept
+	PurgeUser(ctx context.Context, t *Tombstone) error
+	ListTombstones(ctx context.Context, limit int) ([]Tombstone, error)
+}
+
+type AccountStore interface {
+	// LinkAccount is a no-op when the link is already there
+	LinkAccount(ctx context.Context, ownerID, userID string) error
+	UnlinkAccount(ctx context.Context, ownerID, userID string) error
+	// ListLinkedAccounts returns the accounts ownerID can act as, ownerID itself is not among them
+	ListLinkedAccounts(ctx context.Context, ownerID string) ([]User, error)
+}
+
+type TokenStore interface {
+	// SaveToken stores tokens of a user, code is kept from the
+	// previous save when empty
+	SaveToken(ctx context.Context, userID, code string, t *Token) error
+	GetToken(ctx context.Context, userID string) (*Token, error)
+}
+
+type ResumeStore interface {
+	UpsertResumes(ctx context.Context, userID string, resumes []Resume) error
+	DeleteResumes(ctx context.Context, userID string, resumeIDs []string) error
+	// ReplaceResumes makes the stored resumes of a user match resumes in one
+	// transaction, is_scheduled of resumes that are still there is kept.
+	// It records the sync time ListUsers reports as SyncedAt
+	ReplaceResumes(ctx context.Context, userID string, resumes []Resume) (ResumeDiff, error)
+	// ListResumes lists resumes of a user, of every user when userID is empty
+	ListResumes(ctx context.Context, userID string) ([]Resume, error)
+	GetResume(ctx context.Context, userID, resumeID string) (*Resume, error)
+}
+
+type SnapshotStore interface {
+	// SaveResumeSnapshot stores s unless the latest snapshot of the
+	// resume has the same hash, it tells whether s was stored
+	SaveResumeSnapshot(ctx context.Context, s *ResumeSnapshot) (bool, error)
+	// ListResumeSnapshots returns the latest snapshots of a resume, newest first
+	ListResumeSnapshots(ctx context.Context, userID, resumeID string, limit int) ([]ResumeSnapshot, error)
+	// LatestResumeSnapshots returns the newest snapshot of every resume of a user by resume id
+	LatestResumeSnapshots(ctx context.Context, userID string) (map[string]ResumeSnapshot, error)
+}
+
+type BlacklistStore interface {
+	// ReplaceBlacklist makes the mirror of a resume blacklist match
+	// employers, added_at of employers still there is kept
+	ReplaceBlacklist(ctx context.Context, userID, resumeID string, employers []BlacklistedEmployer) error
+	AddBlacklisted(ctx context.Context, e *BlacklistedEmployer) error
+	RemoveBlacklisted(ctx context.Context, userID, resumeID, employerID string) error
+	ListBlacklist(ctx context.Context, userID, resumeID string) ([]BlacklistedEmployer, error)
+	// CountBlacklisted counts blacklisted employers per resume of a user
+	CountBlacklisted(ctx context.Context, userID string) (map[string]int, error)
+}
+
+type ScheduleStore interface {
+	SetResumeScheduled(ctx context.Context, userID, resumeID string, isScheduled bool) error
+	ListDueResumes(ctx context.Context) ([]DueResume, error)
+	// SetScheduleMode switches a user between ScheduleFixed and ScheduleAuto,
+	// planned slots are dropped either way
+	SetScheduleMode(ctx context.Context, userID, mode string) error
+	// ReplaceBumpSlots replaces the planned slots of a user
+	ReplaceBumpSlots(ctx context.Context, userID string, slots []BumpSlot) error
+	ListBumpSlots(ctx context.Context, userID string) ([]BumpSlot, error)
+	// NextBumpSlot is the earliest slot after a time among active users in auto mode,
+	// zero when there is none
+	NextBumpSlot(ctx context.Context, after time.Time) (time.Time, error)
+}
+
+type ViewStore interface {
+	// SaveResumeViews adds views not stored before and returns how many were added
+	SaveResumeViews(ctx context.Context, userID, resumeID string, views []ResumeView) (int, error)
+	// ListResumeViews returns views of every resume of a user since a time, oldest first
+	ListResumeViews(ctx context.Context, userID string, since time.Time) ([]ResumeView, error)
+	// ListBumpTimes returns when resumes of a user were published since a time, oldest first
+	ListBumpTimes(ctx context.Context, userID string, since time.Time) ([]time.Time, error)
+}
+
+type HistoryStore interface {
+	StartRun(ctx context.Context, run *Run) error
+	FinishRun(ctx context.Context, run *Run) error
+	AddAttempt(ctx context.Context, a *Attempt) error
+	// ListRuns returns the latest runs with their failures grouped by error
+	ListRuns(ctx context.Context, limit int) ([]Run, error)
+	ListAttempts(ctx context.Context, limit int) ([]Attempt, error)
+	// FailureBreakdown groups errors of the latest limit attempts
+	FailureBreakdown(ctx context.Context, limit int) ([]FailureCount, error)
+	AddResumeSync(ctx context.Context, rs *ResumeSync) error
+	ListResumeSyncs(ctx context.Context, limit int) ([]ResumeSync, error)
+	// DeleteHistory removes scheduler attempts and resume syncs of a user
+	DeleteHistory(ctx context.Context, userID string) error
+}
+
+type MatchStore interface {
+	// SaveMatches adds matches of a resume that were not seen before
+	// and refreshes the others, it returns how many were added
+	SaveMatches(ctx context.Context, userID, resumeID string, matches []Match) (int, error)
+	// ListMatches returns matches of a resume without hidden employers, newest first
+	ListMatches(ctx context.Context, userID, resumeID string) ([]Match, error)
+	// CountNewMatches counts matches per resume of a user that came up
+	// after the last MarkMatchesSeen
+	CountNewMatches(ctx context.Context, userID string) (map[string]int, error)
+	// MarkMatchesSeen records a visit and returns the previous one, zero on the first
+	MarkMatchesSeen(ctx context.Context, userID, resumeID string) (time.Time, error)
+	SetMatchInteresting(ctx context.Context, userID, resumeID, vacancyID string, interesting bool) error
+	HideEmployer(ctx context.Context, e *HiddenEmployer) error
+	UnhideEmployer(ctx context.Context, userID, employerID string) error
+	ListHiddenEmployers(ctx context.Context, userID string) ([]HiddenEmployer, error)
+}
+
+type SearchStore interface {
+	CreateSearch(ctx context.Context, s *SavedSearch) error
+	// ListSearches returns searches of a user, of every user when userID is empty
+	ListSearches(ctx context.Context, userID string) ([]SavedSearch, error)
+	GetSearch(ctx context.Context, userID string, searchID int64) (*SavedSearch, error)
+	// DeleteSearch removes a search with its results
+	DeleteSearch(ctx context.Context, userID string, searchID int64) error
+	// SaveSearchResults adds results not found before, records the run
+	// and returns how many were added
+	SaveSearchResults(ctx context.Context, searchID int64, results []SearchResult) (int, error)
+	SetSearchError(ctx context.Context, searchID int64, runErr string) error
+	// ListSearchResults returns results without hidden employers, newest first
+	ListSearchResults(ctx context.Context, userID string, searchID int64, limit int) ([]SearchResult, error)
+	// MarkSearchSeen records a visit and returns the previous one, zero on the first
+	MarkSearchSeen(ctx context.Context, userID string, searchID int64) (time.Time, error)
+}
+
+type ApplicationStore interface {
+	CreateCoverLetter(ctx context.Context, l *CoverLetter) error
+	ListCoverLetters(ctx context.Context, userID string) ([]CoverLetter, error)
+	GetCoverLetter(ctx context.Context, userID string, letterID int64) (*CoverLetter, error)
+	DeleteCoverLetter(ctx context.Context, userID string, letterID int64) error
+	// ReserveApplication records a as pending unless the user already has
+	// limit pending or sent applications since then, ErrCapReached otherwise.
+	// A limit of zero or less is no cap
+	ReserveApplication(ctx context.Context, a *Application, since time.Time, limit int) error
+	// FinishApplication records what hh answered to a reserved application
+	FinishApplication(ctx context.Context, a *Application) error
+	CountApplications(ctx context.Context, userID string, since time.Time) (int, error)
+	ListApplications(ctx context.Context, userID string, limit int) ([]Application, error)
+}
+
+type NegotiationStore interface {
+	// SaveNegotiations upserts negotiations of a user in one transaction
+	// and records and returns the ones that changed stage
+	SaveNegotiations(ctx context.Context, userID string, negotiations []Negotiation) ([]NegotiationChange, error)
+	// ListNegotiations returns negotiations of a user, latest updated first
+	ListNegotiations(ctx context.Context, userID string) ([]Negotiation, error)
+	ListNegotiationChanges(ctx context.Context, userID string, limit int) ([]NegotiationChange, error)
+}
+
+type NotificationStore interface {
+	AddNotification(ctx context.Context, n *Notification) error
+	// ListNotifications returns the latest notifications of a user, unread ones included
+	ListNotifications(ctx context.Context, userID string, limit int) ([]Notification, error)
+	CountUnreadNotifications(ctx context.Context, userID string) (int, error)
+	MarkNotificationsRead(ctx context.Context, userID string) error
+}
+
+type AuditStore interface {
+	AddAudit(ctx context.Context, e *AuditEvent) error
+	// ListAudit returns the latest events about a user, about anyone when userID is empty
+	ListAudit(ctx context.Context, userID string, limit int) ([]AuditEvent, error)
+	// PruneAudit is the only way rows leave the audit log
+	PruneAudit(ctx context.Context, before time.Time) (int64, error)
+}
+
+type BackupStore interface {
+	// Backup writes a consistent copy of a sqlite database to path
+	// while both binaries keep using it, path must not exist
+	Backup(ctx context.Context, path string) error
+	// Export reads users, resumes and history, tokens too when dumpKey is set
+	Export(ctx context.Context, dumpKey string) (*Dump, error)
+	// Import loads a dump into an empty database in one transaction,
+	// dumpKey opens the tokens in it
+	Import(ctx context.Context, d *Dump, dumpKey string) error
+	// ExportUser collects what is stored about one user
+	ExportUser(ctx context.Context, userID string) (*UserData, error)
+}
+
+type Repository interface {
+	UserStore
+	AccountStore
+	TokenStore
+	ResumeStore
+	SnapshotStore
+	BlacklistStore
+	ScheduleStore
+	ViewStore
+	HistoryStore
+	MatchStore
+	SearchStore
+	ApplicationStore
+	NegotiationStore
+	NotificationStore
+	AuditStore
+	BackupStore
+
+	Close() error
+}
+
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+type Config struct {
+	Driver string
+	// DSN is a file path for sqlite and a connection url for postgres
+	DSN string
+}
+
+// ConfigFromEnv reads DB_DRIVER (sqlite by default), DB_NAME for sqlite
+// and DATABASE_URL for postgres
+func ConfigFromEnv() Config {
+	cfg := Config{Driver: os.Getenv("DB_DRIVER")}
+	if cfg.Driver == "" {
+		cfg.Driver = DriverSQLite
+	}
+
+	switch cfg.Driver {
+	case DriverPostgres:
+		cfg.DSN = os.Getenv("DATABASE_URL")
+	default:
+		cfg.DSN = os.Getenv("DB_NAME")
+	}
+
+	return cfg
+}
+
+// Open connects to the configured backend and brings its schema up to date
+func Open(ctx context.Context, cfg Config) (Repository, error) {
+	switch cfg.Driver {
+	case DriverSQLite:
+		return openSQLite(ctx, cfg.DSN)
+	case DriverPostgres:
+		return openPostgres(ctx, cfg.DSN)
+	default:
+		return nil, fmt.Errorf("storage: unknown driver %q", cfg.Driver)
+	}
+}
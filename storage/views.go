@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const viewColumns = `user_id, resume_id, viewed_at, employer_id, coalesce(employer_name, '')`
+
+func scanViews(rows *sql.Rows) ([]ResumeView, error) {
+	var views []ResumeView
+	for rows.Next() {
+		var v ResumeView
+		var viewedAt string
+		if err := rows.Scan(&v.UserID, &v.ResumeID, &viewedAt, &v.EmployerID, &v.EmployerName); err != nil {
+			return nil, err
+		}
+		v.ViewedAt = parseTime(viewedAt)
+		views = append(views, v)
+	}
+
+	return views, rows.Err()
+}
+
+func scanSlots(rows *sql.Rows) ([]BumpSlot, error) {
+	var slots []BumpSlot
+	for rows.Next() {
+		var slot BumpSlot
+		var at string
+		if err := rows.Scan(&slot.UserID, &at, &slot.Reason); err != nil {
+			return nil, err
+		}
+		slot.At = parseTime(at)
+		slots = append(slots, slot)
+	}
+
+	return slots, rows.Err()
+}
+
+func (s *sqlStore) SaveResumeViews(ctx context.Context, userID, resumeID string, views []ResumeView) (int, error) {
+	var added int
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		added = 0
+
+		stmt, err := tx.PrepareContext(ctx, s.d.rebind(`
+		insert into resume_views (user_id, resume_id, viewed_at, employer_id, employer_name) values (?, ?, ?, ?, ?)
+		on conflict(resume_id, viewed_at, employer_id) do nothing
+		`))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, v := range views {
+			res, err := stmt.ExecContext(ctx, userID, resumeID, formatTime(v.ViewedAt), v.EmployerID, v.EmployerName)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err == nil {
+				added += int(n)
+			}
+		}
+
+		return nil
+	})
+
+	return added, err
+}
+
+func (s *sqlStore) ListResumeViews(ctx context.Context, userID string, since time.Time) ([]ResumeView, error) {
+	rows, err := s.query(ctx, `
+	select `+viewColumns+`
+	from resume_views
+	where user_id = ? and viewed_at >= ?
+	order by viewed_at
+	`, userID, formatTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanViews(rows)
+}
+
+func (s *sqlStore) ListBumpTimes(ctx context.Context, userID string, since time.Time) ([]time.Time, error) {
+	rows, err := s.query(ctx, `
+	select timestamp
+	from scheduler
+	where user_id = ? and status = ? and timestamp >= ?
+	order by timestamp
+	`, userID, AttemptOK, formatTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var ts string
+		if err := rows.Scan(&ts); err != nil {
+			return nil, err
+		}
+		times = append(times, parseTime(ts))
+	}
+
+	return times, rows.Err()
+}
+
+func (s *sqlStore) SetScheduleMode(ctx context.Context, userID, mode string) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, s.d.rebind(`update users set schedule_mode = ? where id = ?`), mode, userID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, s.d.rebind(`delete from bump_slots where user_id = ?`), userID)
+		return err
+	})
+}
+
+func (s *sqlStore) ReplaceBumpSlots(ctx context.Context, userID string, slots []BumpSlot) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, s.d.rebind(`delete from bump_slots where user_id = ?`), userID); err != nil {
+			return err
+		}
+
+		for _, slot := range slots {
+			if _, err := tx.ExecContext(
+				ctx,
+				s.d.rebind(`insert into bump_slots (user_id, slot_at, reason) values (?, ?, ?)`),
+				userID, formatTime(slot.At), slot.Reason,
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *sqlStore) ListBumpSlots(ctx context.Context, userID string) ([]BumpSlot, error) {
+	rows, err := s.query(ctx, `
+	select user_id, slot_at, coalesce(reason, '')
+	from bump_slots
+	where user_id = ?
+	order by slot_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSlots(rows)
+}
+
+func (s *sqlStore) NextBumpSlot(ctx context.Context, after time.Time) (time.Time, error) {
+	var next string
+	err := s.queryRow(ctx, `
+	select coalesce(min(b.slot_at), '')
+	from bump_slots b
+	join users u on u.id = b.user_id
+	where u.schedule_mode = ? and u.is_disabled = 0 and b.slot_at > ?
+	`, ScheduleAuto, formatTime(after)).Scan(&next)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return parseTime(next), nil
+}
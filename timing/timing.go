@@ -0,0 +1,247 @@
+// Package timing picks bump times for users in the auto schedule mode.
+// It looks at when employers opened the resumes of a user after earlier
+// bumps, hour by hour of the week, and plans the next bumps at the hours
+// that got the most views while keeping to the cooldown hh has between them.
+package timing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"hhcv/storage"
+)
+
+const (
+	// Cooldown is how long hh makes a resume wait between bumps,
+	// views in this window after a bump are credited to it
+	Cooldown = 4 * time.Hour
+	// MinViews is how many views a user needs before slots are planned,
+	// until then the user is bumped at the fixed times
+	MinViews = 20
+	// SlotsPerDay is how many slots Replan plans ahead
+	SlotsPerDay = 3
+	// History is how far back views and bumps are looked at
+	History = 8 * 7 * 24 * time.Hour
+
+	// minBumps is how many bumps an hour needs for its views after bumps
+	// to be trusted over the views it gets anyway
+	minBumps = 2
+	week     = 7 * 24 * time.Hour
+)
+
+const (
+	defaultZone       = "Europe/Moscow"
+	defaultFixedTimes = "08:30,12:30,16:30"
+)
+
+// Location is the SCHEDULE_TZ zone the fixed times are in, slots of
+// users who have not told their own zone are planned in it too
+func Location() (*time.Location, error) {
+	zone := os.Getenv("SCHEDULE_TZ")
+	if zone == "" {
+		zone = defaultZone
+	}
+	return time.LoadLocation(zone)
+}
+
+// FixedTimes reads SCHEDULE_TIMES (HH:MM, comma separated) as offsets
+// from midnight in Location, sorted, defaults match the crontab
+func FixedTimes() ([]time.Duration, error) {
+	raw := os.Getenv("SCHEDULE_TIMES")
+	if raw == "" {
+		raw = defaultFixedTimes
+	}
+
+	var times []time.Duration
+	for _, s := range strings.Split(raw, ",") {
+		t, err := time.Parse("15:04", strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("bad SCHEDULE_TIMES entry %q: %w", s, err)
+		}
+		times = append(times, time.Duration(t.Hour())*time.Hour+time.Duration(t.Minute())*time.Minute)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	return times, nil
+}
+
+// hourOfWeek numbers hours from Sunday 00:00 in loc
+func hourOfWeek(t time.Time, loc *time.Location) int {
+	t = t.In(loc)
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+// hourStats is what was seen at one hour of the week
+type hourStats struct {
+	bumps      int
+	afterBumps int
+	// weekly is views in the Cooldown window starting at this hour, per week of history
+	weekly float64
+	// daily is the same for this hour on any day, per day of history,
+	// weekdays without views of their own fall back to it
+	daily float64
+}
+
+func (h hourStats) score() float64 {
+	switch {
+	case h.bumps >= minBumps:
+		return float64(h.afterBumps) / float64(h.bumps)
+	case h.weekly > 0:
+		return h.weekly
+	default:
+		return h.daily
+	}
+}
+
+func (h hourStats) reason(at time.Time) string {
+	day, window := at.Format("Mon"), fmt.Sprintf("%s-%s", at.Format("15:04"), at.Add(Cooldown).Format("15:04"))
+	switch {
+	case h.bumps >= minBumps:
+		return fmt.Sprintf("%s %s: %.1f views on average after %d earlier bumps at this hour", day, window, h.score(), h.bumps)
+	case h.weekly > 0:
+		return fmt.Sprintf("%s %s: %.1f views a week in this window, too few bumps at this hour to compare", day, window, h.weekly)
+	default:
+		return fmt.Sprintf("%s %s: no views in this window on %ss yet, %.1f a day in it on other days", day, window, at.Format("Monday"), h.daily)
+	}
+}
+
+func analyze(views, bumps []time.Time, now time.Time, loc *time.Location) [168]hourStats {
+	var stats [168]hourStats
+
+	// views are sorted, so the ones after a bump are a range. Every
+	// resume of a run is a bump of its own, they count once
+	var last time.Time
+	for _, b := range bumps {
+		if !last.IsZero() && b.Sub(last) < Cooldown {
+			continue
+		}
+		last = b
+
+		h := &stats[hourOfWeek(b, loc)]
+		h.bumps++
+		from := sort.Search(len(views), func(i int) bool { return !views[i].Before(b) })
+		to := sort.Search(len(views), func(i int) bool { return !views[i].Before(b.Add(Cooldown)) })
+		h.afterBumps += to - from
+	}
+
+	weeks := 1.0
+	if len(views) > 0 {
+		if span := now.Sub(views[0]); span > week {
+			weeks = float64(span) / float64(week)
+		}
+	}
+	window := int(Cooldown / time.Hour)
+	var daily [24]float64
+	for _, v := range views {
+		at := hourOfWeek(v, loc)
+		// a view counts for every hour whose window it falls into
+		for i := 0; i < window; i++ {
+			stats[(at-i+168)%168].weekly += 1 / weeks
+			daily[(at-i+168)%24] += 1 / (weeks * 7)
+		}
+	}
+	for i := range stats {
+		stats[i].daily = daily[i%24]
+	}
+
+	return stats
+}
+
+// Plan picks up to count slots in the day after now, at whole hours, no
+// sooner than Cooldown after the last bump and Cooldown apart from each
+// other. Hours without views are never picked, so there may be fewer.
+// views and bumps must be sorted. With fewer than MinViews views
+// it plans nothing and note tells why.
+func Plan(views, bumps []time.Time, now time.Time, loc *time.Location, count int) (slots []storage.BumpSlot, note string) {
+	if len(views) < MinViews {
+		return nil, fmt.Sprintf("%d of %d views collected, bumped at the fixed times until then", len(views), MinViews)
+	}
+
+	stats := analyze(views, bumps, now, loc)
+
+	earliest := now
+	if len(bumps) > 0 {
+		if next := bumps[len(bumps)-1].Add(Cooldown); next.After(earliest) {
+			earliest = next
+		}
+	}
+
+	type candidate struct {
+		at    time.Time
+		stats hourStats
+	}
+	var candidates []candidate
+	// whole hours in loc, Truncate rounds in UTC and would put slots at half
+	// past in zones like Asia/Kolkata. time.Date could pick the other offset
+	// in the hour clocks go back, taking the minutes off keeps the one now has
+	local := now.In(loc)
+	past := time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second + time.Duration(local.Nanosecond())
+	start := local.Add(time.Hour - past)
+	for at := start; at.Before(start.Add(24 * time.Hour)); at = at.Add(time.Hour) {
+		if at.Before(earliest) {
+			continue
+		}
+		// an hour nobody looked at is no reason to bump
+		if stats[hourOfWeek(at, loc)].score() == 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{at: at, stats: stats[hourOfWeek(at, loc)]})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].stats.score() > candidates[j].stats.score() })
+
+	for _, c := range candidates {
+		if len(slots) == count {
+			break
+		}
+
+		fits := true
+		for _, s := range slots {
+			if d := c.at.Sub(s.At); d < Cooldown && d > -Cooldown {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			slots = append(slots, storage.BumpSlot{At: c.at, Reason: c.stats.reason(c.at.In(loc))})
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].At.Before(slots[j].At) })
+
+	return slots, fmt.Sprintf("planned from %d views and %d bumps", len(views), len(bumps))
+}
+
+// Store is the part of the repository Replan needs
+type Store interface {
+	ListResumeViews(ctx context.Context, userID string, since time.Time) ([]storage.ResumeView, error)
+	ListBumpTimes(ctx context.Context, userID string, since time.Time) ([]time.Time, error)
+	ReplaceBumpSlots(ctx context.Context, userID string, slots []storage.BumpSlot) error
+}
+
+// Replan plans SlotsPerDay slots for a user from the stored history
+// and replaces the ones planned before, loc is the zone of the user
+func Replan(ctx context.Context, store Store, userID string, now time.Time, loc *time.Location) ([]storage.BumpSlot, string, error) {
+	stored, err := store.ListResumeViews(ctx, userID, now.Add(-History))
+	if err != nil {
+		return nil, "", err
+	}
+	views := make([]time.Time, 0, len(stored))
+	for _, v := range stored {
+		views = append(views, v.ViewedAt)
+	}
+
+	bumps, err := store.ListBumpTimes(ctx, userID, now.Add(-History))
+	if err != nil {
+		return nil, "", err
+	}
+
+	slots, note := Plan(views, bumps, now, loc, SlotsPerDay)
+	for i := range slots {
+		slots[i].UserID = userID
+	}
+
+	return slots, note, store.ReplaceBumpSlots(ctx, userID, slots)
+}
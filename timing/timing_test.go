@@ -0,0 +1,249 @@
+package timing
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"hhcv/storage"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// every returns n times step apart, the last one at until minus step
+func every(until time.Time, step time.Duration, n int) []time.Time {
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = until.Add(-time.Duration(n-i) * step)
+	}
+	return times
+}
+
+func TestAnalyze(t *testing.T) {
+	// a Tuesday, hours of the week count from Sunday
+	bump := time.Date(2026, 10, 13, 9, 0, 0, 0, time.UTC)
+	tuesday9 := 2*24 + 9
+
+	tests := []struct {
+		name           string
+		views, bumps   []time.Time
+		loc            *time.Location
+		hour           int
+		wantBumps      int
+		wantAfterBumps int
+		wantWeekly     float64
+	}{
+		{
+			name:           "views within the cooldown are credited to the bump",
+			views:          []time.Time{bump.Add(30 * time.Minute), bump.Add(3 * time.Hour), bump.Add(5 * time.Hour)},
+			bumps:          []time.Time{bump},
+			loc:            time.UTC,
+			hour:           tuesday9,
+			wantBumps:      1,
+			wantAfterBumps: 2,
+			// the view at 12:00 falls into the window of 09:00 too
+			wantWeekly: 2,
+		},
+		{
+			name:           "resumes bumped in one run count once",
+			views:          []time.Time{bump.Add(time.Hour)},
+			bumps:          []time.Time{bump, bump.Add(time.Minute), bump.Add(time.Hour)},
+			loc:            time.UTC,
+			hour:           tuesday9,
+			wantBumps:      1,
+			wantAfterBumps: 1,
+			wantWeekly:     1,
+		},
+		{
+			name:           "hours are counted in loc",
+			views:          []time.Time{bump.Add(time.Hour)},
+			bumps:          []time.Time{bump, bump.Add(week)},
+			loc:            mustLoad(t, "Asia/Yekaterinburg"),
+			hour:           2*24 + 14,
+			wantBumps:      2,
+			wantAfterBumps: 1,
+			wantWeekly:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := analyze(tt.views, tt.bumps, bump.Add(week), tt.loc)
+			got := stats[tt.hour]
+			if got.bumps != tt.wantBumps || got.afterBumps != tt.wantAfterBumps || got.weekly != tt.wantWeekly {
+				t.Errorf("got %+v, want %d bumps, %d views after them, %.1f a week", got, tt.wantBumps, tt.wantAfterBumps, tt.wantWeekly)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	kolkata := mustLoad(t, "Asia/Kolkata")
+	berlin := mustLoad(t, "Europe/Berlin")
+	// a Tuesday in UTC
+	now := time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)
+	// 22:30 on the Saturday before Berlin goes back from CEST to CET
+	beforeDST := time.Date(2026, 10, 24, 22, 30, 0, 0, berlin)
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		loc       *time.Location
+		views     []time.Time
+		bumps     []time.Time
+		count     int
+		want      []time.Time
+		wantNote  string
+		wantLocal string
+	}{
+		{
+			name:     "too few views plan nothing",
+			now:      now,
+			loc:      time.UTC,
+			views:    every(now, time.Hour, MinViews-1),
+			count:    3,
+			wantNote: "19 of 20 views collected",
+		},
+		{
+			name:  "enough views",
+			now:   now,
+			loc:   time.UTC,
+			views: every(now, time.Hour, MinViews),
+			count: 1,
+			// views from 14:00 to 09:00, the first hour whose window holds four of them
+			want:     []time.Time{now.Add(4 * time.Hour)},
+			wantNote: "planned from 20 views and 0 bumps",
+		},
+		{
+			name:     "slots keep the cooldown after the last bump and between each other",
+			now:      now,
+			loc:      time.UTC,
+			views:    every(now, time.Hour, 7*24),
+			bumps:    []time.Time{now.Add(-time.Hour)},
+			count:    3,
+			want:     []time.Time{now.Add(3 * time.Hour), now.Add(7 * time.Hour), now.Add(11 * time.Hour)},
+			wantNote: "planned from 168 views and 1 bumps",
+		},
+		{
+			name:  "hours without views are not picked",
+			now:   now,
+			loc:   time.UTC,
+			views: every(now.Add(-20*time.Hour), week/7, MinViews),
+			count: 3,
+			// views at 14:00 make 11:00 to 14:00 worth bumping at
+			want: []time.Time{now.Add(time.Hour)},
+		},
+		{
+			name:      "whole hours in a half hour zone",
+			now:       now.Add(15 * time.Minute),
+			loc:       kolkata,
+			views:     every(now, time.Hour, 7*24),
+			count:     1,
+			want:      []time.Time{time.Date(2026, 10, 20, 16, 0, 0, 0, kolkata)},
+			wantLocal: "16:00",
+		},
+		{
+			// views at 09:10 local in summer time still point at 09:00
+			// local after the clocks went back, not at 09:00 CEST
+			name:      "views before a dst change",
+			now:       beforeDST,
+			loc:       berlin,
+			views:     every(time.Date(2026, 10, 24, 9, 10, 0, 0, berlin), 24*time.Hour, 3*7),
+			count:     3,
+			want:      []time.Time{time.Date(2026, 10, 25, 6, 0, 0, 0, berlin)},
+			wantLocal: "06:00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slots, note := Plan(tt.views, tt.bumps, tt.now, tt.loc, tt.count)
+			if !strings.Contains(note, tt.wantNote) {
+				t.Errorf("note %q does not say %q", note, tt.wantNote)
+			}
+			if len(slots) != len(tt.want) {
+				t.Fatalf("got %d slots %+v, want %v", len(slots), slots, tt.want)
+			}
+			for i, slot := range slots {
+				if !slot.At.Equal(tt.want[i]) {
+					t.Errorf("slot %d: got %s, want %s", i, slot.At.In(tt.loc), tt.want[i].In(tt.loc))
+				}
+				if slot.Reason == "" {
+					t.Errorf("slot %d has no reason", i)
+				}
+			}
+			if tt.wantLocal != "" && !strings.Contains(slots[0].Reason, tt.wantLocal+"-") {
+				t.Errorf("reason %q is not about %s local time", slots[0].Reason, tt.wantLocal)
+			}
+		})
+	}
+}
+
+// fakeStore keeps what Replan asked for and stored
+type fakeStore struct {
+	views  []storage.ResumeView
+	bumps  []time.Time
+	since  time.Time
+	stored []storage.BumpSlot
+}
+
+func (s *fakeStore) ListResumeViews(_ context.Context, _ string, since time.Time) ([]storage.ResumeView, error) {
+	s.since = since
+	return s.views, nil
+}
+
+func (s *fakeStore) ListBumpTimes(_ context.Context, _ string, _ time.Time) ([]time.Time, error) {
+	return s.bumps, nil
+}
+
+func (s *fakeStore) ReplaceBumpSlots(_ context.Context, _ string, slots []storage.BumpSlot) error {
+	s.stored = slots
+	return nil
+}
+
+func TestReplan(t *testing.T) {
+	now := time.Date(2026, 10, 20, 10, 0, 0, 0, time.UTC)
+	var views []storage.ResumeView
+	for _, at := range every(now, time.Hour, 7*24) {
+		views = append(views, storage.ResumeView{ViewedAt: at})
+	}
+
+	tests := []struct {
+		name      string
+		views     []storage.ResumeView
+		wantSlots int
+	}{
+		{"plans a day ahead", views, SlotsPerDay},
+		{"too few views drop earlier slots", views[:MinViews-1], 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{views: tt.views, stored: []storage.BumpSlot{{UserID: "u1", At: now}}}
+			slots, _, err := Replan(context.Background(), store, "u1", now, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(slots) != tt.wantSlots || len(store.stored) != tt.wantSlots {
+				t.Errorf("got %d slots, stored %d, want %d", len(slots), len(store.stored), tt.wantSlots)
+			}
+			for _, slot := range store.stored {
+				if slot.UserID != "u1" {
+					t.Errorf("stored slot without the user: %+v", slot)
+				}
+			}
+			if !store.since.Equal(now.Add(-History)) {
+				t.Errorf("views since %s, want %s", store.since, now.Add(-History))
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"hhcv/hh"
+	"hhcv/storage"
+)
+
+const (
+	revokeAttempts = 3
+	revokeBackoff  = time.Second
+)
+
+// deletionStep is one part of an account deletion and how it went
+type deletionStep struct {
+	Name   string
+	Err    error
+	Detail string
+}
+
+type deletionReport struct {
+	Steps []deletionStep
+	// Deleted is set once stored data is gone
+	Deleted bool
+}
+
+func (r *deletionReport) add(name string, err error, detail string) {
+	r.Steps = append(r.Steps, deletionStep{Name: name, Err: err, Detail: detail})
+}
+
+func (r deletionReport) String() string {
+	var parts []string
+	for _, s := range r.Steps {
+		switch {
+		case s.Err != nil:
+			parts = append(parts, fmt.Sprintf("%s: failed (%v).", s.Name, s.Err))
+		case s.Detail != "":
+			parts = append(parts, fmt.Sprintf("%s: %s.", s.Name, s.Detail))
+		default:
+			parts = append(parts, s.Name+": done.")
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// deleteAccount revokes the hh grant of userID and purges everything stored
+// about them. Stored data is kept while a live grant could not be revoked, it
+// holds the only tokens that can revoke it, unless force is set by an operator
+func deleteAccount(ctx context.Context, userID, actor string, force bool) deletionReport {
+	var report deletionReport
+
+	revoked, revokeDetail, err := revokeGrant(ctx, userID)
+	report.add("Revoke hh access", err, revokeDetail)
+	if err != nil && !force {
+		report.add("Delete stored data", errors.New("skipped, hh access is still granted"), "")
+		return report
+	}
+
+	details := revokeDetail
+	if err != nil {
+		details = "forced, revoke failed: " + err.Error()
+	}
+	t := &storage.Tombstone{UserID: userID, Actor: actor, Revoked: revoked, Details: details}
+	if err := repo.PurgeUser(ctx, t); err != nil {
+		log.Printf("deleteAccount %s: %v", userID, err)
+		report.add("Delete stored data", err, "")
+		return report
+	}
+	report.Deleted = true
+	report.add("Delete stored data", nil, "user, tokens, resumes and scheduler history")
+
+	n, err := destroySessions(ctx, userID)
+	report.add("Sign out everywhere", err, fmt.Sprintf("%d sessions closed", n))
+
+	return report
+}
+
+// revokeGrant tells whether a grant was revoked now. A grant that is
+// already gone or tokens that never were or can not be read are not an
+// error, there is nothing we could ever revoke with them
+func revokeGrant(ctx context.Context, userID string) (bool, string, error) {
+	token, err := repo.GetToken(ctx, userID)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return false, "no tokens stored", nil
+	case errors.Is(err, storage.ErrTokenBroken):
+		log.Printf("revokeGrant %s: %v", userID, err)
+		return false, "stored tokens are unreadable, revoke access in hh settings", nil
+	case err != nil:
+		return false, "", err
+	}
+
+	err = retryRevoke(ctx, token.AccessToken)
+	if errors.Is(err, hh.ErrTokenExpired) {
+		var fresh *storage.Token
+		if fresh, err = hh.RefreshToken(ctx, client, token.RefreshToken); err == nil {
+			// hh has already retired the old refresh token, should the
+			// revoke fail the account is left with the fresh one
+			if err := repo.SaveToken(ctx, userID, "", fresh); err != nil {
+				log.Printf("revokeGrant %s: saving refreshed token: %v", userID, err)
+			}
+			err = retryRevoke(ctx, fresh.AccessToken)
+		}
+	}
+
+	switch {
+	case errors.Is(err, hh.ErrGrantGone):
+		return false, "access was already revoked", nil
+	case err != nil:
+		log.Printf("revokeGrant %s: %v", userID, err)
+		return false, "", err
+	}
+
+	return true, "revoked", nil
+}
+
+// retryRevoke retries network and server errors, answers about
+// the token itself are final
+func retryRevoke(ctx context.Context, accessToken string) error {
+	backoff := revokeBackoff
+	for i := 1; ; i++ {
+		err := HHInvalidateToken(ctx, client, accessToken)
+		if err == nil || errors.Is(err, hh.ErrTokenExpired) || errors.Is(err, hh.ErrGrantGone) || i == revokeAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// destroySessions closes every session userID logged in with, the current
+// one included. Sessions acting as userID on behalf of another login are
+// switched back to that login
+func destroySessions(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := sessionManager.Iterate(ctx, func(ctx context.Context) error {
+		if loginID(ctx) == userID {
+			n++
+			return sessionManager.Destroy(ctx)
+		}
+		if sessionManager.GetString(ctx, "userID") != userID {
+			return nil
+		}
+
+		sessionManager.Put(ctx, "userID", loginID(ctx))
+		_, _, err := sessionManager.Commit(ctx)
+		return err
+	})
+
+	return n, err
+}
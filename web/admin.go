@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"hhcv/storage"
+)
+
+const (
+	adminHistoryLimit = 100
+	adminRunsLimit    = 30
+)
+
+type AdminData struct {
+	Users    []storage.UserSummary
+	Runs     []storage.Run
+	Attempts []storage.Attempt
+	Failures []storage.FailureCount
+	Syncs    []storage.ResumeSync
+	Audit    []storage.AuditEvent
+	// AuditUser narrows the audit log down to one user
+	AuditUser  string
+	Tombstones []storage.Tombstone
+}
+
+// ADMIN_USER_IDS is a comma separated list of hh user ids
+func loadAdminIDs() map[string]bool {
+	ids := make(map[string]bool)
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids[id] = true
+		}
+	}
+
+	return ids
+}
+
+func isAdmin(userID string) bool {
+	return userID != "" && adminIDs[userID]
+}
+
+func adminDashboard(w http.ResponseWriter, r *http.Request) {
+	userID := sessionManager.GetString(r.Context(), "userID")
+	data := PageData{
+		IsLoggedIn:   true,
+		IsAdmin:      true,
+		Notification: sessionManager.PopString(r.Context(), "notification"),
+		Error:        sessionManager.PopString(r.Context(), "error"),
+	}
+
+	var err error
+	if data.User, err = repo.GetUser(r.Context(), userID); err != nil {
+		log.Printf("/admin failed to get user %s: %v", userID, err)
+	}
+	if data.Accounts, err = listAccounts(r.Context()); err != nil {
+		log.Printf("/admin failed to get accounts of %s: %v", loginID(r.Context()), err)
+	}
+
+	var admin AdminData
+	if admin.Users, err = repo.ListUsers(r.Context()); err != nil {
+		log.Printf("/admin failed to get users: %v", err)
+		data.Error += " Could not load users."
+	}
+
+	if admin.Runs, err = repo.ListRuns(r.Context(), adminRunsLimit); err != nil {
+		log.Printf("/admin failed to get scheduler runs: %v", err)
+		data.Error += " Could not load scheduler runs."
+	}
+
+	if admin.Attempts, err = repo.ListAttempts(r.Context(), adminHistoryLimit); err != nil {
+		log.Printf("/admin failed to get scheduler history: %v", err)
+		data.Error += " Could not load scheduler history."
+	}
+
+	if admin.Failures, err = repo.FailureBreakdown(r.Context(), adminHistoryLimit); err != nil {
+		log.Printf("/admin failed to get scheduler failures: %v", err)
+		data.Error += " Could not load scheduler failures."
+	}
+
+	if admin.Syncs, err = repo.ListResumeSyncs(r.Context(), adminRunsLimit); err != nil {
+		log.Printf("/admin failed to get resume syncs: %v", err)
+		data.Error += " Could not load resume syncs."
+	}
+
+	admin.AuditUser = r.URL.Query().Get("audit_user")
+	if admin.Audit, err = repo.ListAudit(r.Context(), admin.AuditUser, adminHistoryLimit); err != nil {
+		log.Printf("/admin failed to get audit log: %v", err)
+		data.Error += " Could not load audit log."
+	}
+
+	if admin.Tombstones, err = repo.ListTombstones(r.Context(), adminRunsLimit); err != nil {
+		log.Printf("/admin failed to get deleted accounts: %v", err)
+		data.Error += " Could not load deleted accounts."
+	}
+	data.Admin = &admin
+
+	if err := render(w, r, "base", data); err != nil {
+		log.Printf("/admin: failed to execute template: %v", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+	}
+}
+
+func adminSetUserDisabled(isDisabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targetID := r.PathValue("id")
+
+		if err := repo.SetUserDisabled(r.Context(), targetID, isDisabled); err != nil {
+			log.Printf("/admin: could not update user %s: %v", targetID, err)
+			sessionManager.Put(r.Context(), "error", "Could not update user "+targetID)
+		} else {
+			log.Printf("/admin: %s set is_disabled=%t for user %s", loginID(r.Context()), isDisabled, targetID)
+			action := storage.AuditUserEnable
+			if isDisabled {
+				action = storage.AuditUserDisable
+			}
+			audit(r, storage.AuditEvent{Action: action, UserID: targetID})
+			sessionManager.Put(r.Context(), "notification", "Updated user "+targetID)
+			if isDisabled {
+				if n, err := destroySessions(r.Context(), targetID); err != nil {
+					log.Printf("/admin: could not close sessions of %s: %v", targetID, err)
+				} else if n > 0 {
+					log.Printf("/admin: closed %d sessions of %s", n, targetID)
+				}
+			}
+		}
+
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	}
+}
+
+func adminResyncUser(w http.ResponseWriter, r *http.Request) {
+	targetID := r.PathValue("id")
+
+	diff, err := syncResumes(r, targetID, storage.SyncManual)
+	if err != nil {
+		log.Printf("/admin: could not re-sync user %s: %v", targetID, err)
+		sessionManager.Put(r.Context(), "error", "Could not re-sync user "+targetID)
+	} else {
+		sessionManager.Put(r.Context(), "notification", "Re-synced user "+targetID+": "+diff.String())
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// adminPurgeUser deletes an account even when its hh grant could not be revoked
+func adminPurgeUser(w http.ResponseWriter, r *http.Request) {
+	targetID := r.PathValue("id")
+	adminID := loginID(r.Context())
+
+	report := deleteAccount(context.WithoutCancel(r.Context()), targetID, adminID, true)
+	audit(r, storage.AuditEvent{Action: storage.AuditUserPurge, UserID: targetID, Details: report.String()})
+
+	if report.Deleted {
+		log.Printf("/admin: %s purged user %s: %s", adminID, targetID, report)
+		sessionManager.Put(r.Context(), "notification", "Purged user "+targetID+". "+report.String())
+	} else {
+		log.Printf("/admin: could not purge user %s: %s", targetID, report)
+		sessionManager.Put(r.Context(), "error", "Could not purge user "+targetID+". "+report.String())
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
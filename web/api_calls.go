@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"strings"
 	"time"
+
+	"hhcv/hh"
+	"hhcv/storage"
 )
 
 // we have time string without offset
@@ -31,79 +37,32 @@ func (hht HHTime) MarshalJSON() ([]byte, error) {
 }
 
 func (t HHTime) Format(layout string) string {
-	return time.Time(t).Format(time.RFC1123)
-}
-
-type HHError struct {
-	Error            string `json:"error"`
-	ErrorDescription string `json:"error_description"`
-}
-
-type Token struct {
-	AccessToken  string `json:"access_token"`
-	TokenType    string `json:"token_type"`
-	RefreshToken string `json:"refresh_token"`
-	ExpiresIn    uint   `json:"expires_in"`
-}
-
-func (t *Token) encrypt() (string, string, error) {
-	var at, rt string
-	var err error
-
-	if at, err = Encrypt(t.AccessToken); err != nil {
-		return "", "", err
-	}
-
-	if rt, err = Encrypt(t.RefreshToken); err != nil {
-		return "", "", err
-	}
-
-	return at, rt, nil
+	return time.Time(t).Format(layout)
 }
 
-func (t *Token) decrypt() error {
-	var at, rt string
-	var err error
-
-	if at, err = Decrypt(t.AccessToken); err != nil {
-		return err
-	}
-
-	if rt, err = Decrypt(t.RefreshToken); err != nil {
-		return err
+// hhClient calls hh with client on behalf of the users in repo, token
+// refreshes are audited with who asked and from where
+func hhClient(r *http.Request) *hh.Client {
+	return &hh.Client{
+		HTTP:  client,
+		Store: repo,
+		Audit: func(_ context.Context, e storage.AuditEvent) { audit(r, e) },
 	}
-
-	t.AccessToken = at
-	t.RefreshToken = rt
-
-	return nil
-
-}
-
-type User struct {
-	ID         string `json:"id"`
-	FirstName  string `json:"first_name"`
-	LastName   string `json:"last_name"`
-	MiddleName string `json:"middle_name"`
 }
 
-type Resume struct {
-	ID           string `json:"id"`
-	Title        string `json:"title"`
-	CreatedAt    HHTime `json:"created_at"`
-	UpdatedAt    HHTime `json:"updated_at"`
-	AlternateURL string `json:"alternate_url"`
-	IsScheduled  int
+type HHError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
 }
 
-func HHGetToken(client *http.Client, code string) (*Token, error) {
-	req, err := http.NewRequest("POST", "https://api.hh.ru/token", nil)
+func HHGetToken(ctx context.Context, client *http.Client, code string) (*storage.Token, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", hh.API+"/token", nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("HH-User-Agent", "n0thingg@yandex.ru update-cv")
+	req.Header.Set("HH-User-Agent", hh.UserAgent)
 
 	q := req.URL.Query()
 	q.Add("client_id", clientID)
@@ -131,7 +90,7 @@ func HHGetToken(client *http.Client, code string) (*Token, error) {
 		return nil, fmt.Errorf("bad status code getToken(): %d %s", resp.StatusCode, bodyBytes)
 	}
 
-	var token Token
+	var token storage.Token
 	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
 		return nil, fmt.Errorf("failed to decode token response: %w", err)
 	}
@@ -140,15 +99,15 @@ func HHGetToken(client *http.Client, code string) (*Token, error) {
 
 }
 
-func HHGetUser(client *http.Client, t string) (*User, error) {
-	req, err := http.NewRequest("GET", "https://api.hh.ru/me", nil)
+func HHGetUser(ctx context.Context, client *http.Client, t string) (*storage.User, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", hh.API+"/me", nil)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+t)
-	req.Header.Set("HH-User-Agent", "n0thingg@yandex.ru update-cv")
+	req.Header.Set("HH-User-Agent", hh.UserAgent)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -161,7 +120,7 @@ func HHGetUser(client *http.Client, t string) (*User, error) {
 		return nil, fmt.Errorf("bad status code getUser(): %d %s", resp.StatusCode, bodyBytes)
 	}
 
-	var user User
+	var user storage.User
 	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
 		return nil, fmt.Errorf("failed to decode user response: %w", err)
 	}
@@ -170,58 +129,96 @@ func HHGetUser(client *http.Client, t string) (*User, error) {
 
 }
 
-func HHGetResumes(client *http.Client, t string) ([]Resume, error) {
-	req, err := http.NewRequest("GET", "https://api.hh.ru/resumes/mine", nil)
+func HHInvalidateToken(ctx context.Context, client *http.Client, t string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", hh.API+"/oauth/token", nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+t)
-	req.Header.Set("HH-User-Agent", "n0thingg@yandex.ru update-cv")
+	req.Header.Set("HH-User-Agent", hh.UserAgent)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode != http.StatusNoContent {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("bad status code getUser(): %d %s", resp.StatusCode, bodyBytes)
+		if err := hh.OAuthError(resp.StatusCode, bodyBytes); err != nil {
+			return err
+		}
+		return fmt.Errorf("bad status code invalidateToken(): %d %s", resp.StatusCode, bodyBytes)
 	}
 
-	type hhResumesResponse struct {
-		Items []Resume `json:"items"`
-	}
-	var hhr hhResumesResponse
-	if err := json.NewDecoder(resp.Body).Decode(&hhr); err != nil {
-		return nil, fmt.Errorf("failed to decode user response: %w", err)
-	}
+	return nil
+}
+
+// hhApplyError is hh refusing an application, Value is the reason
+// like already_applied or limit_exceeded
+type hhApplyError struct {
+	Value       string
+	Description string
+}
 
-	return hhr.Items, nil
+func (e *hhApplyError) Error() string {
+	return fmt.Sprintf("hh refused to apply: %s %s", e.Value, e.Description)
 }
 
-func HHInvalidateToken(client *http.Client, t string) error {
-	req, err := http.NewRequest("DELETE", "https://api.hh.ru/oauth/token", nil)
+// HHApply applies to a vacancy with a resume and returns the id of
+// the negotiation hh started, message may be empty
+func HHApply(ctx context.Context, client *http.Client, t, resumeID, vacancyID, message string) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range map[string]string{"resume_id": resumeID, "vacancy_id": vacancyID, "message": message} {
+		if value == "" {
+			continue
+		}
+		if err := form.WriteField(name, value); err != nil {
+			return "", err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", hh.API+"/negotiations", &body)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", form.FormDataContentType())
 	req.Header.Set("Authorization", "Bearer "+t)
-	req.Header.Set("HH-User-Agent", "n0thingg@yandex.ru update-cv")
+	req.Header.Set("HH-User-Agent", hh.UserAgent)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusNoContent {
+	if resp.StatusCode != http.StatusCreated {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("bad status code invalidateToken(): %d %s", resp.StatusCode, bodyBytes)
+		if err := hh.OAuthError(resp.StatusCode, bodyBytes); err != nil {
+			return "", err
+		}
+
+		var hherr struct {
+			Description string `json:"description"`
+			Errors      []struct {
+				Type  string `json:"type"`
+				Value string `json:"value"`
+			} `json:"errors"`
+		}
+		if json.Unmarshal(bodyBytes, &hherr) == nil && len(hherr.Errors) > 0 {
+			return "", &hhApplyError{Value: hherr.Errors[0].Value, Description: hherr.Description}
+		}
+		return "", fmt.Errorf("bad status code apply(): %d %s", resp.StatusCode, bodyBytes)
 	}
 
-	return nil
+	// hh answers with Location: /negotiations/{id}
+	location := resp.Header.Get("Location")
+	return location[strings.LastIndex(location, "/")+1:], nil
 }
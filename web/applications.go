@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"hhcv/storage"
+)
+
+const (
+	applicationChangesLimit = 50
+	notificationsLimit      = 20
+)
+
+// BoardColumn is one stage of the applications board
+type BoardColumn struct {
+	Stage string
+	Items []storage.Negotiation
+}
+
+type ApplicationsData struct {
+	Columns       []BoardColumn
+	Changes       []storage.NegotiationChange
+	Notifications []storage.Notification
+}
+
+func boardColumns(negotiations []storage.Negotiation) []BoardColumn {
+	columns := make([]BoardColumn, len(storage.Stages))
+	index := make(map[string]int, len(storage.Stages))
+	for i, stage := range storage.Stages {
+		columns[i].Stage = stage
+		index[stage] = i
+	}
+
+	for _, n := range negotiations {
+		if i, ok := index[n.Stage]; ok {
+			columns[i].Items = append(columns[i].Items, n)
+		}
+	}
+
+	return columns
+}
+
+// applications shows where the applications of the active account are,
+// notifications are marked read once shown here
+func applications(w http.ResponseWriter, r *http.Request) {
+	userID := sessionManager.GetString(r.Context(), "userID")
+	data := PageData{
+		IsLoggedIn: true,
+		IsAdmin:    isAdmin(loginID(r.Context())),
+		Error:      sessionManager.PopString(r.Context(), "error"),
+	}
+
+	var err error
+	if data.User, err = repo.GetUser(r.Context(), userID); err != nil {
+		log.Printf("/applications failed to get user %s: %v", userID, err)
+		data.Error += " Could not load your user profile."
+	}
+	if data.Accounts, err = listAccounts(r.Context()); err != nil {
+		log.Printf("/applications failed to get accounts of %s: %v", loginID(r.Context()), err)
+	}
+
+	var apps ApplicationsData
+	negotiations, err := repo.ListNegotiations(r.Context(), userID)
+	if err != nil {
+		log.Printf("/applications failed to get negotiations of %s: %v", userID, err)
+		data.Error += " Could not load your applications."
+	}
+	apps.Columns = boardColumns(negotiations)
+
+	if apps.Changes, err = repo.ListNegotiationChanges(r.Context(), userID, applicationChangesLimit); err != nil {
+		log.Printf("/applications failed to get changes of %s: %v", userID, err)
+		data.Error += " Could not load what changed."
+	}
+
+	if apps.Notifications, err = repo.ListNotifications(r.Context(), userID, notificationsLimit); err != nil {
+		log.Printf("/applications failed to get notifications of %s: %v", userID, err)
+	} else if err := repo.MarkNotificationsRead(r.Context(), userID); err != nil {
+		log.Printf("/applications failed to mark notifications of %s read: %v", userID, err)
+	}
+	data.Applications = &apps
+
+	if err := render(w, r, "base", data); err != nil {
+		log.Printf("/applications: failed to execute template: %v", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+	}
+}
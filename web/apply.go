@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"hhcv/storage"
+)
+
+const (
+	defaultApplyDailyCap = 20
+	// applyWindow is the day the cap is about, counted back from now
+	applyWindow       = 24 * time.Hour
+	applicationsLimit = 50
+)
+
+var applyDailyCap int
+
+// APPLY_DAILY_CAP is how many applications one account may send
+// from here in 24 hours, 0 turns the cap off
+func loadApplyDailyCap() int {
+	v := os.Getenv("APPLY_DAILY_CAP")
+	if v == "" {
+		return defaultApplyDailyCap
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("APPLY_DAILY_CAP %q is not a number, using %d", v, defaultApplyDailyCap)
+		return defaultApplyDailyCap
+	}
+
+	return n
+}
+
+type LettersData struct {
+	Letters      []storage.CoverLetter
+	Applications []storage.Application
+	// Used is how many applications count toward Cap now
+	Used int
+	Cap  int
+}
+
+// fillLetter puts the vacancy, the employer and the applicant into a letter template
+func fillLetter(body, vacancy, employer string, u *storage.User) string {
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	return strings.NewReplacer("{vacancy}", vacancy, "{employer}", employer, "{name}", name).Replace(body)
+}
+
+// applyErrorMessage tells the user why an application did not go through
+func applyErrorMessage(err error) string {
+	var refused *hhApplyError
+	if !errors.As(err, &refused) {
+		return "Could not apply, hh did not answer. Try again."
+	}
+
+	switch refused.Value {
+	case "already_applied":
+		return "You already applied to this vacancy."
+	case "limit_exceeded":
+		return "hh limits how many applications you send a day, try again tomorrow."
+	case "test_required":
+		return "This vacancy asks for a test, apply on hh."
+	case "letter_required":
+		return "This vacancy requires a cover letter."
+	case "resume_not_published":
+		return "The resume is not published on hh."
+	default:
+		return "hh refused the application: " + refused.Value + "."
+	}
+}
+
+// localPath keeps redirects after applying on this site
+func localPath(back string) string {
+	if !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") || strings.HasPrefix(back, "/\\") {
+		return "/"
+	}
+
+	return back
+}
+
+func letters(w http.ResponseWriter, r *http.Request) {
+	userID := sessionManager.GetString(r.Context(), "userID")
+	data := PageData{
+		IsLoggedIn:   true,
+		IsAdmin:      isAdmin(loginID(r.Context())),
+		Notification: sessionManager.PopString(r.Context(), "notification"),
+		Error:        sessionManager.PopString(r.Context(), "error"),
+	}
+
+	var err error
+	if data.User, err = repo.GetUser(r.Context(), userID); err != nil {
+		log.Printf("/letters failed to get user %s: %v", userID, err)
+		data.Error += " Could not load your user profile."
+	}
+	if data.Accounts, err = listAccounts(r.Context()); err != nil {
+		log.Printf("/letters failed to get accounts of %s: %v", loginID(r.Context()), err)
+	}
+
+	ld := LettersData{Cap: applyDailyCap}
+	if ld.Letters, err = repo.ListCoverLetters(r.Context(), userID); err != nil {
+		log.Printf("/letters failed to get letters of %s: %v", userID, err)
+		data.Error += " Could not load your cover letters."
+	}
+	if ld.Applications, err = repo.ListApplications(r.Context(), userID, applicationsLimit); err != nil {
+		log.Printf("/letters failed to get applications of %s: %v", userID, err)
+	}
+	if ld.Used, err = repo.CountApplications(r.Context(), userID, time.Now().Add(-applyWindow)); err != nil {
+		log.Printf("/letters failed to count applications of %s: %v", userID, err)
+	}
+	data.Letters = &ld
+
+	if err := render(w, r, "base", data); err != nil {
+		log.Printf("/letters: failed to execute template: %v", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+	}
+}
+
+func createLetter(w http.ResponseWriter, r *http.Request) {
+	l := storage.CoverLetter{
+		UserID: sessionManager.GetString(r.Context(), "userID"),
+		Name:   strings.TrimSpace(r.FormValue("name")),
+		Body:   strings.TrimSpace(r.FormValue("body")),
+	}
+
+	switch {
+	case l.Name == "" || l.Body == "":
+		sessionManager.Put(r.Context(), "error", "A cover letter needs a name and a text.")
+	default:
+		if err := repo.CreateCoverLetter(r.Context(), &l); err != nil {
+			log.Printf("/letters failed to create letter for %s: %v", l.UserID, err)
+			sessionManager.Put(r.Context(), "error", "Could not save the cover letter. Try again.")
+		} else {
+			sessionManager.Put(r.Context(), "notification", "Cover letter saved.")
+		}
+	}
+
+	http.Redirect(w, r, "/letters", http.StatusSeeOther)
+}
+
+func deleteLetter(w http.ResponseWriter, r *http.Request) {
+	userID := sessionManager.GetString(r.Context(), "userID")
+	err := storage.ErrNotFound
+	if letterID, perr := strconv.ParseInt(r.PathValue("id"), 10, 64); perr == nil {
+		err = repo.DeleteCoverLetter(r.Context(), userID, letterID)
+	}
+
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		sessionManager.Put(r.Context(), "error", "No such cover letter.")
+	case err != nil:
+		log.Printf("/letters failed to delete letter %s of %s: %v", r.PathValue("id"), userID, err)
+		sessionManager.Put(r.Context(), "error", "Could not delete the cover letter. Try again.")
+	default:
+		sessionManager.Put(r.Context(), "notification", "Cover letter deleted.")
+	}
+
+	http.Redirect(w, r, "/letters", http.StatusSeeOther)
+}
+
+// apply sends an application through hh. It is reserved first so that
+// the daily cap holds when several are sent at once, and recorded
+// whatever hh answers
+func apply(w http.ResponseWriter, r *http.Request) {
+	back := localPath(r.FormValue("back"))
+	account, ok := matchesAccount(r)
+	if !ok {
+		http.Error(w, "This account is not linked to you.", http.StatusForbidden)
+		return
+	}
+
+	a := storage.Application{
+		UserID:      account,
+		ResumeID:    r.FormValue("resume"),
+		VacancyID:   r.FormValue("vacancy"),
+		VacancyName: r.FormValue("vacancy_name"),
+		Employer:    r.FormValue("employer"),
+	}
+	if a.VacancyID == "" {
+		sessionManager.Put(r.Context(), "error", "No vacancy to apply to.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	if _, err := repo.GetResume(r.Context(), account, a.ResumeID); err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("/apply failed to get resume %s: %v", a.ResumeID, err)
+		}
+		sessionManager.Put(r.Context(), "error", "Choose one of your resumes to apply with.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	if id := r.FormValue("letter"); id != "" {
+		user, err := repo.GetUser(r.Context(), account)
+		var letter *storage.CoverLetter
+		if err == nil {
+			letterID, _ := strconv.ParseInt(id, 10, 64)
+			letter, err = repo.GetCoverLetter(r.Context(), account, letterID)
+		}
+		if err != nil {
+			log.Printf("/apply failed to get letter %s of %s: %v", id, account, err)
+			sessionManager.Put(r.Context(), "error", "Could not load the cover letter. Try again.")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+		a.Message = fillLetter(letter.Body, a.VacancyName, a.Employer, user)
+	}
+
+	err := repo.ReserveApplication(r.Context(), &a, time.Now().Add(-applyWindow), applyDailyCap)
+	if errors.Is(err, storage.ErrCapReached) {
+		sessionManager.Put(r.Context(), "error", fmt.Sprintf("You sent %d applications in the last 24 hours, that is the limit here.", applyDailyCap))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("/apply failed to reserve application of %s: %v", account, err)
+		sessionManager.Put(r.Context(), "error", "Could not apply. Try again.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+		return
+	}
+
+	err = hhClient(r).WithToken(r.Context(), account, "applying", func(at string) (err error) {
+		a.NegotiationID, err = HHApply(r.Context(), client, at, a.ResumeID, a.VacancyID, a.Message)
+		return err
+	})
+	if err != nil {
+		log.Printf("/apply %s to %s: %v", account, a.VacancyID, err)
+		a.Status, a.Error = storage.ApplicationFailed, err.Error()
+		sessionManager.Put(r.Context(), "error", applyErrorMessage(err))
+	} else {
+		a.Status = storage.ApplicationSent
+		sessionManager.Put(r.Context(), "notification", "Applied to "+a.VacancyName+".")
+	}
+
+	// the answer is recorded even when the visitor is gone, a pending one would hold the cap
+	if err := repo.FinishApplication(context.WithoutCancel(r.Context()), &a); err != nil {
+		log.Printf("/apply failed to record application %d: %v", a.ID, err)
+	}
+	audit(r, storage.AuditEvent{
+		Action:  storage.AuditVacancyApply,
+		UserID:  account,
+		Target:  a.VacancyID,
+		Details: strings.TrimSpace(fmt.Sprintf("resume %s, %s %s", a.ResumeID, a.Status, a.Error)),
+	})
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
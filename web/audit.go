@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"hhcv/storage"
+)
+
+const activityLimit = 100
+
+// audit records e with who, from where and with what, the actor
+// is whoever logged in unless e already has one
+func audit(r *http.Request, e storage.AuditEvent) {
+	if e.Actor == "" {
+		e.Actor = loginID(r.Context())
+	}
+	e.IP = clientIP(r)
+	e.UserAgent = r.UserAgent()
+
+	// a canceled request must not drop the record of what it did
+	if err := repo.AddAudit(context.WithoutCancel(r.Context()), &e); err != nil {
+		log.Printf("audit %s of %s: %v", e.Action, e.UserID, err)
+	}
+}
+
+// auditPurged records what happened to a user who deleted themselves,
+// without where they came from, the purge has just cleared that
+func auditPurged(r *http.Request, e storage.AuditEvent) {
+	if e.Actor == "" {
+		e.Actor = loginID(r.Context())
+	}
+
+	if err := repo.AddAudit(context.WithoutCancel(r.Context()), &e); err != nil {
+		log.Printf("audit %s of %s: %v", e.Action, e.UserID, err)
+	}
+}
+
+// clientIP trusts forwarding headers only from a proxy on the same host
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return host
+	}
+
+	if real := r.Header.Get("X-Real-IP"); real != "" {
+		return real
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(first)
+	}
+
+	return host
+}
+
+// activity shows users what happened to their account
+func activity(w http.ResponseWriter, r *http.Request) {
+	userID := sessionManager.GetString(r.Context(), "userID")
+	data := PageData{
+		IsLoggedIn: true,
+		IsAdmin:    isAdmin(loginID(r.Context())),
+		Error:      sessionManager.PopString(r.Context(), "error"),
+	}
+
+	var err error
+	if data.User, err = repo.GetUser(r.Context(), userID); err != nil {
+		log.Printf("/activity failed to get user %s: %v", userID, err)
+		data.Error += " Could not load your user profile."
+	}
+	if data.Accounts, err = listAccounts(r.Context()); err != nil {
+		log.Printf("/activity failed to get accounts of %s: %v", loginID(r.Context()), err)
+	}
+
+	events, err := repo.ListAudit(r.Context(), userID, activityLimit)
+	if err != nil {
+		log.Printf("/activity failed to get events of %s: %v", userID, err)
+		data.Error += " Could not load your activity."
+	}
+	data.Activity = &events
+
+	if err := render(w, r, "base", data); err != nil {
+		log.Printf("/activity: failed to execute template: %v", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+	}
+}
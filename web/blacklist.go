@@ -0,0 +1,174 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"hhcv/hh"
+	"hhcv/storage"
+)
+
+type BlacklistData struct {
+	Resume    storage.Resume
+	Employers []storage.BlacklistedEmployer
+	// Query and Found are a search for employers to add
+	Query string
+	Found []storage.BlacklistedEmployer
+	// Warning is set when the visibility of the resume ignores the blacklist
+	Warning string
+}
+
+func blacklistURL(resumeID, account string) string {
+	return fmt.Sprintf("/resumes/%s/blacklist?%s", url.PathEscape(resumeID), url.Values{"account": {account}}.Encode())
+}
+
+// resumeBlacklist shows employers a resume is hidden from, the mirror
+// is refreshed from hh first and kept as it was when hh fails
+func resumeBlacklist(w http.ResponseWriter, r *http.Request) {
+	resumeID := r.PathValue("id")
+	account, ok := matchesAccount(r)
+	if !ok {
+		http.Error(w, "This account is not linked to you.", http.StatusForbidden)
+		return
+	}
+
+	resume, err := repo.GetResume(r.Context(), account, resumeID)
+	if errors.Is(err, storage.ErrNotFound) {
+		sessionManager.Put(r.Context(), "error", "No such resume.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("/blacklist failed to get resume %s: %v", resumeID, err)
+		sessionManager.Put(r.Context(), "error", "Could not load the resume. Try again.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := PageData{
+		IsLoggedIn:   true,
+		IsAdmin:      isAdmin(loginID(r.Context())),
+		Notification: sessionManager.PopString(r.Context(), "notification"),
+		Error:        sessionManager.PopString(r.Context(), "error"),
+	}
+	userID := sessionManager.GetString(r.Context(), "userID")
+	if data.User, err = repo.GetUser(r.Context(), userID); err != nil {
+		log.Printf("/blacklist failed to get user %s: %v", userID, err)
+	}
+	if data.Accounts, err = listAccounts(r.Context()); err != nil {
+		log.Printf("/blacklist failed to get accounts of %s: %v", loginID(r.Context()), err)
+	}
+
+	if err := hhClient(r).RefreshBlacklists(r.Context(), account, []storage.Resume{*resume}); err != nil {
+		log.Printf("/blacklist failed to refresh the blacklist of %s: %v", resumeID, err)
+		data.Error += " Could not load the blacklist from hh, showing the last one known."
+	}
+
+	bd := BlacklistData{Resume: *resume, Query: strings.TrimSpace(r.URL.Query().Get("q"))}
+	if bd.Employers, err = repo.ListBlacklist(r.Context(), account, resumeID); err != nil {
+		log.Printf("/blacklist failed to list the blacklist of %s: %v", resumeID, err)
+		data.Error += " Could not load the blacklist."
+	}
+	bd.Warning = resume.BlacklistWarning(len(bd.Employers))
+
+	if bd.Query != "" {
+		listed := make(map[string]bool, len(bd.Employers))
+		for _, e := range bd.Employers {
+			listed[e.EmployerID] = true
+		}
+
+		var found []hh.Employer
+		err := hhClient(r).WithToken(r.Context(), account, "searching employers", func(at string) (err error) {
+			found, err = hh.SearchBlacklist(r.Context(), client, at, resumeID, bd.Query)
+			return err
+		})
+		if err != nil {
+			log.Printf("/blacklist failed to search employers for %s: %v", resumeID, err)
+			data.Error += " Could not search employers on hh. Try again."
+		}
+		for _, e := range found {
+			if !listed[e.ID] {
+				bd.Found = append(bd.Found, e.Blacklisted(account, resumeID))
+			}
+		}
+	}
+	data.Blacklist = &bd
+
+	if err := render(w, r, "base", data); err != nil {
+		log.Printf("/blacklist: failed to execute template: %v", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+	}
+}
+
+// setBlacklisted adds an employer to the blacklist of a resume on hh
+// or removes it, the mirror only changes when hh agreed
+func setBlacklisted(add bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resumeID := r.PathValue("id")
+		account, ok := matchesAccount(r)
+		if !ok {
+			http.Error(w, "This account is not linked to you.", http.StatusForbidden)
+			return
+		}
+		back := blacklistURL(resumeID, account)
+
+		e := storage.BlacklistedEmployer{
+			UserID:     account,
+			ResumeID:   resumeID,
+			EmployerID: strings.TrimSpace(r.FormValue("employer")),
+			Name:       strings.TrimSpace(r.FormValue("name")),
+			URL:        strings.TrimSpace(r.FormValue("url")),
+		}
+		if !add {
+			e.EmployerID = r.PathValue("employer")
+		}
+		if e.EmployerID == "" {
+			sessionManager.Put(r.Context(), "error", "Pick an employer.")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+
+		if _, err := repo.GetResume(r.Context(), account, resumeID); err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				log.Printf("/blacklist failed to get resume %s: %v", resumeID, err)
+			}
+			sessionManager.Put(r.Context(), "error", "No such resume.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		action, doing := storage.AuditBlacklistAdd, "adding to the blacklist"
+		if !add {
+			action, doing = storage.AuditBlacklistRemove, "removing from the blacklist"
+		}
+		err := hhClient(r).WithToken(r.Context(), account, doing, func(at string) error {
+			return hh.ChangeBlacklist(r.Context(), client, at, resumeID, e.EmployerID, add)
+		})
+		if err != nil {
+			log.Printf("/blacklist %s of %s: %v", doing, resumeID, err)
+			sessionManager.Put(r.Context(), "error", "hh did not accept the change. Try again.")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+		audit(r, storage.AuditEvent{Action: action, UserID: account, Target: resumeID, Details: "employer " + e.EmployerID})
+
+		if add {
+			err = repo.AddBlacklisted(r.Context(), &e)
+			sessionManager.Put(r.Context(), "notification", "Hidden from "+cmp.Or(e.Name, e.EmployerID)+".")
+		} else {
+			err = repo.RemoveBlacklisted(r.Context(), account, resumeID, e.EmployerID)
+			sessionManager.Put(r.Context(), "notification", "Removed from the blacklist.")
+		}
+		// the next visit refreshes the mirror from hh anyway
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("/blacklist failed to update the mirror of %s: %v", resumeID, err)
+		}
+
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	}
+}
@@ -1,20 +1,38 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
+
+	"hhcv/hh"
+	"hhcv/storage"
 )
 
 type PageData struct {
-	User    *User
-	Resumes *[]Resume
+	User *storage.User
+	// Accounts are the login and the accounts linked to it
+	Accounts     []Account
+	Admin        *AdminData
+	Activity     *[]storage.AuditEvent
+	Applications *ApplicationsData
+	Matches      *MatchesData
+	Searches     *SearchesData
+	Letters      *LettersData
+	History      *HistoryData
+	Blacklist    *BlacklistData
+	// Unread counts notifications of the active account
+	Unread int
 
 	Notification string
 	Error        string
 
 	IsLoggedIn bool
+	IsAdmin    bool
 }
 
 func home(w http.ResponseWriter, r *http.Request) {
@@ -34,37 +52,77 @@ func home(w http.ResponseWriter, r *http.Request) {
 
 	u := sessionManager.GetString(r.Context(), "userID")
 	if u != "" {
-		user, err := getUserByID(db, u)
+		login := loginID(r.Context())
+		user, err := repo.GetUser(r.Context(), u)
 		if err != nil {
 			log.Printf("/home failed to get user %s: %v", u, err)
 			data.Error = "Could not load your user profile. Please try logging in again."
+		} else if user.IsDisabled && u != login {
+			sessionManager.Put(r.Context(), "userID", login)
+			sessionManager.Put(r.Context(), "error", "This account is disabled, switched back to yours.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		} else if user.IsDisabled {
+			sessionManager.Remove(r.Context(), "userID")
+			sessionManager.Remove(r.Context(), "loginID")
+			data.Error = "Your account is disabled."
 		} else {
 			data.IsLoggedIn = true
+			data.IsAdmin = isAdmin(login)
 			data.User = user
 		}
 
 		if data.User != nil {
-			resumes, err := getResumesByUserID(db, u)
+			accounts, err := listAccounts(r.Context())
 			if err != nil {
-				log.Printf("/home failed to get resumes for user %s: %v", u, err)
-				if data.Error == "" {
-					data.Error = "Could not load your resumes. Please try refreshing."
-				} else {
-					data.Error += " Also, could not load your resumes."
+				log.Printf("/home failed to get accounts of %s: %v", login, err)
+				accounts = []Account{{User: *user, Active: true, Owner: u == login}}
+			}
+
+			for i := range accounts {
+				if accounts[i].User.IsDisabled {
+					continue
+				}
+
+				if accounts[i].NewMatches, err = repo.CountNewMatches(r.Context(), accounts[i].User.ID); err != nil {
+					log.Printf("/home failed to count matches for user %s: %v", accounts[i].User.ID, err)
+				}
+				if accounts[i].Blacklisted, err = repo.CountBlacklisted(r.Context(), accounts[i].User.ID); err != nil {
+					log.Printf("/home failed to count blacklisted employers for user %s: %v", accounts[i].User.ID, err)
+				}
+				if accounts[i].Quality, err = resumeQuality(r.Context(), accounts[i].User.ID); err != nil {
+					log.Printf("/home failed to check resumes of user %s: %v", accounts[i].User.ID, err)
+				}
+				if accounts[i].User.ScheduleMode == storage.ScheduleAuto {
+					if accounts[i].Slots, err = repo.ListBumpSlots(r.Context(), accounts[i].User.ID); err != nil {
+						log.Printf("/home failed to list slots of user %s: %v", accounts[i].User.ID, err)
+					}
+				}
+
+				accounts[i].Resumes, err = repo.ListResumes(r.Context(), accounts[i].User.ID)
+				if err != nil {
+					log.Printf("/home failed to get resumes for user %s: %v", accounts[i].User.ID, err)
+					if data.Error == "" {
+						data.Error = "Could not load your resumes. Please try refreshing."
+					} else {
+						data.Error += " Also, could not load your resumes."
+					}
+					break
 				}
-			} else {
-				data.Resumes = &resumes
 			}
-		} else {
-			data.Resumes = nil
+			data.Accounts = accounts
+
+			if data.Unread, err = repo.CountUnreadNotifications(r.Context(), u); err != nil {
+				log.Printf("/home failed to count notifications of %s: %v", u, err)
+			}
 		}
 	} else {
 		data.IsLoggedIn = false
 		data.User = nil
-		data.Resumes = nil
+		data.Accounts = nil
 	}
 
-	if err := templates.ExecuteTemplate(w, "base", data); err != nil {
+	if err := render(w, r, "base", data); err != nil {
 		log.Printf("/home: failed to execute template: %v", err)
 		http.Error(w, "Internal server error.", http.StatusInternalServerError)
 	}
@@ -73,7 +131,7 @@ func home(w http.ResponseWriter, r *http.Request) {
 func login(w http.ResponseWriter, r *http.Request) {
 	state, err := GenerateState(64)
 	if err != nil {
-		templates.ExecuteTemplate(w, "base", PageData{Error: "Error loggin in."})
+		render(w, r, "base", PageData{Error: "Error loggin in."})
 		http.Error(w, "could not generate state string", http.StatusInternalServerError)
 		return
 	}
@@ -92,6 +150,10 @@ func login(w http.ResponseWriter, r *http.Request) {
 		"https://hh.ru/oauth/authorize?response_type=%s&client_id=%s&state=%s&redirect_uri=%s",
 		"code", clientID, state, redirectURL,
 	)
+	// hh would sign the browser straight back into the account it already knows
+	if sessionManager.GetBool(r.Context(), "linking") {
+		url += "&force_login=true"
+	}
 
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
@@ -100,7 +162,7 @@ func callback(w http.ResponseWriter, r *http.Request) {
 	code := r.URL.Query().Get("code")
 	if code == "" {
 		log.Printf("/auth/callback: %v", fmt.Errorf("Could not get code from url"))
-		templates.ExecuteTemplate(w, "base", PageData{Error: "Error loggin in."})
+		render(w, r, "base", PageData{Error: "Error loggin in."})
 		return
 	}
 
@@ -108,13 +170,13 @@ func callback(w http.ResponseWriter, r *http.Request) {
 	cookieState, err := r.Cookie("auth_state")
 	if err != nil {
 		log.Printf("/auth/callback: %v", err)
-		templates.ExecuteTemplate(w, "base", PageData{Error: "Error loggin in."})
+		render(w, r, "base", PageData{Error: "Error loggin in."})
 		return
 	}
 
 	if cookieState.Value != queryState {
 		log.Printf("/auth/callback: %v", fmt.Errorf("States do not match"))
-		templates.ExecuteTemplate(w, "base", PageData{Error: "Error loggin in."})
+		render(w, r, "base", PageData{Error: "Error loggin in."})
 		return
 	}
 
@@ -125,45 +187,76 @@ func callback(w http.ResponseWriter, r *http.Request) {
 		Path:   "/",
 	})
 
-	token, err := HHGetToken(client, code)
+	token, err := HHGetToken(r.Context(), client, code)
 	if err != nil {
 		log.Printf("/auth/callback: %v", err)
-		templates.ExecuteTemplate(w, "base", PageData{Error: "Error loggin in."})
+		render(w, r, "base", PageData{Error: "Error loggin in."})
 		return
 	}
 
-	user, err := HHGetUser(client, token.AccessToken)
+	user, err := HHGetUser(r.Context(), client, token.AccessToken)
 	if err != nil {
 		log.Printf("/auth/callback: %v", err)
-		templates.ExecuteTemplate(w, "base", PageData{Error: "Error loggin in."})
+		render(w, r, "base", PageData{Error: "Error loggin in."})
+		return
+	}
+
+	existing, err := repo.GetUser(r.Context(), user.ID)
+	if err == nil && existing.IsDisabled {
+		log.Printf("/auth/callback: disabled user %s tried to log in", user.ID)
+		audit(r, storage.AuditEvent{Actor: user.ID, Action: storage.AuditLoginRefused, UserID: user.ID, Details: "account is disabled"})
+		render(w, r, "base", PageData{Error: "Your account is disabled."})
 		return
 	}
 
-	if err = createOrUpdateUser(db, user); err != nil {
+	if err = repo.UpsertUser(r.Context(), user); err != nil {
 		log.Printf("/auth/callback: %v", err)
-		templates.ExecuteTemplate(w, "base", PageData{Error: "Error loggin in."})
+		render(w, r, "base", PageData{Error: "Error loggin in."})
 		return
 	}
 
-	if err = createOrUpdateTokens(db, *token, code, user.ID); err != nil {
+	if err = repo.SaveToken(r.Context(), user.ID, code, token); err != nil {
 		log.Printf("/auth/callback: %v", err)
-		templates.ExecuteTemplate(w, "base", PageData{Error: "Error loggin in."})
+		render(w, r, "base", PageData{Error: "Error loggin in."})
 		return
 	}
 
-	resumes, err := HHGetResumes(client, token.AccessToken)
+	resumes, err := hh.GetResumes(r.Context(), client, token.AccessToken)
 	if err != nil {
 		log.Printf("/auth/callback: %v", err)
-		templates.ExecuteTemplate(w, "base", PageData{Error: "Error loggin in."})
+		render(w, r, "base", PageData{Error: "Error loggin in."})
 		return
 	}
 
-	if err = createOrUpdateResumes(db, resumes, user.ID); err != nil {
+	if err = repo.UpsertResumes(r.Context(), user.ID, hh.StorageResumes(resumes)); err != nil {
 		log.Printf("/auth/callback: %v", err)
-		templates.ExecuteTemplate(w, "base", PageData{Error: "Error loggin in."})
+		render(w, r, "base", PageData{Error: "Error loggin in."})
 		return
 	}
+	if login := loginID(r.Context()); sessionManager.PopBool(r.Context(), "linking") && login != "" && login != user.ID {
+		if err = repo.LinkAccount(r.Context(), login, user.ID); err != nil {
+			log.Printf("/auth/callback: %v", err)
+			sessionManager.Put(r.Context(), "error", "Could not link the account. Try again.")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+		sessionManager.Put(r.Context(), "userID", user.ID)
+		sessionManager.Put(r.Context(), "notification", "Linked "+user.LastName+" "+user.FirstName+".")
+		audit(r, storage.AuditEvent{Actor: login, Action: storage.AuditAccountLink, UserID: user.ID, Target: login})
+
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	sessionManager.Put(r.Context(), "loginID", user.ID)
 	sessionManager.Put(r.Context(), "userID", user.ID)
+	// new users have no zone yet, the first page asks the browser for it
+	if existing != nil {
+		sessionManager.Put(r.Context(), "timeZone", existing.TimeZone)
+	} else {
+		sessionManager.Remove(r.Context(), "timeZone")
+	}
+	audit(r, storage.AuditEvent{Actor: user.ID, Action: storage.AuditLogin, UserID: user.ID})
 
 	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 }
@@ -182,26 +275,38 @@ func toggleResume(w http.ResponseWriter, r *http.Request) {
 
 	desiredIsScheduled := r.Form.Has("is_scheduled")
 
-	if err = updateResumeScheduling(db, resumeID, userID, desiredIsScheduled); err != nil {
+	// resumes of every linked account are on the page, not only the active one
+	if account := r.Form.Get("account"); account != "" && account != userID {
+		if !canActAs(r.Context(), account) {
+			http.Error(w, "This account is not linked to you.", http.StatusForbidden)
+			return
+		}
+		userID = account
+	}
+
+	if err = repo.SetResumeScheduled(r.Context(), userID, resumeID, desiredIsScheduled); err != nil {
 		log.Printf("/toggle-resume: %v", err)
 		errMsg += " Could not update. Try again."
+	} else {
+		action := storage.AuditUnschedule
+		if desiredIsScheduled {
+			action = storage.AuditSchedule
+		}
+		audit(r, storage.AuditEvent{Action: action, UserID: userID, Target: resumeID})
 	}
 
-	var resume *Resume
-	if resume, err = getResumeByID(db, resumeID, userID); err != nil {
+	var resume *storage.Resume
+	if resume, err = repo.GetResume(r.Context(), userID, resumeID); err != nil {
 		log.Printf("/toggle-resume: %v", err)
 		errMsg += " Could not update. Try again."
+		resume = &storage.Resume{ID: resumeID, UserID: userID}
 	}
 
 	sessionManager.Put(r.Context(), "error", errMsg)
-	templates.ExecuteTemplate(w, "toggle-switch", resume)
+	render(w, r, "toggle-switch", resume)
 }
 
 func updateResumesOnDemand(w http.ResponseWriter, r *http.Request) {
-	var hhr, dbr []Resume
-	var err error
-	var errMsg string
-
 	userID := sessionManager.GetString(r.Context(), "userID")
 	if userID == "" {
 		sessionManager.Put(r.Context(), "error", "Not logged in.")
@@ -209,37 +314,86 @@ func updateResumesOnDemand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := getTokenByUserID(db, userID)
+	diff, err := syncResumes(r, userID, storage.SyncUser)
 	if err != nil {
-		log.Println("getTokenByUserID ", err)
-		errMsg += " Could not identify. Try again."
+		log.Printf("sync %s: %v", userID, err)
+		sessionManager.Put(r.Context(), "error", "Could not get resumes from hh. Try again.")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
 	}
 
-	if hhr, err = HHGetResumes(client, token.AccessToken); err != nil {
-		log.Println("HHGetResumes ", err)
-		errMsg += " Could not get resumes from hh api. Try again."
+	sessionManager.Put(r.Context(), "notification", describeResumeDiff(diff))
+	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+}
+
+// syncResumes syncs the resumes of a user the way the scheduler does and
+// records the sync whether it changed something or failed
+func syncResumes(r *http.Request, userID, source string) (storage.ResumeDiff, error) {
+	rs := storage.ResumeSync{UserID: userID, Timestamp: time.Now(), Source: source}
+	diff, err := hhClient(r).SyncUser(r.Context(), userID)
+	rs.Changes = diff
+	details := diff.String()
+	if err != nil {
+		rs.Error, details = err.Error(), err.Error()
 	}
 
-	if dbr, err = getResumesByUserID(db, userID); err != nil {
-		log.Println("getResumesByUserID", err)
-		errMsg += " Could not get user. Try again."
+	if err := hh.RecordSync(context.WithoutCancel(r.Context()), repo, &rs); err != nil {
+		log.Printf("sync %s: %v", userID, err)
 	}
+	audit(r, storage.AuditEvent{Action: storage.AuditResumesSync, UserID: userID, Details: details})
 
-	if err = reconcileResumes(db, hhr, dbr, userID); err != nil {
-		log.Println("reconcileResumes ", err)
-		errMsg += " Error deleting data. Try again."
+	return diff, err
+}
+
+func describeResumeDiff(d storage.ResumeDiff) string {
+	if d.IsEmpty() {
+		return "Resumes are up to date."
 	}
 
-	sessionManager.Put(r.Context(), "error", errMsg)
-	if errMsg == "" {
-		sessionManager.Put(r.Context(), "notification", "Updated")
+	var parts []string
+	for _, c := range []struct {
+		verb   string
+		titles []string
+	}{
+		{"Added", d.Added},
+		{"Updated", d.Updated},
+		{"Removed", d.Removed},
+		{"Blocked by hh moderation", d.Blocked},
+	} {
+		if len(c.titles) > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %s.", c.verb, strings.Join(c.titles, ", ")))
+		}
 	}
 
-	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+	return strings.Join(parts, " ")
+}
+
+// downloadUserData hands users everything stored about them
+func downloadUserData(w http.ResponseWriter, r *http.Request) {
+	userID := sessionManager.GetString(r.Context(), "userID")
+
+	data, err := repo.ExportUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("/my-data: %v", err)
+		sessionManager.Put(r.Context(), "error", "Could not collect your data. Try again.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	audit(r, storage.AuditEvent{Action: storage.AuditDataExport, UserID: userID})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="hhcv-%s.json"`, userID))
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		log.Printf("/my-data: %v", err)
+	}
 }
 
 func openModal(w http.ResponseWriter, r *http.Request) {
-	templates.ExecuteTemplate(w, "modal", nil)
+	render(w, r, "modal", nil)
 }
 
 func closeModal(w http.ResponseWriter, r *http.Request) {
@@ -255,36 +409,35 @@ func invalidateUserData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var err error
-	var t *Token
-	var errMsg string
-	if t, err = getTokenByUserID(db, userID); err != nil {
-		log.Println("invalidateUserData: ", err)
-		errMsg += " Could not get credentials. Try again."
-	}
-
-	if err = HHInvalidateToken(client, t.AccessToken); err != nil {
-		log.Println("invalidateUserData: ", err)
-		errMsg += " Could not invalidate data from headhunter api. Contact to invalidate manually or try again."
+	// the revoke retries should not be cut short by the user leaving the page
+	report := deleteAccount(context.WithoutCancel(r.Context()), userID, loginID(r.Context()), false)
+	e := storage.AuditEvent{Action: storage.AuditUserDelete, UserID: userID, Details: report.String()}
+	if report.Deleted && userID == loginID(r.Context()) {
+		auditPurged(r, e)
+	} else {
+		audit(r, e)
 	}
 
-	if err = deleteUserByID(db, userID); err != nil {
-		log.Println("invalidateUserData: ", err)
-		errMsg += " Could not delete user data. Try again."
+	if login := loginID(r.Context()); report.Deleted && userID != login {
+		sessionManager.Put(r.Context(), "userID", login)
+		sessionManager.Put(r.Context(), "notification", "The account was deleted. "+report.String())
+	} else if report.Deleted {
+		sessionManager.Remove(r.Context(), "userID")
+		sessionManager.Remove(r.Context(), "loginID")
+		sessionManager.Put(r.Context(), "notification", "Your data was deleted. "+report.String())
+	} else {
+		sessionManager.Put(r.Context(), "error", "Your data was not deleted, try again later. "+report.String())
 	}
 
-	sessionManager.Remove(r.Context(), "userID")
-	sessionManager.Put(r.Context(), "error", errMsg)
-
-	if errMsg == "" {
-		sessionManager.Put(r.Context(), "notification", "Your data was deleted")
-	}
 	w.Header().Set("HX-Redirect", "/")
 	w.WriteHeader(http.StatusNoContent)
-
 }
 
 func logout(w http.ResponseWriter, r *http.Request) {
+	if userID := sessionManager.GetString(r.Context(), "userID"); userID != "" {
+		audit(r, storage.AuditEvent{Action: storage.AuditLogout, UserID: userID})
+	}
+
 	sessionManager.Destroy(r.Context())
 	sessionManager.RenewToken(r.Context())
 	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
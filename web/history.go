@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"hhcv/storage"
+)
+
+const (
+	snapshotsLimit      = 30
+	historyChangesLimit = 500
+)
+
+// ResumeVersion is one snapshot with what changed since the one before,
+// Views and Invitations are there to see what the change did
+type ResumeVersion struct {
+	Snapshot storage.ResumeSnapshot
+	Changes  []storage.SnapshotChange
+	// First is the oldest snapshot kept, there is nothing to compare it to
+	First bool
+	Views int
+	// Invitations came while this version was the current one
+	Invitations int
+	Until       time.Time
+}
+
+type HistoryData struct {
+	Resume   storage.Resume
+	Versions []ResumeVersion
+}
+
+// invitationTimes returns when applications with a resume were invited
+func invitationTimes(ctx context.Context, userID, resumeID string) ([]time.Time, error) {
+	negotiations, err := repo.ListNegotiations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	withResume := make(map[string]bool)
+	for _, n := range negotiations {
+		if n.ResumeID == resumeID {
+			withResume[n.ID] = true
+		}
+	}
+
+	changes, err := repo.ListNegotiationChanges(ctx, userID, historyChangesLimit)
+	if err != nil {
+		return nil, err
+	}
+	var times []time.Time
+	for _, c := range changes {
+		if c.To == storage.StageInvited && withResume[c.NegotiationID] {
+			times = append(times, c.Timestamp)
+		}
+	}
+
+	return times, nil
+}
+
+// resumeHistory shows the snapshots of a resume newest first, each
+// with what changed and how views and invitations went meanwhile
+func resumeHistory(w http.ResponseWriter, r *http.Request) {
+	resumeID := r.PathValue("id")
+	account, ok := matchesAccount(r)
+	if !ok {
+		http.Error(w, "This account is not linked to you.", http.StatusForbidden)
+		return
+	}
+
+	resume, err := repo.GetResume(r.Context(), account, resumeID)
+	if errors.Is(err, storage.ErrNotFound) {
+		sessionManager.Put(r.Context(), "error", "No such resume.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("/history failed to get resume %s: %v", resumeID, err)
+		sessionManager.Put(r.Context(), "error", "Could not load the resume. Try again.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := PageData{
+		IsLoggedIn: true,
+		IsAdmin:    isAdmin(loginID(r.Context())),
+		Error:      sessionManager.PopString(r.Context(), "error"),
+	}
+	userID := sessionManager.GetString(r.Context(), "userID")
+	if data.User, err = repo.GetUser(r.Context(), userID); err != nil {
+		log.Printf("/history failed to get user %s: %v", userID, err)
+	}
+	if data.Accounts, err = listAccounts(r.Context()); err != nil {
+		log.Printf("/history failed to get accounts of %s: %v", loginID(r.Context()), err)
+	}
+
+	snaps, err := repo.ListResumeSnapshots(r.Context(), account, resumeID, snapshotsLimit)
+	if err != nil {
+		log.Printf("/history failed to get snapshots of %s: %v", resumeID, err)
+		data.Error += " Could not load the resume history."
+	}
+	invited, err := invitationTimes(r.Context(), account, resumeID)
+	if err != nil {
+		log.Printf("/history failed to get invitations of %s: %v", resumeID, err)
+	}
+
+	hd := HistoryData{Resume: *resume}
+	until := time.Now()
+	for i, snap := range snaps {
+		v := ResumeVersion{Snapshot: snap, Views: storage.SnapshotViews(snap), Until: until, First: i == len(snaps)-1}
+		for _, t := range invited {
+			if !t.Before(snap.TakenAt) && t.Before(until) {
+				v.Invitations++
+			}
+		}
+		if !v.First {
+			if v.Changes, err = storage.DiffResumeSnapshots(snaps[i+1], snap); err != nil {
+				log.Printf("/history failed to compare snapshots of %s: %v", resumeID, err)
+			}
+		}
+		hd.Versions = append(hd.Versions, v)
+		until = snap.TakenAt
+	}
+	data.History = &hd
+
+	if err := render(w, r, "base", data); err != nil {
+		log.Printf("/history: failed to execute template: %v", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+	}
+}
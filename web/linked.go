@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"hhcv/quality"
+	"hhcv/storage"
+)
+
+// Account is one hh account a login can act as,
+// Resumes, NewMatches, Blacklisted and Quality are only loaded on the home page
+type Account struct {
+	User        storage.User
+	Resumes     []storage.Resume
+	NewMatches  map[string]int
+	Blacklisted map[string]int
+	Quality     map[string]*quality.Report
+	// Slots are the next bumps planned for an account in auto mode
+	Slots  []storage.BumpSlot
+	Active bool
+	Owner  bool
+}
+
+// loginID is who logged in, userID in the session is the account acted as.
+// Sessions from before accounts could be linked only have userID
+func loginID(ctx context.Context) string {
+	if id := sessionManager.GetString(ctx, "loginID"); id != "" {
+		return id
+	}
+
+	return sessionManager.GetString(ctx, "userID")
+}
+
+// listAccounts returns the login first and then the accounts linked to it
+func listAccounts(ctx context.Context) ([]Account, error) {
+	login := loginID(ctx)
+	active := sessionManager.GetString(ctx, "userID")
+
+	owner, err := repo.GetUser(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	linked, err := repo.ListLinkedAccounts(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := []Account{{User: *owner, Active: owner.ID == active, Owner: true}}
+	for _, u := range linked {
+		accounts = append(accounts, Account{User: u, Active: u.ID == active})
+	}
+
+	return accounts, nil
+}
+
+// canActAs tells whether the login may act as userID
+func canActAs(ctx context.Context, userID string) bool {
+	if userID == loginID(ctx) {
+		return true
+	}
+
+	linked, err := repo.ListLinkedAccounts(ctx, loginID(ctx))
+	if err != nil {
+		log.Printf("canActAs %s: %v", userID, err)
+		return false
+	}
+	for _, u := range linked {
+		if u.ID == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// linkAccount sends a logged in user through hh login once more,
+// callback links the account they come back with
+func linkAccount(w http.ResponseWriter, r *http.Request) {
+	sessionManager.Put(r.Context(), "linking", true)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func switchAccount(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+
+	if !canActAs(r.Context(), userID) {
+		sessionManager.Put(r.Context(), "error", "This account is not linked to you.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	user, err := repo.GetUser(r.Context(), userID)
+	switch {
+	case err != nil:
+		log.Printf("/accounts/switch %s: %v", userID, err)
+		sessionManager.Put(r.Context(), "error", "Could not switch accounts. Try again.")
+	case user.IsDisabled:
+		sessionManager.Put(r.Context(), "error", "This account is disabled.")
+	default:
+		sessionManager.Put(r.Context(), "userID", userID)
+		sessionManager.Put(r.Context(), "notification", "Switched to "+user.LastName+" "+user.FirstName+".")
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// unlinkAccount only forgets the link, the account keeps its
+// tokens and schedule and can still log in by itself
+func unlinkAccount(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+	login := loginID(r.Context())
+
+	err := repo.UnlinkAccount(r.Context(), login, userID)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		sessionManager.Put(r.Context(), "error", "This account is not linked to you.")
+	case err != nil:
+		log.Printf("/accounts/unlink %s from %s: %v", userID, login, err)
+		sessionManager.Put(r.Context(), "error", "Could not unlink the account. Try again.")
+	default:
+		audit(r, storage.AuditEvent{Action: storage.AuditAccountUnlink, UserID: userID, Target: login})
+		if sessionManager.GetString(r.Context(), "userID") == userID {
+			sessionManager.Put(r.Context(), "userID", login)
+		}
+		sessionManager.Put(r.Context(), "notification", "Account unlinked, its bumps keep running.")
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
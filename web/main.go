@@ -1,18 +1,26 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"embed"
+	"errors"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/alexedwards/scs/v2/memstore"
-	_ "github.com/mattn/go-sqlite3"
+
+	"hhcv/hh"
+	"hhcv/storage"
+	"hhcv/timing"
 )
 
 var (
@@ -21,8 +29,9 @@ var (
 	serverPort, serverHost, serverHTTP            string
 	templates                                     *template.Template
 	client                                        *http.Client
-	db                                            *sql.DB
+	repo                                          storage.Repository
 	sessionManager                                *scs.SessionManager
+	adminIDs                                      map[string]bool
 
 	//go:embed templates/*.html
 	templatesFS embed.FS
@@ -42,8 +51,24 @@ func main() {
 		log.Fatal("main: no credentials provided")
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	adminIDs = loadAdminIDs()
+	applyDailyCap = loadApplyDailyCap()
+
 	var err error
-	db, err = db_init()
+	if defaultLocation, err = timing.Location(); err != nil {
+		log.Fatal("main: ", err)
+	}
+	if fixedTimes, err = timing.FixedTimes(); err != nil {
+		log.Fatal("main: ", err)
+	}
+	if u := os.Getenv("HH_API_URL"); u != "" {
+		hh.API = strings.TrimSuffix(u, "/")
+	}
+
+	repo, err = storage.Open(ctx, storage.ConfigFromEnv())
 	if err != nil {
 		log.Fatal("main: ", err)
 	}
@@ -58,10 +83,12 @@ func main() {
 	client = &http.Client{Timeout: 10 * time.Second}
 	templates = template.Must(
 		template.New("base").
+			// render replaces these with funcs bound to the zone of the login
 			Funcs(template.FuncMap{
-				"formatTime": func(t HHTime) string {
-					return t.Format(timeLayout)
-				},
+				"formatTime":  func(t time.Time) string { return HHTime(t).Format(displayLayout) },
+				"timeZone":    func() string { return defaultLocation.String() },
+				"zoneUnknown": func() bool { return true },
+				"fixedTimes":  func() []string { return formatFixedTimes(time.Now(), defaultLocation) },
 			}).
 			ParseFS(templatesFS,
 				"templates/base.html",
@@ -69,23 +96,97 @@ func main() {
 				"templates/info.html",
 				"templates/modal.html",
 				"templates/toggle-switch.html",
+				"templates/admin.html",
+				"templates/activity.html",
+				"templates/applications.html",
+				"templates/matches.html",
+				"templates/searches.html",
+				"templates/letters.html",
+				"templates/history.html",
+				"templates/blacklist.html",
 			),
 	)
 
 	http.HandleFunc("/", home)
 	http.HandleFunc("/login", login)
 	http.HandleFunc("/logout", logout)
-	http.HandleFunc("/invalidate", invalidateUserData)
+	http.HandleFunc("POST /invalidate", invalidateUserData)
 	http.HandleFunc("/auth/callback", callback)
-	http.HandleFunc("/get-resumes", updateResumesOnDemand)
+	http.Handle("/get-resumes", authRequired(http.HandlerFunc(updateResumesOnDemand)))
 	http.HandleFunc("/open-modal", openModal)
 	http.HandleFunc("/close-modal", closeModal)
-	http.HandleFunc("POST /toggle-schedule/{id}", toggleResume)
+	http.Handle("POST /toggle-schedule/{id}", authRequired(http.HandlerFunc(toggleResume)))
+	http.Handle("GET /my-data", authRequired(http.HandlerFunc(downloadUserData)))
+	http.Handle("GET /activity", authRequired(http.HandlerFunc(activity)))
+	http.Handle("GET /applications", authRequired(http.HandlerFunc(applications)))
+	http.Handle("GET /resumes/{id}/matches", authRequired(http.HandlerFunc(matches)))
+	http.Handle("GET /resumes/{id}/history", authRequired(http.HandlerFunc(resumeHistory)))
+	http.Handle("GET /resumes/{id}/blacklist", authRequired(http.HandlerFunc(resumeBlacklist)))
+	http.Handle("POST /resumes/{id}/blacklist", authRequired(setBlacklisted(true)))
+	http.Handle("POST /resumes/{id}/blacklist/{employer}/delete", authRequired(setBlacklisted(false)))
+	http.Handle("POST /resumes/{id}/matches/{vacancy}/interesting", authRequired(http.HandlerFunc(markInteresting)))
+	http.Handle("POST /employers/{id}/hide", authRequired(setEmployerHidden(true)))
+	http.Handle("POST /employers/{id}/unhide", authRequired(setEmployerHidden(false)))
+	http.Handle("GET /searches", authRequired(http.HandlerFunc(searches)))
+	http.Handle("POST /searches", authRequired(http.HandlerFunc(createSearch)))
+	http.Handle("GET /searches/{id}", authRequired(http.HandlerFunc(searchResults)))
+	http.Handle("POST /searches/{id}/delete", authRequired(http.HandlerFunc(deleteSearch)))
+	http.Handle("GET /letters", authRequired(http.HandlerFunc(letters)))
+	http.Handle("POST /letters", authRequired(http.HandlerFunc(createLetter)))
+	http.Handle("POST /letters/{id}/delete", authRequired(http.HandlerFunc(deleteLetter)))
+	http.Handle("POST /apply", authRequired(http.HandlerFunc(apply)))
+	http.Handle("POST /time-zone", authRequired(http.HandlerFunc(setTimeZone)))
+	http.Handle("POST /schedule-mode", authRequired(http.HandlerFunc(setScheduleMode)))
+	http.Handle("GET /accounts/link", authRequired(http.HandlerFunc(linkAccount)))
+	http.Handle("POST /accounts/{id}/switch", authRequired(http.HandlerFunc(switchAccount)))
+	http.Handle("POST /accounts/{id}/unlink", authRequired(http.HandlerFunc(unlinkAccount)))
 
-	log.Printf("server starting %s://%s:%s", serverHTTP, serverHost, serverPort)
-	err = http.ListenAndServe(":"+serverPort, sessionManager.LoadAndSave(http.DefaultServeMux))
-	if err != nil {
-		log.Fatal("main: couldnt start server", err)
+	http.Handle("GET /admin", adminRequired(http.HandlerFunc(adminDashboard)))
+	http.Handle("POST /admin/users/{id}/disable", adminRequired(adminSetUserDisabled(true)))
+	http.Handle("POST /admin/users/{id}/enable", adminRequired(adminSetUserDisabled(false)))
+	http.Handle("POST /admin/users/{id}/resync", adminRequired(http.HandlerFunc(adminResyncUser)))
+	http.Handle("POST /admin/users/{id}/purge", adminRequired(http.HandlerFunc(adminPurgeUser)))
+
+	// requests get their own base context so that in-flight work
+	// survives the signal and is only canceled if shutdown times out
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
+	srv := &http.Server{
+		Addr:              ":" + serverPort,
+		Handler:           sessionManager.LoadAndSave(http.DefaultServeMux),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("server starting %s://%s:%s", serverHTTP, serverHost, serverPort)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("main: couldnt start server ", err)
+		}
+	case <-ctx.Done():
+		log.Println("main: shutting down")
 	}
 
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("main: graceful shutdown failed, canceling in-flight requests: ", err)
+		cancelBase()
+		srv.Close()
+	}
+
+	if err = repo.Close(); err != nil {
+		log.Println("main: closing db: ", err)
+	}
 }
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"hhcv/storage"
+)
+
+type MatchItem struct {
+	storage.Match
+	// New is set for matches that came up after the previous visit
+	New bool
+}
+
+type MatchesData struct {
+	Resume storage.Resume
+	// Since is the previous visit, actions on the page carry it along
+	// so their redirects do not count as a visit
+	Since  string
+	Items  []MatchItem
+	Hidden []storage.HiddenEmployer
+	// Letters and Back are for applying from the page
+	Letters []storage.CoverLetter
+	Back    string
+}
+
+// matchesAccount is the account a matches request is about, the active one
+// unless the form or query names a linked one
+func matchesAccount(r *http.Request) (string, bool) {
+	account := r.FormValue("account")
+	if account == "" {
+		return sessionManager.GetString(r.Context(), "userID"), true
+	}
+
+	return account, canActAs(r.Context(), account)
+}
+
+func matchesURL(resumeID, account, since string) string {
+	q := url.Values{"account": {account}}
+	if since != "" {
+		q.Set("since", since)
+	}
+
+	return fmt.Sprintf("/resumes/%s/matches?%s", url.PathEscape(resumeID), q.Encode())
+}
+
+func matches(w http.ResponseWriter, r *http.Request) {
+	resumeID := r.PathValue("id")
+	account, ok := matchesAccount(r)
+	if !ok {
+		http.Error(w, "This account is not linked to you.", http.StatusForbidden)
+		return
+	}
+
+	data := PageData{
+		IsLoggedIn: true,
+		IsAdmin:    isAdmin(loginID(r.Context())),
+		Error:      sessionManager.PopString(r.Context(), "error"),
+	}
+
+	resume, err := repo.GetResume(r.Context(), account, resumeID)
+	if errors.Is(err, storage.ErrNotFound) {
+		sessionManager.Put(r.Context(), "error", "No such resume.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("/matches failed to get resume %s: %v", resumeID, err)
+		sessionManager.Put(r.Context(), "error", "Could not load the resume. Try again.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	userID := sessionManager.GetString(r.Context(), "userID")
+	if data.User, err = repo.GetUser(r.Context(), userID); err != nil {
+		log.Printf("/matches failed to get user %s: %v", userID, err)
+	}
+	if data.Accounts, err = listAccounts(r.Context()); err != nil {
+		log.Printf("/matches failed to get accounts of %s: %v", loginID(r.Context()), err)
+	}
+
+	since, err := time.Parse(time.RFC3339, r.URL.Query().Get("since"))
+	if err != nil {
+		if since, err = repo.MarkMatchesSeen(r.Context(), account, resumeID); err != nil {
+			log.Printf("/matches failed to mark matches of %s seen: %v", resumeID, err)
+		}
+	}
+
+	md := MatchesData{Resume: *resume, Since: since.UTC().Format(time.RFC3339)}
+	md.Back = matchesURL(resumeID, account, md.Since)
+	items, err := repo.ListMatches(r.Context(), account, resumeID)
+	if err != nil {
+		log.Printf("/matches failed to get matches of %s: %v", resumeID, err)
+		data.Error += " Could not load matching vacancies."
+	}
+	for _, m := range items {
+		md.Items = append(md.Items, MatchItem{Match: m, New: m.FirstSeenAt.After(since)})
+	}
+
+	if md.Hidden, err = repo.ListHiddenEmployers(r.Context(), account); err != nil {
+		log.Printf("/matches failed to get hidden employers of %s: %v", account, err)
+	}
+	if md.Letters, err = repo.ListCoverLetters(r.Context(), account); err != nil {
+		log.Printf("/matches failed to get letters of %s: %v", account, err)
+	}
+	data.Matches = &md
+
+	if err := render(w, r, "base", data); err != nil {
+		log.Printf("/matches: failed to execute template: %v", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+	}
+}
+
+func markInteresting(w http.ResponseWriter, r *http.Request) {
+	resumeID, vacancyID := r.PathValue("id"), r.PathValue("vacancy")
+	account, ok := matchesAccount(r)
+	if !ok {
+		http.Error(w, "This account is not linked to you.", http.StatusForbidden)
+		return
+	}
+
+	interesting := r.FormValue("interesting") == "true"
+	if err := repo.SetMatchInteresting(r.Context(), account, resumeID, vacancyID, interesting); err != nil {
+		log.Printf("/matches failed to mark %s of %s: %v", vacancyID, resumeID, err)
+		sessionManager.Put(r.Context(), "error", "Could not update the vacancy. Try again.")
+	}
+
+	http.Redirect(w, r, matchesURL(resumeID, account, r.FormValue("since")), http.StatusSeeOther)
+}
+
+// setEmployerHidden hides or shows again matches from an employer,
+// every resume of the account is affected
+func setEmployerHidden(hidden bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		employerID := r.PathValue("id")
+		account, ok := matchesAccount(r)
+		if !ok {
+			http.Error(w, "This account is not linked to you.", http.StatusForbidden)
+			return
+		}
+
+		var err error
+		if hidden {
+			err = repo.HideEmployer(r.Context(), &storage.HiddenEmployer{UserID: account, EmployerID: employerID, Name: r.FormValue("name")})
+		} else {
+			err = repo.UnhideEmployer(r.Context(), account, employerID)
+		}
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("/employers failed to set hidden=%t for %s of %s: %v", hidden, employerID, account, err)
+			sessionManager.Put(r.Context(), "error", "Could not update the employer. Try again.")
+		}
+
+		back := "/"
+		if resumeID := r.FormValue("resume"); resumeID != "" {
+			back = matchesURL(resumeID, account, r.FormValue("since"))
+		}
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	}
+}
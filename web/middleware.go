@@ -1,7 +1,15 @@
 package main
 
-import "net/http"
+import (
+	"errors"
+	"log"
+	"net/http"
 
+	"hhcv/storage"
+)
+
+// authRequired lets through sessions of users that still exist and are not
+// disabled, a disabled linked account falls back to the login like home does
 func authRequired(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID := sessionManager.GetString(r.Context(), "userID")
@@ -9,6 +17,37 @@ func authRequired(next http.Handler) http.Handler {
 			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
-		next.ServeHTTP(w, r)
+
+		user, err := repo.GetUser(r.Context(), userID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("authRequired: failed to get user %s: %v", userID, err)
+			http.Error(w, "Internal server error.", http.StatusInternalServerError)
+			return
+		}
+
+		login := loginID(r.Context())
+		switch {
+		case err == nil && !user.IsDisabled:
+			next.ServeHTTP(w, r)
+		case userID != login:
+			sessionManager.Put(r.Context(), "userID", login)
+			sessionManager.Put(r.Context(), "error", "This account is disabled, switched back to yours.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		default:
+			sessionManager.Remove(r.Context(), "userID")
+			sessionManager.Remove(r.Context(), "loginID")
+			sessionManager.Put(r.Context(), "error", "Your account is disabled.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		}
 	})
 }
+
+func adminRequired(next http.Handler) http.Handler {
+	return authRequired(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(loginID(r.Context())) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
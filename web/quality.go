@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"hhcv/quality"
+)
+
+// resumeQuality scores every resume of a user by its latest snapshot,
+// resumes without one are left out until the next sync takes it
+func resumeQuality(ctx context.Context, userID string) (map[string]*quality.Report, error) {
+	snaps, err := repo.LatestResumeSnapshots(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make(map[string]*quality.Report, len(snaps))
+	for id, snap := range snaps {
+		r, err := quality.Parse([]byte(snap.Data))
+		if err != nil {
+			continue
+		}
+		report := quality.Evaluate(r, quality.Rules, time.Now())
+		reports[id] = &report
+	}
+
+	return reports, nil
+}
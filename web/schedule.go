@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"hhcv/storage"
+	"hhcv/timing"
+)
+
+// setScheduleMode switches an account between the fixed times and auto slots,
+// slots are planned right away from the views the scheduler collected so far
+func setScheduleMode(w http.ResponseWriter, r *http.Request) {
+	account, ok := matchesAccount(r)
+	if !ok {
+		http.Error(w, "This account is not linked to you.", http.StatusForbidden)
+		return
+	}
+
+	mode := r.FormValue("mode")
+	if mode != storage.ScheduleFixed && mode != storage.ScheduleAuto {
+		sessionManager.Put(r.Context(), "error", "Pick fixed or auto.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	user, err := repo.GetUser(r.Context(), account)
+	if err != nil {
+		log.Printf("/schedule-mode failed to get user %s: %v", account, err)
+		sessionManager.Put(r.Context(), "error", "Could not update. Try again.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if user.ScheduleMode == mode {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if err := repo.SetScheduleMode(r.Context(), account, mode); err != nil {
+		log.Printf("/schedule-mode failed to set %s for %s: %v", mode, account, err)
+		sessionManager.Put(r.Context(), "error", "Could not update. Try again.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	audit(r, storage.AuditEvent{Action: storage.AuditScheduleMode, UserID: account, Details: user.ScheduleMode + " -> " + mode})
+
+	if mode == storage.ScheduleFixed {
+		sessionManager.Put(r.Context(), "notification", "Resumes are bumped at the fixed times again.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	slots, note, err := timing.Replan(r.Context(), repo, account, time.Now(), user.Location(defaultLocation))
+	if err == nil && len(slots) == 0 {
+		sessionManager.Put(r.Context(), "notification", "Auto mode is on: "+note+".")
+	}
+	if err != nil {
+		// the next scheduler run plans them anyway
+		log.Printf("/schedule-mode failed to plan slots for %s: %v", account, err)
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
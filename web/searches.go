@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hhcv/storage"
+)
+
+const searchResultsLimit = 100
+
+// Option is a value from an hh dictionary and how the form shows it
+type Option struct {
+	Value string
+	Label string
+}
+
+var (
+	experienceOptions = []Option{
+		{"noExperience", "No experience"},
+		{"between1And3", "1 to 3 years"},
+		{"between3And6", "3 to 6 years"},
+		{"moreThan6", "More than 6 years"},
+	}
+	scheduleOptions = []Option{
+		{"fullDay", "Full day"},
+		{"shift", "Shift"},
+		{"flexible", "Flexible"},
+		{"remote", "Remote"},
+		{"flyInFlyOut", "Fly-in fly-out"},
+	}
+)
+
+type SearchItem struct {
+	storage.SearchResult
+	// New is set for results found after the previous visit
+	New bool
+}
+
+// SearchesData is either the list of saved searches or, when Search
+// is set, what one of them found
+type SearchesData struct {
+	Searches    []storage.SavedSearch
+	Search      *storage.SavedSearch
+	Items       []SearchItem
+	Experiences []Option
+	Schedules   []Option
+	// Resumes and Letters are for applying to results
+	Resumes []storage.Resume
+	Letters []storage.CoverLetter
+}
+
+func validOption(options []Option, value string) bool {
+	if value == "" {
+		return true
+	}
+	for _, o := range options {
+		if o.Value == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func searchesPage(r *http.Request) PageData {
+	userID := sessionManager.GetString(r.Context(), "userID")
+	data := PageData{
+		IsLoggedIn:   true,
+		IsAdmin:      isAdmin(loginID(r.Context())),
+		Notification: sessionManager.PopString(r.Context(), "notification"),
+		Error:        sessionManager.PopString(r.Context(), "error"),
+	}
+
+	var err error
+	if data.User, err = repo.GetUser(r.Context(), userID); err != nil {
+		log.Printf("/searches failed to get user %s: %v", userID, err)
+		data.Error += " Could not load your user profile."
+	}
+	if data.Accounts, err = listAccounts(r.Context()); err != nil {
+		log.Printf("/searches failed to get accounts of %s: %v", loginID(r.Context()), err)
+	}
+
+	return data
+}
+
+func searches(w http.ResponseWriter, r *http.Request) {
+	userID := sessionManager.GetString(r.Context(), "userID")
+	data := searchesPage(r)
+
+	sd := SearchesData{Experiences: experienceOptions, Schedules: scheduleOptions}
+	var err error
+	if sd.Searches, err = repo.ListSearches(r.Context(), userID); err != nil {
+		log.Printf("/searches failed to get searches of %s: %v", userID, err)
+		data.Error += " Could not load your searches."
+	}
+	data.Searches = &sd
+
+	if err := render(w, r, "base", data); err != nil {
+		log.Printf("/searches: failed to execute template: %v", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+	}
+}
+
+// createSearch saves a search, the scheduler runs it before the next bump
+func createSearch(w http.ResponseWriter, r *http.Request) {
+	s := storage.SavedSearch{
+		UserID:     sessionManager.GetString(r.Context(), "userID"),
+		Name:       strings.TrimSpace(r.FormValue("name")),
+		Text:       strings.TrimSpace(r.FormValue("text")),
+		Area:       strings.TrimSpace(r.FormValue("area")),
+		Experience: r.FormValue("experience"),
+		Schedule:   r.FormValue("schedule"),
+	}
+
+	var err error
+	if salary := strings.TrimSpace(r.FormValue("salary")); salary != "" {
+		s.Salary, err = strconv.Atoi(salary)
+	}
+
+	switch {
+	case err != nil || s.Salary < 0:
+		sessionManager.Put(r.Context(), "error", "Salary must be a positive number.")
+	case s.Area != "" && strings.Trim(s.Area, "0123456789") != "":
+		sessionManager.Put(r.Context(), "error", "Area must be an hh area id, 1 is Moscow.")
+	case !validOption(experienceOptions, s.Experience) || !validOption(scheduleOptions, s.Schedule):
+		sessionManager.Put(r.Context(), "error", "Unknown experience or schedule.")
+	case s.Text == "" && s.Area == "" && s.Salary == 0 && s.Experience == "" && s.Schedule == "":
+		sessionManager.Put(r.Context(), "error", "Fill in at least one field to search by.")
+	default:
+		if s.Name == "" {
+			s.Name = s.Text
+		}
+		if s.Name == "" {
+			s.Name = "Search"
+		}
+		if err := repo.CreateSearch(r.Context(), &s); err != nil {
+			log.Printf("/searches failed to create search for %s: %v", s.UserID, err)
+			sessionManager.Put(r.Context(), "error", "Could not save the search. Try again.")
+		} else {
+			sessionManager.Put(r.Context(), "notification", "Search saved, it runs before the next bump.")
+		}
+	}
+
+	http.Redirect(w, r, "/searches", http.StatusSeeOther)
+}
+
+func deleteSearch(w http.ResponseWriter, r *http.Request) {
+	userID := sessionManager.GetString(r.Context(), "userID")
+	err := storage.ErrNotFound
+	if searchID, perr := strconv.ParseInt(r.PathValue("id"), 10, 64); perr == nil {
+		err = repo.DeleteSearch(r.Context(), userID, searchID)
+	}
+
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		sessionManager.Put(r.Context(), "error", "No such search.")
+	case err != nil:
+		log.Printf("/searches failed to delete search %s of %s: %v", r.PathValue("id"), userID, err)
+		sessionManager.Put(r.Context(), "error", "Could not delete the search. Try again.")
+	default:
+		sessionManager.Put(r.Context(), "notification", "Search deleted.")
+	}
+
+	http.Redirect(w, r, "/searches", http.StatusSeeOther)
+}
+
+// searchResults shows what a search found, results that came after
+// the previous visit are marked new
+func searchResults(w http.ResponseWriter, r *http.Request) {
+	userID := sessionManager.GetString(r.Context(), "userID")
+	searchID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	search, err := repo.GetSearch(r.Context(), userID, searchID)
+	if errors.Is(err, storage.ErrNotFound) {
+		sessionManager.Put(r.Context(), "error", "No such search.")
+		http.Redirect(w, r, "/searches", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("/searches failed to get search %d: %v", searchID, err)
+		sessionManager.Put(r.Context(), "error", "Could not load the search. Try again.")
+		http.Redirect(w, r, "/searches", http.StatusSeeOther)
+		return
+	}
+
+	data := searchesPage(r)
+
+	since, err := repo.MarkSearchSeen(r.Context(), userID, searchID)
+	if err != nil {
+		log.Printf("/searches failed to mark search %d seen: %v", searchID, err)
+		since = time.Now()
+	}
+
+	sd := SearchesData{Search: search}
+	results, err := repo.ListSearchResults(r.Context(), userID, searchID, searchResultsLimit)
+	if err != nil {
+		log.Printf("/searches failed to get results of %d: %v", searchID, err)
+		data.Error += fmt.Sprintf(" Could not load results of %s.", search.Name)
+	}
+	for _, res := range results {
+		sd.Items = append(sd.Items, SearchItem{SearchResult: res, New: res.FirstSeenAt.After(since)})
+	}
+	if sd.Resumes, err = repo.ListResumes(r.Context(), userID); err != nil {
+		log.Printf("/searches failed to get resumes of %s: %v", userID, err)
+	}
+	if sd.Letters, err = repo.ListCoverLetters(r.Context(), userID); err != nil {
+		log.Printf("/searches failed to get letters of %s: %v", userID, err)
+	}
+	data.Searches = &sd
+
+	if err := render(w, r, "base", data); err != nil {
+		log.Printf("/searches: failed to execute template: %v", err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+	}
+}
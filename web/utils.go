@@ -1,13 +1,8 @@
 package main
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
-	"fmt"
-	"io"
-	"os"
 )
 
 func GenerateState(length int) (string, error) {
@@ -19,54 +14,3 @@ func GenerateState(length int) (string, error) {
 
 	return base64.URLEncoding.EncodeToString(b), nil
 }
-
-func Encrypt(plaintext string) (string, error) {
-	block, err := aes.NewCipher([]byte(os.Getenv("ENCRYPTION_KEY")))
-	if err != nil {
-		return "", fmt.Errorf("could not create cipher block: %w", err)
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("could not create GCM: %w", err)
-	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", fmt.Errorf("could not generate nonce: %w", err)
-	}
-
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
-}
-
-func Decrypt(encryptedString string) (string, error) {
-	data, err := base64.StdEncoding.DecodeString(encryptedString)
-	if err != nil {
-		return "", fmt.Errorf("could not decode base64: %w", err)
-	}
-
-	block, err := aes.NewCipher([]byte(os.Getenv("ENCRYPTION_KEY")))
-	if err != nil {
-		return "", fmt.Errorf("could not create cipher block: %w", err)
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("could not create GCM: %w", err)
-	}
-
-	nonceSize := gcm.NonceSize()
-	if len(data) < nonceSize {
-		return "", fmt.Errorf("ciphertext too short (missing nonce)")
-	}
-
-	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return "", fmt.Errorf("could not decrypt: %w", err)
-	}
-
-	return string(plaintext), nil
-}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"hhcv/storage"
+	"hhcv/timing"
+)
+
+// displayLayout is how times are shown, always in the zone of the login
+const displayLayout = "Mon, 02 Jan 2006 15:04 MST"
+
+// defaultLocation is the zone of the fixed times, times are shown in it
+// until the browser of the login tells its own
+var defaultLocation *time.Location
+
+// fixedTimes are the SCHEDULE_TIMES offsets from midnight in defaultLocation
+var fixedTimes []time.Duration
+
+// zoned holds a copy of templates per time zone name, its funcs show times
+// in that zone. templates itself is never executed, html/template can not
+// clone a template after that
+var zoned sync.Map
+
+func templatesFor(zone string) (*template.Template, error) {
+	if t, ok := zoned.Load(zone); ok {
+		return t.(*template.Template), nil
+	}
+
+	loc := defaultLocation
+	if zone != "" {
+		if l, err := time.LoadLocation(zone); err == nil {
+			loc = l
+		}
+	}
+
+	t, err := templates.Clone()
+	if err != nil {
+		return nil, err
+	}
+	t.Funcs(template.FuncMap{
+		"formatTime": func(t time.Time) string {
+			return HHTime(t.In(loc)).Format(displayLayout)
+		},
+		"timeZone":    func() string { return loc.String() },
+		"zoneUnknown": func() bool { return zone == "" },
+		"fixedTimes":  func() []string { return formatFixedTimes(time.Now(), loc) },
+	})
+
+	actual, _ := zoned.LoadOrStore(zone, t)
+	return actual.(*template.Template), nil
+}
+
+// formatFixedTimes shows the fixed times of the day around now in loc
+func formatFixedTimes(now time.Time, loc *time.Location) []string {
+	now = now.In(defaultLocation)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, defaultLocation)
+
+	times := make([]string, 0, len(fixedTimes))
+	for _, offset := range fixedTimes {
+		times = append(times, day.Add(offset).In(loc).Format("15:04"))
+	}
+
+	return times
+}
+
+// render executes a template with times in the zone of the login
+func render(w io.Writer, r *http.Request, name string, data any) error {
+	t, err := templatesFor(sessionManager.GetString(r.Context(), "timeZone"))
+	if err != nil {
+		return err
+	}
+
+	return t.ExecuteTemplate(w, name, data)
+}
+
+// setTimeZone stores the zone times are shown to the login in. The page
+// posts the zone of the browser with detected set when none is stored,
+// it never replaces a zone the user picked
+func setTimeZone(w http.ResponseWriter, r *http.Request) {
+	login := loginID(r.Context())
+	zone := strings.TrimSpace(r.FormValue("zone"))
+	detected := r.FormValue("detected") != ""
+
+	if _, err := time.LoadLocation(zone); err != nil || zone == "" || zone == "Local" {
+		if detected {
+			log.Printf("/time-zone: browser of %s sent unknown zone %q", login, zone)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		sessionManager.Put(r.Context(), "error", "Unknown time zone, use a name like Europe/Moscow.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	user, err := repo.GetUser(r.Context(), login)
+	if err != nil {
+		log.Printf("/time-zone failed to get user %s: %v", login, err)
+		http.Error(w, "Internal server error.", http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case detected && user.TimeZone != "":
+		zone = user.TimeZone
+	case zone != user.TimeZone:
+		if err := repo.SetTimeZone(r.Context(), login, zone); err != nil {
+			log.Printf("/time-zone failed to set %s for %s: %v", zone, login, err)
+			sessionManager.Put(r.Context(), "error", "Could not update. Try again.")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		user.TimeZone = zone
+
+		// slots are planned by the hours of the user, reasons name them
+		if user.ScheduleMode == storage.ScheduleAuto {
+			if _, _, err := timing.Replan(r.Context(), repo, login, time.Now(), user.Location(defaultLocation)); err != nil {
+				log.Printf("/time-zone failed to replan slots of %s: %v", login, err)
+			}
+		}
+	}
+	sessionManager.Put(r.Context(), "timeZone", zone)
+
+	if detected {
+		// times on the page were shown in the default zone, htmx reloads it
+		w.Header().Set("HX-Refresh", "true")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	sessionManager.Put(r.Context(), "notification", "Times are shown in "+zone+" now.")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+
+	"hhcv/storage"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestFormatFixedTimes(t *testing.T) {
+	oldLoc, oldTimes := defaultLocation, fixedTimes
+	t.Cleanup(func() { defaultLocation, fixedTimes = oldLoc, oldTimes })
+	defaultLocation = mustLoad(t, "Europe/Moscow")
+	fixedTimes = []time.Duration{8*time.Hour + 30*time.Minute, 16*time.Hour + 30*time.Minute}
+
+	summer := time.Date(2026, 7, 1, 12, 0, 0, 0, time.UTC)
+	winter := time.Date(2026, 12, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		loc  *time.Location
+		want []string
+	}{
+		{"default zone", summer, defaultLocation, []string{"08:30", "16:30"}},
+		{"utc", summer, time.UTC, []string{"05:30", "13:30"}},
+		{"half hour zone", summer, mustLoad(t, "Asia/Kolkata"), []string{"11:00", "19:00"}},
+		// Moscow keeps its offset all year, Berlin moves an hour
+		{"summer time", summer, mustLoad(t, "Europe/Berlin"), []string{"07:30", "15:30"}},
+		{"winter time", winter, mustLoad(t, "Europe/Berlin"), []string{"06:30", "14:30"}},
+		// 23:00 UTC is already the next day in Moscow, the times are of that day
+		{"day of the default zone", time.Date(2026, 10, 24, 23, 0, 0, 0, time.UTC), mustLoad(t, "America/New_York"), []string{"01:30", "09:30"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatFixedTimes(tt.now, tt.loc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// zoneSession points repo at an empty sqlite database with u1 in zone and
+// sessionManager at a memory store
+func zoneSession(t *testing.T, zone string) {
+	t.Helper()
+
+	oldRepo, oldSessions, oldLoc := repo, sessionManager, defaultLocation
+	t.Cleanup(func() { repo, sessionManager, defaultLocation = oldRepo, oldSessions, oldLoc })
+	defaultLocation = mustLoad(t, "Europe/Moscow")
+
+	cfg := storage.Config{Driver: storage.DriverSQLite, DSN: filepath.Join(t.TempDir(), "db.sqlite")}
+	r, err := storage.Open(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	repo = r
+
+	ctx := context.Background()
+	if err := repo.UpsertUser(ctx, &storage.User{ID: "u1", FirstName: "Ivan"}); err != nil {
+		t.Fatal(err)
+	}
+	if zone != "" {
+		if err := repo.SetTimeZone(ctx, "u1", zone); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessionManager = scs.New()
+	sessionManager.Store = memstore.New()
+}
+
+// postZone posts the form as u1 and returns the answer and the zone
+// the session shows times in
+func postZone(t *testing.T, form url.Values) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+
+	var sessionZone string
+	h := sessionManager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionManager.Put(r.Context(), "userID", "u1")
+		setTimeZone(w, r)
+		sessionZone = sessionManager.GetString(r.Context(), "timeZone")
+	}))
+
+	req := httptest.NewRequest("POST", "/time-zone", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	return w, sessionZone
+}
+
+func TestSetTimeZone(t *testing.T) {
+	tests := []struct {
+		name        string
+		stored      string
+		form        url.Values
+		wantStatus  int
+		wantStored  string
+		wantSession string
+	}{
+		{
+			name:        "detected zone is stored when there is none",
+			form:        url.Values{"zone": {"Asia/Kolkata"}, "detected": {"1"}},
+			wantStatus:  http.StatusNoContent,
+			wantStored:  "Asia/Kolkata",
+			wantSession: "Asia/Kolkata",
+		},
+		{
+			name:        "detected zone never replaces a picked one",
+			stored:      "Europe/Berlin",
+			form:        url.Values{"zone": {"Asia/Kolkata"}, "detected": {"1"}},
+			wantStatus:  http.StatusNoContent,
+			wantStored:  "Europe/Berlin",
+			wantSession: "Europe/Berlin",
+		},
+		{
+			name:        "picked zone replaces the stored one",
+			stored:      "Europe/Berlin",
+			form:        url.Values{"zone": {" Asia/Kolkata "}},
+			wantStatus:  http.StatusSeeOther,
+			wantStored:  "Asia/Kolkata",
+			wantSession: "Asia/Kolkata",
+		},
+		{
+			name:       "unknown zone",
+			stored:     "Europe/Berlin",
+			form:       url.Values{"zone": {"Mars/Olympus_Mons"}},
+			wantStatus: http.StatusSeeOther,
+			wantStored: "Europe/Berlin",
+		},
+		{
+			name:       "Local is the zone of the server, not of the user",
+			form:       url.Values{"zone": {"Local"}},
+			wantStatus: http.StatusSeeOther,
+		},
+		{
+			name:       "empty zone",
+			stored:     "Europe/Berlin",
+			form:       url.Values{"zone": {""}},
+			wantStatus: http.StatusSeeOther,
+			wantStored: "Europe/Berlin",
+		},
+		{
+			name:       "unknown detected zone is ignored",
+			form:       url.Values{"zone": {"Mars/Olympus_Mons"}, "detected": {"1"}},
+			wantStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zoneSession(t, tt.stored)
+
+			w, sessionZone := postZone(t, tt.form)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if sessionZone != tt.wantSession {
+				t.Errorf("session shows times in %q, want %q", sessionZone, tt.wantSession)
+			}
+
+			u, err := repo.GetUser(context.Background(), "u1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.TimeZone != tt.wantStored {
+				t.Errorf("stored %q, want %q", u.TimeZone, tt.wantStored)
+			}
+		})
+	}
+}